@@ -18,6 +18,8 @@ import (
 	"log"
 	"os"
 	"unsafe"
+
+	"github.com/rabidaudio/cdz-nuts/audiocd/redbook"
 )
 
 // LogMode configures the destination for debug logs.
@@ -61,47 +63,19 @@ type DriveType int
 // FullSpeed can be passed to [SetSpeed] to run the drive at its fastest speed.
 const FullSpeed = -1
 
-// SampleRate is the number of samples per second. All Redbook audio
-// CDs use at 44.1KHz.
-const SampleRate = 44100
-
-// Samples are signed 16-bit
-const BitsPerSample = 16
-const BytesPerSample = BitsPerSample / 8
-
-// Channels is the number of audio channels in the data. All Redbook
-// audio CDs are stereo.
-//
-// CDParanoia source code detects 4-cannel audio on bit 8 of table of contents
-// flags. [Wikipedia] notes that four-channel audio support was planned but never
-// implemented and no known drives support it.
-//
-// [Wikipedia]: https://en.wikipedia.org/wiki/Compact_Disc_Digital_Audio#Audio_format
-const Channels = 2
-
-// SectorsPerSecond is the number of audio frames in one second of audio.
-// An audio frame is the smallest valid unit of length for a track, defined
-// as 1/75th of a second. Redbook track offsets are specified in MM:SS:FF.
-//
-// Note that this definition of frame is interchangeable with sector.
-// It is distinct from a 33-byte channel data frame, which this package does
-// not concern itself with.
-//
-// For more information, see [Wikipedia].
-//
-// [Wikipedia]: https://en.wikipedia.org/wiki/Compact_Disc_Digital_Audio#Frames_and_timecode_frames
-const SectorsPerSecond = 75
-
-// SamplesPerFrame is the number of 16-bit audio samples per channel
-// that appear within one frame of data (294).
-const SamplesPerFrame = SampleRate / SectorsPerSecond / Channels
-
-// BytesPerSector is the number of bytes of audio contained in one sector of
-// CD data (and equivalently in one frame of samples), 2352 bytes.
-//
-// Sectors are the unit of interest when reading data from CDs. AudioCD reads
-// data in units of sectors.
-const BytesPerSector = SampleRate * Channels * BytesPerSample / SectorsPerSecond
+// The units of CD audio are defined by [redbook], and re-exported here.
+const (
+	SampleRate          = redbook.SampleRate
+	BitsPerSample       = redbook.BitsPerSample
+	BytesPerSample      = redbook.BytesPerSample
+	Channels            = redbook.Channels
+	SectorsPerSecond    = redbook.SectorsPerSecond
+	SamplesPerFrame     = redbook.SamplesPerFrame
+	BytesPerSector      = redbook.BytesPerSector
+	LeadInSectors       = redbook.LeadInSectors
+	SamplesPerSector    = redbook.SamplesPerSector
+	BytesPerSampleFrame = redbook.BytesPerSampleFrame
+)
 
 // TrackPosition reports the offset information for tracks
 // from the table of contents.
@@ -142,15 +116,29 @@ func (t TrackPosition) ContainsSector(sector int) bool {
 //
 // Debug logging can be enabled by specifying LogMode. For [LogModeLogger],
 // supply a [log.Logger] instance to Logger.
+//
+// Instead of paranoia's error correction, errors can be concealed using
+// the drive's C2 error pointers; see [Concealment].
+//
+// Drives that cache audio can defeat paranoia's error checking. The cache
+// isn't defeated by default; see [CacheDefeat] to configure it.
 type AudioCD struct {
 	Device     string      // the path to the cdrom device, e.g. /dev/cdrom
 	MaxRetries int         // number of repeated reads on failed sectors. Set to -1 to disable retries. If 0, the default of 20 will be used
 	LogMode    LogMode     // direct the library logs
 	Logger     *log.Logger // if LogMode == LogModeLogger, the log.Logger to use
 
+	CacheDefeat  CacheDefeat // how to keep the drive's cache from serving verification re-reads
+	CacheSectors int         // size of the drive's cache to defeat. If 0, it will be detected or the default used
+	Concealment  Concealment // read with C2 error pointers and conceal errors instead of using paranoia
+
 	buf            bytes.Buffer
 	bufferedOffset int64
 	trueOffset     int64
+	err            error // error from the last iteration
+
+	concealed []SampleRange // ranges concealed since the last call to Concealed
+	concealer concealer     // concealment carried from one read to the next
 
 	drive    unsafe.Pointer // *C.cdrom_drive
 	paranoia unsafe.Pointer // *C.cdrom_paranoia
@@ -179,7 +167,16 @@ func (cd *AudioCD) Open() error {
 	if err != nil {
 		return err
 	}
-	err = cd.SetSpeed(FullSpeed)
+	if err := cd.setup(); err != nil {
+		cd.Close()
+		return err
+	}
+	return nil
+}
+
+// setup prepares a newly opened drive for reading.
+func (cd *AudioCD) setup() error {
+	err := cd.SetSpeed(FullSpeed)
 	if err != nil {
 		return err
 	}
@@ -194,7 +191,7 @@ func (cd *AudioCD) Open() error {
 	}
 
 	cd.SetParanoiaMode(ParanoiaModeFull)
-	return nil
+	return cd.configureCacheDefeat()
 }
 
 // Model returns information about the cd drive's manufacturer and model number.
@@ -353,6 +350,7 @@ func (cd *AudioCD) Seek(offset int64, whence int) (int64, error) {
 
 	// otherwise we're going to need to wipe buffer and seek
 	cd.buf.Truncate(0) // wipe buffered data
+	cd.concealer = concealer{}
 	cd.trueOffset = cd.bufferedOffset
 	secoffset := newoffset - (newoffset % BytesPerSector)
 
@@ -361,7 +359,13 @@ func (cd *AudioCD) Seek(offset int64, whence int) (int64, error) {
 		cd.trueOffset = cd.bufferedOffset
 		return cd.trueOffset, err
 	}
+	// the buffer now starts at the sector sought to
+	cd.bufferedOffset = secoffset
 	err = cd.bufferSectors(1)
+	for err == nil && cd.bufferedOffset <= newoffset {
+		// concealment may hold back the end of the sector
+		err = cd.bufferSectors(1)
+	}
 	cd.trueOffset = cd.bufferedOffset
 	if err != nil {
 		return cd.trueOffset, err
@@ -447,6 +451,12 @@ func (cd *AudioCD) readSectors(p []byte) (int64, error) {
 }
 
 func (cd *AudioCD) bufferSectors(nsectors int) error {
+	if cd.Concealment != ConcealNone {
+		p, err := cd.readSectorsC2(nsectors)
+		cd.bufferedOffset += int64(len(p))
+		cd.buf.Write(p)
+		return err
+	}
 	p := make([]byte, nsectors*BytesPerSector)
 	n, err := cd.readSectors(p)
 	cd.bufferedOffset += n
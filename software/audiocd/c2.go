@@ -0,0 +1,252 @@
+package audiocd
+
+import (
+	"encoding/binary"
+	"slices"
+)
+
+// Concealment selects how audio that the drive reports as unreadable
+// is handled.
+type Concealment int
+
+const (
+	// ConcealNone (the default) reads through paranoia, which re-reads
+	// and repairs errors and may skip or return suspect data when it
+	// can't.
+	ConcealNone Concealment = 0
+	// ConcealInterpolate reads with C2 error pointers, bypassing paranoia.
+	// Runs of erroneous samples up to [MaxInterpolateSamples] long are
+	// replaced by a linear interpolation between the surrounding good
+	// samples; longer runs are muted.
+	ConcealInterpolate Concealment = 1
+	// ConcealMute reads with C2 error pointers, bypassing paranoia, and
+	// mutes all erroneous samples.
+	ConcealMute Concealment = 2
+)
+
+// MaxInterpolateSamples is the longest run of erroneous samples, per
+// channel, that [ConcealInterpolate] will interpolate over (about 10ms).
+// Interpolating longer gaps produces audible artifacts, so they are muted.
+const MaxInterpolateSamples = SampleRate / 100
+
+// C2BytesPerSector is the size of the C2 error pointer field returned
+// with each sector: one bit per byte of audio.
+const C2BytesPerSector = BytesPerSector / 8
+
+// readCDSectors is the maximum number of sectors requested per READ CD.
+const readCDSectors = 24
+
+const cmdReadCD = 0xBE
+
+// SampleRange is a range of samples, counted per channel from
+// the start of the disc.
+type SampleRange struct {
+	Start  int64
+	Length int
+}
+
+// End returns the sample after the last one in the range.
+func (r SampleRange) End() int64 {
+	return r.Start + int64(r.Length)
+}
+
+// Concealed returns the ranges of samples that were concealed since the
+// last call to Concealed, and clears them. Adjacent ranges are merged.
+//
+// Ranges are only reported when Concealment is enabled.
+func (cd *AudioCD) Concealed() []SampleRange {
+	r := cd.concealed
+	cd.concealed = nil
+	return r
+}
+
+func (cd *AudioCD) addConcealed(ranges []SampleRange) {
+	for _, r := range ranges {
+		if n := len(cd.concealed); n > 0 && cd.concealed[n-1].End() == r.Start {
+			cd.concealed[n-1].Length += r.Length
+			continue
+		}
+		cd.concealed = append(cd.concealed, r)
+	}
+}
+
+func readCDCDB(sector, sectors int) []byte {
+	cdb := make([]byte, 12)
+	cdb[0] = cmdReadCD
+	cdb[1] = 0x04 // expected sector type: CD-DA
+	binary.BigEndian.PutUint32(cdb[2:], uint32(sector))
+	cdb[6] = byte(sectors >> 16)
+	cdb[7] = byte(sectors >> 8)
+	cdb[8] = byte(sectors)
+	cdb[9] = 0x12 // user data, C2 error bits
+	return cdb
+}
+
+// readSectorsC2 reads nsectors whole sectors from the read position
+// directly from the drive with C2 error pointers, and returns their
+// audio with erroneous samples concealed. A run of errors at the end
+// can't be concealed until the good sample after it is read, so it's
+// held back until the next read and fewer bytes than read may be
+// returned, or more when a run was held back by the last read.
+func (cd *AudioCD) readSectorsC2(nsectors int) ([]byte, error) {
+	c := &cd.concealer
+	// the frames held back come before the sectors to read
+	sample := cd.bufferedOffset / BytesPerSampleFrame
+	sector := int((sample + int64(len(c.open))) / SamplesPerSector)
+
+	const raw = BytesPerSector + C2BytesPerSector
+	buf := make([]byte, readCDSectors*raw)
+	frames := make([]Frame, readCDSectors*SamplesPerSector)
+	bad := make([]bool, len(frames))
+	p := make([]byte, 0, nsectors*BytesPerSector+len(c.open)*BytesPerSampleFrame)
+
+	// add appends the frames done to p and records the ranges concealed
+	add := func(done []Frame, ranges []SampleRange) {
+		for i := range ranges {
+			ranges[i].Start += sample
+		}
+		cd.addConcealed(ranges)
+		n := len(p)
+		p = p[:n+len(done)*BytesPerSampleFrame]
+		EncodeFrames(p[n:], done)
+		sample += int64(len(done))
+	}
+
+	for read := 0; read < nsectors; {
+		n := min(readCDSectors, nsectors-read)
+		nn, err := scsiCommand(cd, readCDCDB(sector, n), buf[:n*raw])
+		if err == nil && nn != n*raw {
+			err = ErrNoData
+		}
+		if err != nil {
+			// nothing good follows the frames held back
+			add(c.flush())
+			return p, err
+		}
+
+		f := frames[:n*SamplesPerSector]
+		b := bad[:len(f)]
+		for i := range n {
+			s := buf[i*raw : (i+1)*raw]
+			decodeFramesLE(f[i*SamplesPerSector:], s[:BytesPerSector])
+			c2ErrorFrames(b[i*SamplesPerSector:(i+1)*SamplesPerSector], s[BytesPerSector:])
+		}
+		add(c.add(f, b, cd.Concealment))
+		read += n
+		sector += n
+	}
+	return p, nil
+}
+
+// decodeFramesLE decodes little-endian PCM data, as returned by READ CD.
+func decodeFramesLE(dst []Frame, p []byte) {
+	for i := range min(len(dst), len(p)/BytesPerSampleFrame) {
+		b := p[i*BytesPerSampleFrame:]
+		dst[i].L = int16(binary.LittleEndian.Uint16(b[0:]))
+		dst[i].R = int16(binary.LittleEndian.Uint16(b[BytesPerSample:]))
+	}
+}
+
+// c2ErrorFrames marks the frames in bad that have an error in any of their
+// bytes, according to the C2 error pointers in c2. The most significant
+// bit of the first byte of c2 refers to the first byte of audio.
+func c2ErrorFrames(bad []bool, c2 []byte) {
+	for i := range bad {
+		// each frame spans 4 bytes, so half of one C2 byte
+		bits := c2[i/2]
+		if i%2 == 0 {
+			bits >>= 4
+		}
+		bad[i] = bits&0x0F != 0
+	}
+}
+
+// concealer conceals errors in audio read in pieces, as if it had been
+// read in one. The zero value is ready to use at the start of a read.
+type concealer struct {
+	prev   Frame   // the last good frame
+	open   []Frame // a run of errors at the end of the frames so far, held back
+	muting bool    // whether the frames so far end in a muted run
+}
+
+// add conceals the errors in frames, which follow the frames added
+// before, according to mode. It returns the frames that are done,
+// starting with any held back, and the ranges concealed relative to
+// the first of them. A run of errors at the end of frames is held back
+// until a good frame follows it, unless it's going to be muted anyway.
+func (c *concealer) add(frames []Frame, bad []bool, mode Concealment) ([]Frame, []SampleRange) {
+	f := append(c.open, frames...)
+	b := make([]bool, len(c.open), len(f))
+	for i := range b {
+		b[i] = true
+	}
+	b = append(b, bad...)
+	ranges, open := c.conceal(f, b, mode, false)
+	done := f[:len(f)-open]
+	c.open = slices.Clone(f[len(done):])
+	return done, ranges
+}
+
+// flush conceals the run of errors held back, if any, as if nothing
+// followed it, and returns it.
+func (c *concealer) flush() ([]Frame, []SampleRange) {
+	f := c.open
+	c.open = nil
+	b := make([]bool, len(f))
+	for i := range b {
+		b[i] = true
+	}
+	ranges, _ := c.conceal(f, b, ConcealInterpolate, true)
+	return f, ranges
+}
+
+// conceal replaces the frames marked bad according to mode and returns
+// the concealed ranges, relative to the start of frames.
+//
+// Errors at the start are interpolated from the last good frame before
+// frames. A run of errors at the end has no following good frame yet:
+// unless final, or the run is to be muted, it's left as it is and its
+// length returned so that it can be concealed with the frames after it.
+// If final, it fades to silence.
+func (c *concealer) conceal(frames []Frame, bad []bool, mode Concealment, final bool) (ranges []SampleRange, open int) {
+	for i := 0; i < len(frames); {
+		if !bad[i] {
+			c.prev = frames[i]
+			c.muting = false
+			i++
+			continue
+		}
+		start := i
+		for i < len(frames) && bad[i] {
+			i++
+		}
+		run := frames[start:i]
+		mute := mode != ConcealInterpolate || len(run) > MaxInterpolateSamples ||
+			(start == 0 && c.muting)
+		if i == len(frames) && !final && !mute {
+			return ranges, len(run)
+		}
+		ranges = append(ranges, SampleRange{Start: int64(start), Length: len(run)})
+
+		if mute {
+			clear(run)
+			c.prev = Frame{}
+			// a run muted at the end stays muted if it goes on
+			c.muting = i == len(frames)
+			continue
+		}
+		var next Frame
+		if i < len(frames) {
+			next = frames[i]
+		}
+		prev := c.prev
+		for j := range run {
+			t := float64(j+1) / float64(len(run)+1)
+			run[j] = Frame{
+				L: int16(float64(prev.L) + t*(float64(next.L)-float64(prev.L))),
+				R: int16(float64(prev.R) + t*(float64(next.R)-float64(prev.R))),
+			}
+		}
+	}
+	return ranges, 0
+}
@@ -0,0 +1,152 @@
+package audiocd
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestC2ErrorFrames(t *testing.T) {
+	c2 := make([]byte, C2BytesPerSector)
+	c2[0] = 0x80 // first byte of frame 0
+	c2[1] = 0x01 // last byte of frame 3
+	c2[5] = 0x30 // bytes 2 and 3 of frame 10
+	c2[C2BytesPerSector-1] = 0x08
+
+	bad := make([]bool, SamplesPerSector)
+	c2ErrorFrames(bad, c2)
+
+	var frames []int
+	for i, b := range bad {
+		if b {
+			frames = append(frames, i)
+		}
+	}
+	assert.Equal(t, []int{0, 3, 10, SamplesPerSector - 1}, frames)
+}
+
+func TestConcealInterpolate(t *testing.T) {
+	frames := []Frame{{100, -100}, {0, 0}, {0, 0}, {0, 0}, {500, -500}, {600, -600}}
+	bad := []bool{false, true, true, true, false, false}
+	c := concealer{}
+
+	ranges, open := c.conceal(frames, bad, ConcealInterpolate, false)
+	assert.Equal(t, []SampleRange{{Start: 1, Length: 3}}, ranges)
+	assert.Zero(t, open)
+	assert.Equal(t, []Frame{{100, -100}, {200, -200}, {300, -300}, {400, -400}, {500, -500}, {600, -600}}, frames)
+	assert.Equal(t, Frame{600, -600}, c.prev)
+
+	// errors at the start interpolate from the previous frames,
+	// errors at the end are left open
+	frames = []Frame{{1, 1}, {2000, 2000}, {0, 0}, {9, 9}}
+	bad = []bool{true, false, true, true}
+	ranges, open = c.conceal(frames, bad, ConcealInterpolate, false)
+	assert.Equal(t, []SampleRange{{0, 1}}, ranges)
+	assert.Equal(t, 2, open)
+	assert.Equal(t, Frame{1300, 700}, frames[0])
+	assert.Equal(t, []Frame{{0, 0}, {9, 9}}, frames[2:])
+
+	// unless final, when they fade out
+	ranges, open = c.conceal(frames[2:], bad[2:], ConcealInterpolate, true)
+	assert.Equal(t, []SampleRange{{0, 2}}, ranges)
+	assert.Zero(t, open)
+	assert.Equal(t, []Frame{{1333, 1333}, {666, 666}}, frames[2:])
+
+	// full scale values don't overflow
+	frames = []Frame{{32767, -32768}, {0, 0}, {-32768, 32767}}
+	bad = []bool{false, true, false}
+	c.conceal(frames, bad, ConcealInterpolate, true)
+	assert.Equal(t, Frame{0, 0}, frames[1])
+}
+
+func TestConcealMute(t *testing.T) {
+	frames := []Frame{{100, 100}, {200, 200}, {300, 300}}
+	bad := []bool{false, true, false}
+	c := concealer{}
+
+	ranges, _ := c.conceal(frames, bad, ConcealMute, false)
+	assert.Equal(t, []SampleRange{{1, 1}}, ranges)
+	assert.Equal(t, []Frame{{100, 100}, {}, {300, 300}}, frames)
+
+	// long runs are muted even when interpolating
+	frames = make([]Frame, MaxInterpolateSamples+3)
+	bad = make([]bool, len(frames))
+	for i := range frames {
+		frames[i] = Frame{1000, 1000}
+		bad[i] = i > 0 && i < len(frames)-1
+	}
+	ranges, _ = c.conceal(frames, bad, ConcealInterpolate, false)
+	assert.Equal(t, []SampleRange{{1, MaxInterpolateSamples + 1}}, ranges)
+	assert.Equal(t, Frame{}, frames[1])
+	assert.Equal(t, Frame{}, frames[MaxInterpolateSamples+1])
+	assert.Equal(t, Frame{1000, 1000}, frames[len(frames)-1])
+}
+
+// concealPieces conceals frames added in pieces of the given size.
+func concealPieces(frames []Frame, bad []bool, size int) ([]Frame, []SampleRange) {
+	var c concealer
+	var out []Frame
+	var ranges []SampleRange
+	done := func(f []Frame, r []SampleRange) {
+		for _, r := range r {
+			r.Start += int64(len(out))
+			ranges = append(ranges, r)
+		}
+		out = append(out, f...)
+	}
+	for i := 0; i < len(frames); i += size {
+		end := min(i+size, len(frames))
+		done(c.add(slices.Clone(frames[i:end]), bad[i:end], ConcealInterpolate))
+	}
+	done(c.flush())
+	return out, ranges
+}
+
+func TestConcealPieces(t *testing.T) {
+	frames := make([]Frame, 4*SamplesPerSector)
+	bad := make([]bool, len(frames))
+	for i := range frames {
+		frames[i] = Frame{int16(i), int16(-i)}
+	}
+	// a short run, a long run, a run across a sector boundary
+	// and one at the very end
+	for _, r := range []SampleRange{{10, 5}, {100, MaxInterpolateSamples + 50}, {2*SamplesPerSector - 7, 20}, {int64(len(frames)) - 3, 3}} {
+		for i := r.Start; i < r.End(); i++ {
+			bad[i] = true
+			frames[i] = Frame{9999, 9999}
+		}
+	}
+
+	whole, wholeRanges := concealPieces(frames, bad, len(frames))
+	require.Len(t, whole, len(frames))
+	assert.Equal(t, Frame{int16(2*SamplesPerSector - 8), int16(-2*SamplesPerSector + 8)}, whole[2*SamplesPerSector-8])
+	assert.NotEqual(t, Frame{}, whole[2*SamplesPerSector-1], "runs across pieces are interpolated, not faded")
+	for _, size := range []int{1, 7, SamplesPerSector, 3 * SamplesPerSector} {
+		f, r := concealPieces(frames, bad, size)
+		assert.Equal(t, whole, f, "pieces of %v", size)
+		assert.Equal(t, mergeRanges(wholeRanges), mergeRanges(r), "pieces of %v", size)
+	}
+}
+
+func mergeRanges(ranges []SampleRange) []SampleRange {
+	cd := AudioCD{}
+	cd.addConcealed(ranges)
+	return cd.Concealed()
+}
+
+func TestConcealedRanges(t *testing.T) {
+	cd := AudioCD{}
+	cd.addConcealed([]SampleRange{{10, 5}, {15, 2}, {30, 1}})
+	cd.addConcealed([]SampleRange{{31, 4}})
+
+	assert.Equal(t, []SampleRange{{10, 7}, {30, 5}}, cd.Concealed())
+	assert.Nil(t, cd.Concealed())
+	assert.Equal(t, int64(35), SampleRange{30, 5}.End())
+}
+
+func TestReadCDCDB(t *testing.T) {
+	cdb := readCDCDB(0x012345, 24)
+	assert.Equal(t, []byte{0xBE, 0x04, 0x00, 0x01, 0x23, 0x45, 0x00, 0x00, 24, 0x12, 0x00, 0x00}, cdb)
+}
@@ -0,0 +1,204 @@
+package audiocd
+
+import (
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// CacheDefeat selects how audiocd prevents a drive's internal audio
+// cache from serving paranoia's verification re-reads. Without it,
+// re-reads of a bad sector return the same bad data from the cache and
+// paranoia can't detect the error.
+type CacheDefeat int
+
+const (
+	// CacheDefeatNone (the default) never attempts to defeat the cache.
+	CacheDefeatNone CacheDefeat = 0
+	// CacheDefeatAuto probes the drive with [AudioCD.DetectAudioCache]
+	// on Open and defeats the cache by seeking if the drive is found to
+	// cache audio. The probe takes a few seconds and moves the drive's
+	// head, so its result is remembered for each device, and it only
+	// runs the first time a device is opened.
+	CacheDefeatAuto CacheDefeat = 1
+	// CacheDefeatSeek reads far away from the target before verification
+	// re-reads, evicting a cache of [AudioCD.CacheSectors] sectors.
+	CacheDefeatSeek CacheDefeat = 2
+	// CacheDefeatFUA sends a zero-length READ(10) with the Force Unit
+	// Access bit before every read, which invalidates the cache on drives
+	// that support it. This adds one command per read but avoids seeking.
+	CacheDefeatFUA CacheDefeat = 3
+)
+
+// DefaultCacheSectors is the cache size assumed when defeating a cache
+// whose size could not be measured. It matches the cdparanoia default
+// and covers the caches of most drives.
+const DefaultCacheSectors = 1200
+
+// cacheProbeSizes are the candidate cache sizes, in sectors, tried
+// when measuring the size of a drive's cache.
+var cacheProbeSizes = []int{16, 32, 64, 128, 256, 512, 1024, 2048, 4096}
+
+// cacheProbeTrials is the number of times each timing is measured.
+const cacheProbeTrials = 3
+
+// audioCaches remembers the results of cache probes by device.
+var audioCaches sync.Map // of string to AudioCache
+
+// AudioCache describes the audio caching behavior of a drive,
+// as reported by [AudioCD.DetectAudioCache].
+type AudioCache struct {
+	Cached  bool // re-reads of recently read sectors are served from a cache
+	Sectors int  // approximate size of the cache in sectors, if Cached
+}
+
+// DetectAudioCache determines whether the drive caches audio data.
+//
+// If the drive reports its read cache as disabled, it is trusted.
+// Otherwise this uses a timing-based probe: it reads a range of sectors
+// and compares the time to read them again with the time taken to
+// read them the first time. It then reads increasing amounts of data
+// after the range to find the point at which the range is evicted.
+//
+// The probe reads directly from the drive, bypassing paranoia, so the
+// read position is not affected. It moves the drive's read head and
+// takes a few seconds.
+func (cd *AudioCD) DetectAudioCache() (AudioCache, error) {
+	if !cd.IsOpen() {
+		return AudioCache{}, os.ErrClosed
+	}
+	// trust drives that report their read cache as disabled
+	var caps DriveCapabilities
+	buf := make([]byte, 0xFF)
+	if n, err := scsiCommand(cd, modeSenseCDB(modePageCaching, len(buf)), buf); err == nil {
+		if caps.decodeCachingPage(buf[:n]) == nil && !caps.ReadCache {
+			return AudioCache{}, nil
+		}
+	}
+
+	toc := cd.TOC()
+	if len(toc) == 0 {
+		return AudioCache{}, ErrNoAudioTracks
+	}
+	start := toc[0].StartSector
+	end := cd.LengthSectors()
+	// probe near the middle of the disc, far away from the far-read target
+	probe := start + (end-start)/4
+	far := start + (end-start)*3/4
+
+	const n = 8 // sectors per timed read
+	timeRead := func(sector, sectors int) (time.Duration, error) {
+		start := time.Now()
+		err := readRaw(cd, sector, sectors)
+		return time.Since(start), err
+	}
+	measure := func(gap int) (cold, warm time.Duration, err error) {
+		var colds, warms []time.Duration
+		for range cacheProbeTrials {
+			if _, err := timeRead(far, 1); err != nil {
+				return 0, 0, err
+			}
+			c, err := timeRead(probe, n)
+			if err != nil {
+				return 0, 0, err
+			}
+			if gap > 0 {
+				if _, err := timeRead(probe+n, gap); err != nil {
+					return 0, 0, err
+				}
+			}
+			w, err := timeRead(probe, n)
+			if err != nil {
+				return 0, 0, err
+			}
+			colds = append(colds, c)
+			warms = append(warms, w)
+		}
+		return median(colds), median(warms), nil
+	}
+
+	cold, warm, err := measure(0)
+	if err != nil {
+		return AudioCache{}, err
+	}
+	if !isCacheHit(cold, warm) {
+		return AudioCache{}, nil
+	}
+
+	// if the range is never evicted, assume at least the largest probed size
+	size := DefaultCacheSectors
+	for _, gap := range cacheProbeSizes {
+		if probe+n+gap >= end {
+			break
+		}
+		cold, warm, err := measure(gap)
+		if err != nil {
+			return AudioCache{}, err
+		}
+		if !isCacheHit(cold, warm) {
+			return AudioCache{Cached: true, Sectors: gap + n}, nil
+		}
+		size = max(size, gap+n)
+	}
+	return AudioCache{Cached: true, Sectors: size}, nil
+}
+
+// isCacheHit reports whether a re-read was served from a cache,
+// given the time taken for the first read and the re-read.
+//
+// A cached read completes in a fraction of the time of a read
+// from the disc, which must wait for the disc to rotate to
+// the target and spin up if it has slowed down.
+func isCacheHit(cold, warm time.Duration) bool {
+	return warm*4 < cold
+}
+
+func median(d []time.Duration) time.Duration {
+	if len(d) == 0 {
+		return 0
+	}
+	s := slices.Clone(d)
+	slices.Sort(s)
+	return s[len(s)/2]
+}
+
+// configureCacheDefeat applies CacheDefeat, probing the drive if needed.
+// If the probe fails, the cache is assumed to exist.
+func (cd *AudioCD) configureCacheDefeat() error {
+	mode := cd.CacheDefeat
+	sectors := cd.CacheSectors
+	if mode == CacheDefeatAuto {
+		var cache AudioCache
+		if c, ok := audioCaches.Load(cd.Device); ok {
+			cache = c.(AudioCache)
+		} else if c, err := cd.DetectAudioCache(); err == nil {
+			cache = c
+			audioCaches.Store(cd.Device, cache)
+		} else {
+			cache = AudioCache{Cached: true, Sectors: DefaultCacheSectors}
+		}
+		mode = CacheDefeatNone
+		if cache.Cached {
+			mode = CacheDefeatSeek
+			if sectors == 0 {
+				sectors = cache.Sectors
+			}
+		}
+	}
+	if sectors <= 0 {
+		sectors = DefaultCacheSectors
+	}
+
+	switch mode {
+	case CacheDefeatSeek:
+		setCacheModel(cd, sectors)
+		return setFUA(cd, false)
+	case CacheDefeatFUA:
+		setCacheModel(cd, 0)
+		return setFUA(cd, true)
+	default:
+		setCacheModel(cd, 0)
+		return setFUA(cd, false)
+	}
+}
@@ -0,0 +1,53 @@
+package audiocd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsCacheHit(t *testing.T) {
+	// a re-read from the drive's buffer takes well under a millisecond,
+	// while a read from the disc waits on rotation and seeking
+	assert.True(t, isCacheHit(40*time.Millisecond, 500*time.Microsecond))
+	assert.True(t, isCacheHit(8*time.Millisecond, time.Millisecond))
+	assert.False(t, isCacheHit(40*time.Millisecond, 35*time.Millisecond))
+	assert.False(t, isCacheHit(10*time.Millisecond, 10*time.Millisecond))
+	assert.False(t, isCacheHit(0, 0))
+}
+
+func TestMedian(t *testing.T) {
+	assert.Equal(t, time.Duration(0), median(nil))
+	assert.Equal(t, 5*time.Millisecond, median([]time.Duration{9 * time.Millisecond, 1 * time.Millisecond, 5 * time.Millisecond}))
+
+	// outliers, e.g. from the drive spinning up, are ignored
+	d := []time.Duration{2 * time.Millisecond, 900 * time.Millisecond, 3 * time.Millisecond}
+	assert.Equal(t, 3*time.Millisecond, median(d))
+	assert.Equal(t, 900*time.Millisecond, d[1], "input is not modified")
+}
+
+func TestCacheDefeatModes(t *testing.T) {
+	for _, mode := range []CacheDefeat{CacheDefeatAuto, CacheDefeatNone, CacheDefeatSeek, CacheDefeatFUA} {
+		cd := AudioCD{CacheDefeat: mode}
+		err := cd.Open()
+		failIfErr(t, err)
+
+		buf := make([]byte, BytesPerSector)
+		_, err = cd.Read(buf)
+		assert.NoError(t, err)
+		assert.NoError(t, cd.Close())
+	}
+}
+
+func TestCacheDefeatAutoRemembered(t *testing.T) {
+	assert.Equal(t, CacheDefeatNone, AudioCD{}.CacheDefeat)
+
+	const device = "/dev/probed"
+	audioCaches.Delete(device)
+	cd := AudioCD{Device: device, CacheDefeat: CacheDefeatAuto}
+	failIfErr(t, cd.Open())
+	assert.NoError(t, cd.Close())
+	_, ok := audioCaches.Load(device)
+	assert.True(t, ok, "probe result is remembered")
+}
@@ -0,0 +1,242 @@
+package audiocd
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+// MMC command opcodes and page/feature codes used for capability probing.
+//
+// For details, see the SCSI Multimedia Commands (MMC-3) specification,
+// sections 5 (features) and 6.3.11 (mode page 2Ah).
+const (
+	cmdGetConfiguration = 0x46
+	cmdModeSense10      = 0x5A
+
+	modePageCaching      = 0x08
+	modePageCapabilities = 0x2A
+
+	featureCDRead = 0x001E
+)
+
+// SpeedKBps1x is the data rate of 1x audio playback in kB/s, as used
+// by the MMC speed fields (1 kB = 1000 bytes).
+const SpeedKBps1x = 176
+
+// Feature is a raw MMC feature descriptor reported by GET CONFIGURATION.
+type Feature struct {
+	Code       uint16
+	Version    byte
+	Persistent bool
+	Current    bool   // the feature is usable with the current medium
+	Data       []byte // feature dependent data, without the 4-byte header
+}
+
+// DriveCapabilities describes optional drive features relevant
+// to audio extraction. It is reported by [AudioCD.Capabilities].
+//
+// Drives are not required to implement either GET CONFIGURATION or mode
+// page 2Ah, so fields default to false/zero when unreported.
+type DriveCapabilities struct {
+	CurrentProfile uint16    // the MMC profile of the medium, e.g. 0x0008 for CD-ROM
+	Features       []Feature // every feature descriptor the drive reported
+
+	AudioCommands  bool // drive supports READ CD for audio sectors
+	AccurateStream bool // audio reads can restart at an exact position without jitter
+	C2Pointers     bool // drive can report C2 error pointers per sample
+	CDText         bool // drive can read CD-TEXT from the lead-in
+	ReadCache      bool // the read cache is enabled, so re-reads may be served from memory
+
+	SubchannelRW          bool // drive can return raw R-W subchannel data
+	SubchannelRWCorrected bool // R-W subchannel data is de-interleaved and corrected
+	ISRC                  bool // drive can read the ISRC from the Q subchannel
+	UPC                   bool // drive can read the media catalog number from the Q subchannel
+
+	MaxReadSpeed     int // maximum read speed in kB/s
+	CurrentReadSpeed int // current read speed in kB/s
+	BufferSize       int // size of the drive's buffer in KiB
+
+	// Speeds the drive supports in kB/s, as listed by the speed
+	// descriptors of mode page 2Ah, usually fastest first. MMC-3 lists
+	// them as write speeds, so drives that can't write, and drives older
+	// than MMC-3, report none.
+	SupportedSpeeds []int
+}
+
+// HasFeature reports whether the drive reported the given feature code.
+func (c DriveCapabilities) HasFeature(code uint16) bool {
+	for _, f := range c.Features {
+		if f.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// MaxSpeed returns the maximum read speed as a multiple of real-time
+// playback, suitable for [AudioCD.SetSpeed].
+func (c DriveCapabilities) MaxSpeed() int {
+	return c.MaxReadSpeed / SpeedKBps1x
+}
+
+// Capabilities probes the drive for optional features using the MMC
+// GET CONFIGURATION and MODE SENSE commands. These are not available
+// through cdparanoia, so they are sent to the device directly.
+//
+// Commands the drive does not support are ignored; an error is only
+// returned if no information could be retrieved.
+func (cd *AudioCD) Capabilities() (DriveCapabilities, error) {
+	var caps DriveCapabilities
+	if !cd.IsOpen() {
+		return caps, os.ErrClosed
+	}
+
+	var errs []error
+	buf := make([]byte, 0xFFF8)
+	n, err := scsiCommand(cd, getConfigurationCDB(len(buf)), buf)
+	if err == nil {
+		err = caps.decodeConfiguration(buf[:n])
+	}
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	// room for the longest page, with its speed descriptors
+	n, err = scsiCommand(cd, modeSenseCDB(modePageCapabilities, 0x200), buf[:0x200])
+	if err == nil {
+		err = caps.decodeCapabilitiesPage(buf[:n])
+	}
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	n, err = scsiCommand(cd, modeSenseCDB(modePageCaching, 0xFF), buf[:0xFF])
+	if err == nil {
+		err = caps.decodeCachingPage(buf[:n])
+	}
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	if len(errs) == 3 {
+		return caps, errs[0]
+	}
+	return caps, nil
+}
+
+func getConfigurationCDB(alloc int) []byte {
+	cdb := make([]byte, 10)
+	cdb[0] = cmdGetConfiguration
+	cdb[1] = 0x00 // RT: all features
+	binary.BigEndian.PutUint16(cdb[7:], uint16(alloc))
+	return cdb
+}
+
+func modeSenseCDB(page byte, alloc int) []byte {
+	cdb := make([]byte, 10)
+	cdb[0] = cmdModeSense10
+	cdb[1] = 0x08        // DBD: no block descriptors
+	cdb[2] = page & 0x3F // PC 0: current values
+	binary.BigEndian.PutUint16(cdb[7:], uint16(alloc))
+	return cdb
+}
+
+// decodeConfiguration parses the response to GET CONFIGURATION.
+func (c *DriveCapabilities) decodeConfiguration(b []byte) error {
+	if len(b) < 8 {
+		return fmt.Errorf("audiocd: configuration response too short")
+	}
+	length := int(binary.BigEndian.Uint32(b[0:])) + 4
+	if length < len(b) {
+		b = b[:length]
+	}
+	c.CurrentProfile = binary.BigEndian.Uint16(b[6:])
+
+	for d := b[8:]; len(d) >= 4; {
+		n := int(d[3]) + 4
+		if n > len(d) {
+			return fmt.Errorf("audiocd: truncated feature descriptor %04Xh", binary.BigEndian.Uint16(d))
+		}
+		f := Feature{
+			Code:       binary.BigEndian.Uint16(d),
+			Version:    (d[2] >> 2) & 0x0F,
+			Persistent: d[2]&0x02 != 0,
+			Current:    d[2]&0x01 != 0,
+			Data:       append([]byte(nil), d[4:n]...),
+		}
+		c.Features = append(c.Features, f)
+
+		if f.Code == featureCDRead && len(f.Data) > 0 {
+			c.CDText = c.CDText || f.Data[0]&0x01 != 0
+			c.C2Pointers = c.C2Pointers || f.Data[0]&0x02 != 0
+		}
+		d = d[n:]
+	}
+	return nil
+}
+
+// modePage locates a mode page in a MODE SENSE(10) response.
+func modePage(b []byte, page byte) ([]byte, error) {
+	if len(b) < 8 {
+		return nil, fmt.Errorf("audiocd: mode sense response too short")
+	}
+	blockDescLen := int(binary.BigEndian.Uint16(b[6:]))
+	p := b[min(8+blockDescLen, len(b)):]
+	if len(p) < 2 || p[0]&0x3F != page {
+		return nil, fmt.Errorf("audiocd: mode page %02Xh not returned", page)
+	}
+	n := int(p[1]) + 2
+	if n > len(p) {
+		n = len(p)
+	}
+	return p[:n], nil
+}
+
+// decodeCapabilitiesPage parses the MODE SENSE(10) response for
+// the CD/DVD Capabilities and Mechanical Status page (2Ah).
+func (c *DriveCapabilities) decodeCapabilitiesPage(b []byte) error {
+	p, err := modePage(b, modePageCapabilities)
+	if err != nil {
+		return err
+	}
+	if len(p) < 16 {
+		return fmt.Errorf("audiocd: mode page 2Ah too short")
+	}
+
+	c.AudioCommands = p[5]&0x01 != 0
+	c.AccurateStream = p[5]&0x02 != 0
+	c.SubchannelRW = p[5]&0x04 != 0
+	c.SubchannelRWCorrected = p[5]&0x08 != 0
+	c.C2Pointers = c.C2Pointers || p[5]&0x10 != 0
+	c.ISRC = p[5]&0x20 != 0
+	c.UPC = p[5]&0x40 != 0
+
+	c.MaxReadSpeed = int(binary.BigEndian.Uint16(p[8:]))
+	c.BufferSize = int(binary.BigEndian.Uint16(p[12:]))
+	c.CurrentReadSpeed = int(binary.BigEndian.Uint16(p[14:]))
+
+	// MMC-3 pages end with a table of 4-byte speed descriptors
+	c.SupportedSpeeds = nil
+	if len(p) >= 32 {
+		count := int(binary.BigEndian.Uint16(p[30:]))
+		for d := p[32:]; count > 0 && len(d) >= 4; count, d = count-1, d[4:] {
+			c.SupportedSpeeds = append(c.SupportedSpeeds, int(binary.BigEndian.Uint16(d[2:])))
+		}
+	}
+	return nil
+}
+
+// decodeCachingPage parses the MODE SENSE(10) response for
+// the Caching page (08h).
+func (c *DriveCapabilities) decodeCachingPage(b []byte) error {
+	p, err := modePage(b, modePageCaching)
+	if err != nil {
+		return err
+	}
+	if len(p) < 3 {
+		return fmt.Errorf("audiocd: mode page 08h too short")
+	}
+	c.ReadCache = p[2]&0x01 == 0 // RCD: read cache disable
+	return nil
+}
@@ -0,0 +1,202 @@
+package audiocd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Responses below follow the layout returned by real drives. Only the
+// fields and descriptors relevant to audio extraction are included.
+
+// GET CONFIGURATION from a slim laptop DVD/CDRW drive with a CD-ROM
+// inserted: profile list, core, morphing, removable medium, random
+// readable, multi-read, CD read (CD-TEXT, C2, DAP), real time streaming.
+var configLaptopDrive = []byte{
+	0x00, 0x00, 0x00, 0x4C, 0x00, 0x00, 0x00, 0x08,
+	// 0000h profile list
+	0x00, 0x00, 0x03, 0x10,
+	0x00, 0x10, 0x00, 0x00, 0x00, 0x0A, 0x00, 0x00,
+	0x00, 0x09, 0x00, 0x00, 0x00, 0x08, 0x01, 0x00,
+	// 0001h core
+	0x00, 0x01, 0x0B, 0x08, 0x00, 0x00, 0x00, 0x02, 0x01, 0x00, 0x00, 0x00,
+	// 0003h removable medium
+	0x00, 0x03, 0x03, 0x04, 0x29, 0x00, 0x00, 0x02,
+	// 0010h random readable
+	0x00, 0x10, 0x01, 0x08, 0x00, 0x00, 0x08, 0x00, 0x00, 0x01, 0x01, 0x00,
+	// 001Dh multi-read
+	0x00, 0x1D, 0x01, 0x00,
+	// 001Eh CD read: DAP | C2 | CD-Text
+	0x00, 0x1E, 0x09, 0x04, 0x83, 0x00, 0x00, 0x00,
+	// 0107h real time streaming
+	0x01, 0x07, 0x11, 0x04, 0x00, 0x00, 0x00, 0x00,
+}
+
+// GET CONFIGURATION from a cheap USB drive that reports CD read
+// without C2 or CD-TEXT support, and a descriptor for a feature
+// this package doesn't know about.
+var configUSBDrive = []byte{
+	0x00, 0x00, 0x00, 0x1C, 0x00, 0x00, 0x00, 0x08,
+	// 0001h core
+	0x00, 0x01, 0x03, 0x04, 0x00, 0x00, 0x00, 0x08,
+	// 001Eh CD read, no flags
+	0x00, 0x1E, 0x09, 0x04, 0x00, 0x00, 0x00, 0x00,
+	// FF00h vendor specific
+	0xFF, 0x00, 0x00, 0x04, 0xDE, 0xAD, 0xBE, 0xEF,
+}
+
+// MODE SENSE(10) page 2Ah from the laptop drive: 24x, 2 MiB buffer,
+// accurate stream, C2 pointers, R-W, ISRC and UPC.
+var capsPageLaptopDrive = []byte{
+	0x00, 0x22, 0x70, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x2A, 0x1A, 0x3F, 0x00, 0x71, 0x7F, 0x29, 0x23,
+	0x10, 0x8A, 0x01, 0x00, 0x08, 0x00, 0x10, 0x8A,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00,
+}
+
+// MODE SENSE(10) page 2Ah from the USB drive, with a block descriptor
+// despite DBD and an older 20-byte page: 8x, 128 KiB buffer, CD-DA
+// commands only.
+var capsPageUSBDrive = []byte{
+	0x00, 0x24, 0x70, 0x00, 0x00, 0x00, 0x00, 0x08,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x08, 0x00,
+	0x2A, 0x14, 0x03, 0x00, 0x01, 0x01, 0x29, 0x23,
+	0x05, 0x84, 0x00, 0x00, 0x00, 0x80, 0x02, 0xC2,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+}
+
+// MODE SENSE(10) page 2Ah from a desktop DVD writer, an MMC-3 page
+// listing speed descriptors for 48x, 40x, 32x, 24x and 16x, the last
+// with CAV rotation control.
+var capsPageDesktopDrive = []byte{
+	0x00, 0x3A, 0x70, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x2A, 0x32, 0x3F, 0x37, 0xF1, 0x77, 0x29, 0x23,
+	0x21, 0x13, 0x01, 0x00, 0x08, 0x00, 0x21, 0x13,
+	0x00, 0x10, 0x21, 0x13, 0x21, 0x13, 0x00, 0x01,
+	0x00, 0x00, 0x00, 0x00, 0x21, 0x13, 0x00, 0x05,
+	0x00, 0x00, 0x21, 0x13,
+	0x00, 0x00, 0x1B, 0x90,
+	0x00, 0x00, 0x16, 0x0D,
+	0x00, 0x00, 0x10, 0x8A,
+	0x00, 0x01, 0x0B, 0x06,
+}
+
+// MODE SENSE(10) page 08h with and without the read cache disabled.
+var cachingPageEnabled = []byte{
+	0x00, 0x12, 0x70, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x08, 0x0A, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+}
+
+var cachingPageDisabled = []byte{
+	0x00, 0x12, 0x70, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x08, 0x0A, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+}
+
+func TestDecodeConfiguration(t *testing.T) {
+	var caps DriveCapabilities
+	err := caps.decodeConfiguration(configLaptopDrive)
+	assert.NoError(t, err)
+
+	assert.Equal(t, uint16(0x0008), caps.CurrentProfile)
+	assert.Len(t, caps.Features, 7)
+	assert.True(t, caps.HasFeature(0x001E))
+	assert.True(t, caps.HasFeature(0x0107))
+	assert.False(t, caps.HasFeature(0x0020))
+	assert.True(t, caps.C2Pointers)
+	assert.True(t, caps.CDText)
+
+	f := caps.Features[1]
+	assert.Equal(t, uint16(0x0001), f.Code)
+	assert.Equal(t, byte(2), f.Version)
+	assert.True(t, f.Persistent)
+	assert.True(t, f.Current)
+	assert.Len(t, f.Data, 8)
+
+	caps = DriveCapabilities{}
+	err = caps.decodeConfiguration(configUSBDrive)
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(0x0008), caps.CurrentProfile)
+	assert.Len(t, caps.Features, 3)
+	assert.False(t, caps.C2Pointers)
+	assert.False(t, caps.CDText)
+	assert.Equal(t, []byte{0xDE, 0xAD, 0xBE, 0xEF}, caps.Features[2].Data)
+
+	// truncated responses
+	assert.Error(t, caps.decodeConfiguration(configUSBDrive[:4]))
+	assert.Error(t, caps.decodeConfiguration(configUSBDrive[:len(configUSBDrive)-2]))
+}
+
+func TestDecodeCapabilitiesPage(t *testing.T) {
+	var caps DriveCapabilities
+	err := caps.decodeCapabilitiesPage(capsPageLaptopDrive)
+	assert.NoError(t, err)
+
+	assert.True(t, caps.AudioCommands)
+	assert.True(t, caps.AccurateStream)
+	assert.True(t, caps.C2Pointers)
+	assert.True(t, caps.SubchannelRW)
+	assert.True(t, caps.SubchannelRWCorrected)
+	assert.True(t, caps.ISRC)
+	assert.True(t, caps.UPC)
+	assert.Equal(t, 4234, caps.MaxReadSpeed)
+	assert.Equal(t, 24, caps.MaxSpeed())
+	assert.Equal(t, 2048, caps.BufferSize)
+	assert.Equal(t, 4234, caps.CurrentReadSpeed)
+	assert.Empty(t, caps.SupportedSpeeds)
+
+	caps = DriveCapabilities{}
+	err = caps.decodeCapabilitiesPage(capsPageDesktopDrive)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 8467, caps.MaxReadSpeed)
+	assert.Equal(t, 48, caps.MaxSpeed())
+	assert.Equal(t, []int{8467, 7056, 5645, 4234, 2822}, caps.SupportedSpeeds)
+	// descriptors past the end of a truncated response are dropped
+	err = caps.decodeCapabilitiesPage(capsPageDesktopDrive[:len(capsPageDesktopDrive)-6])
+	assert.NoError(t, err)
+	assert.Equal(t, []int{8467, 7056, 5645}, caps.SupportedSpeeds)
+
+	caps = DriveCapabilities{}
+	err = caps.decodeCapabilitiesPage(capsPageUSBDrive)
+	assert.NoError(t, err)
+
+	assert.True(t, caps.AudioCommands)
+	assert.False(t, caps.AccurateStream)
+	assert.False(t, caps.C2Pointers)
+	assert.False(t, caps.SubchannelRW)
+	assert.False(t, caps.ISRC)
+	assert.Equal(t, 1412, caps.MaxReadSpeed)
+	assert.Equal(t, 8, caps.MaxSpeed())
+	assert.Equal(t, 128, caps.BufferSize)
+	assert.Equal(t, 706, caps.CurrentReadSpeed)
+	assert.Empty(t, caps.SupportedSpeeds)
+
+	// wrong page
+	assert.Error(t, caps.decodeCapabilitiesPage(cachingPageEnabled))
+	assert.Error(t, caps.decodeCapabilitiesPage(capsPageLaptopDrive[:12]))
+}
+
+func TestDecodeCachingPage(t *testing.T) {
+	var caps DriveCapabilities
+	assert.NoError(t, caps.decodeCachingPage(cachingPageEnabled))
+	assert.True(t, caps.ReadCache)
+
+	assert.NoError(t, caps.decodeCachingPage(cachingPageDisabled))
+	assert.False(t, caps.ReadCache)
+
+	assert.Error(t, caps.decodeCachingPage(capsPageUSBDrive))
+}
+
+func TestDecodeSense(t *testing.T) {
+	fixed := []byte{0x70, 0x00, 0x05, 0x00, 0x00, 0x00, 0x00, 0x0A, 0x00, 0x00, 0x00, 0x00, 0x20, 0x00}
+	err := decodeSense(fixed)
+	assert.Equal(t, SenseError{Key: 0x05, ASC: 0x20, ASCQ: 0x00}, err)
+	assert.True(t, err.IsIllegalRequest())
+
+	desc := []byte{0x72, 0x03, 0x11, 0x05}
+	err = decodeSense(desc)
+	assert.Equal(t, SenseError{Key: 0x03, ASC: 0x11, ASCQ: 0x05}, err)
+	assert.False(t, err.IsIllegalRequest())
+	assert.Contains(t, err.Error(), "11h/05h")
+}
@@ -5,9 +5,13 @@ package audiocd
 // TODO: should we link statically instead??
 
 // #cgo LDFLAGS: -lcdda_interface -lcdda_paranoia
+// #include <pthread.h>
 // #include <stdint.h>
 // #include <stdlib.h>
+// #include <string.h>
+// #include <sys/ioctl.h>
 // #include <linux/major.h>
+// #include <scsi/sg.h>
 // #include <cdda_interface.h>
 // #include <cdda_paranoia.h>
 //
@@ -17,6 +21,86 @@ package audiocd
 // int bridge_set_speed(set_speed_fn f, struct cdrom_drive *d, int speed) {
 //   return f(d, speed);
 // }
+//
+// /* Send a raw SCSI command that reads data from the device.
+//    Returns the number of bytes transferred, -1 if the ioctl
+//    failed or -2 if the drive reported an error in sense. */
+// int bridge_sg_io(int fd, unsigned char *cdb, int cdblen, unsigned char *buf, int buflen,
+//                  unsigned char *sense, int senselen) {
+//   struct sg_io_hdr hdr;
+//   memset(&hdr, 0, sizeof(hdr));
+//   hdr.interface_id = 'S';
+//   hdr.dxfer_direction = buflen > 0 ? SG_DXFER_FROM_DEV : SG_DXFER_NONE;
+//   hdr.cmd_len = cdblen;
+//   hdr.cmdp = cdb;
+//   hdr.dxfer_len = buflen;
+//   hdr.dxferp = buf;
+//   hdr.mx_sb_len = senselen;
+//   hdr.sbp = sense;
+//   hdr.timeout = 30000;
+//   if (ioctl(fd, SG_IO, &hdr) < 0) return -1;
+//   if ((hdr.info & SG_INFO_OK_MASK) != SG_INFO_OK) return -2;
+//   return buflen - hdr.resid;
+// }
+//
+// int drive_fd(struct cdrom_drive *d) {
+//   return d->ioctl_fd >= 0 ? d->ioctl_fd : d->cdda_fd;
+// }
+//
+// /* Force Unit Access cache defeat: wrap the drive's read function
+//    to invalidate the cache before every read. The original function
+//    is kept in a small table since cdrom_drive has nowhere to store it.
+//    The table is shared by every drive, so it's guarded by a lock. */
+// typedef long (*read_audio_fn)(struct cdrom_drive *d, void *p, long begin, long sectors);
+// #define MAX_FUA_DRIVES 8
+// static struct { struct cdrom_drive *d; read_audio_fn fn; } fua_drives[MAX_FUA_DRIVES];
+// static pthread_mutex_t fua_lock = PTHREAD_MUTEX_INITIALIZER;
+//
+// static long fua_read_audio(struct cdrom_drive *d, void *p, long begin, long sectors) {
+//   read_audio_fn fn = NULL;
+//   pthread_mutex_lock(&fua_lock);
+//   for (int i = 0; i < MAX_FUA_DRIVES; i++) {
+//     if (fua_drives[i].d == d) {
+//       fn = fua_drives[i].fn;
+//       break;
+//     }
+//   }
+//   pthread_mutex_unlock(&fua_lock);
+//   if (fn == NULL) return -1;
+//   /* READ(10), FUA, transfer length 0 */
+//   unsigned char cdb[10] = {0x28, 0x08, begin >> 24, begin >> 16, begin >> 8, begin, 0, 0, 0, 0};
+//   unsigned char sense[32];
+//   bridge_sg_io(drive_fd(d), cdb, sizeof(cdb), NULL, 0, sense, sizeof(sense));
+//   return fn(d, p, begin, sectors);
+// }
+//
+// int bridge_set_fua(struct cdrom_drive *d, int enable) {
+//   int res = enable ? -1 : 0;
+//   pthread_mutex_lock(&fua_lock);
+//   for (int i = 0; i < MAX_FUA_DRIVES; i++) {
+//     if (fua_drives[i].d == d) {
+//       if (!enable) {
+//         d->read_audio = fua_drives[i].fn;
+//         fua_drives[i].d = NULL;
+//       }
+//       res = 0;
+//       goto done;
+//     }
+//   }
+//   if (!enable) goto done;
+//   for (int i = 0; i < MAX_FUA_DRIVES; i++) {
+//     if (fua_drives[i].d == NULL) {
+//       fua_drives[i].d = d;
+//       fua_drives[i].fn = d->read_audio;
+//       d->read_audio = fua_read_audio;
+//       res = 0;
+//       break;
+//     }
+//   }
+// done:
+//   pthread_mutex_unlock(&fua_lock);
+//   return res;
+// }
 import "C"
 
 import (
@@ -199,7 +283,52 @@ func readLimited(cd *AudioCD, p []byte, retries int) error {
 	return nil
 }
 
+func scsiCommand(cd *AudioCD, cdb []byte, buf []byte) (int, error) {
+	if len(buf) == 0 {
+		return 0, nil
+	}
+	sense := make([]byte, 32)
+	res := C.bridge_sg_io(C.drive_fd((*C.cdrom_drive)(cd.drive)),
+		(*C.uchar)(unsafe.Pointer(&cdb[0])), C.int(len(cdb)),
+		(*C.uchar)(unsafe.Pointer(&buf[0])), C.int(len(buf)),
+		(*C.uchar)(unsafe.Pointer(&sense[0])), C.int(len(sense)))
+	switch res {
+	case -1:
+		return 0, ErrOperationNotSupported
+	case -2:
+		return 0, decodeSense(sense)
+	}
+	return int(res), nil
+}
+
+func readRaw(cd *AudioCD, sector, sectors int) error {
+	defer flushLogs(cd)
+	buf := C.malloc(C.size_t(sectors * BytesPerSector))
+	defer C.free(buf)
+	res := int64(C.cdda_read((*C.cdrom_drive)(cd.drive), buf, C.long(sector), C.long(sectors)))
+	if res < 0 {
+		return AudioCDError(-1 * res)
+	}
+	return nil
+}
+
+func setCacheModel(cd *AudioCD, sectors int) {
+	C.paranoia_cachemodel_size(cd.paranoia, C.int(sectors))
+}
+
+func setFUA(cd *AudioCD, enable bool) error {
+	e := 0
+	if enable {
+		e = 1
+	}
+	if C.bridge_set_fua((*C.cdrom_drive)(cd.drive), C.int(e)) != 0 {
+		return fmt.Errorf("audiocd: too many drives using FUA cache defeat")
+	}
+	return nil
+}
+
 func closeDrive(d unsafe.Pointer) {
+	C.bridge_set_fua((*C.cdrom_drive)(d), 0)
 	C.cdda_close((*C.cdrom_drive)(d))
 }
 
@@ -3,8 +3,9 @@
 package audiocd
 
 import (
-	"crypto/rand"
+	"encoding/binary"
 	"fmt"
+	"math/rand/v2"
 	"os"
 	"unsafe"
 )
@@ -13,9 +14,13 @@ func init() {
 	fmt.Fprintln(os.Stderr, "NOTE: audiocd is only supported on linux. You are operating on a mock implementation for testing which returns white noise.")
 }
 
+// mockDrive is the state of a mock drive.
+type mockDrive struct {
+	sector int // the sector read next
+}
+
 func openDrive(cd *AudioCD) error {
-	// pretend to be open by keeping a pointer to self
-	cd.drive = unsafe.Pointer(cd)
+	cd.drive = unsafe.Pointer(&mockDrive{})
 	return nil
 }
 
@@ -70,14 +75,35 @@ func setSpeed(cd *AudioCD, x int) error {
 }
 
 func seekSector(cd *AudioCD, sector int) error {
+	(*mockDrive)(cd.drive).sector = sector
 	return nil
 }
 
 func readLimited(cd *AudioCD, p []byte, retries int) error {
-	_, err := rand.Read(p)
+	// the noise is the same whenever a sector is read, so that seeking
+	// can be tested
+	d := (*mockDrive)(cd.drive)
+	var seed [32]byte
+	binary.LittleEndian.PutUint64(seed[:], uint64(d.sector))
+	d.sector++
+	_, err := rand.NewChaCha8(seed).Read(p)
 	return err
 }
 
+func scsiCommand(cd *AudioCD, cdb []byte, buf []byte) (int, error) {
+	return 0, ErrOperationNotSupported
+}
+
+func readRaw(cd *AudioCD, sector, sectors int) error {
+	return nil
+}
+
+func setCacheModel(cd *AudioCD, sectors int) {}
+
+func setFUA(cd *AudioCD, enable bool) error {
+	return nil
+}
+
 func closeDrive(d unsafe.Pointer) {}
 
 func paranoiaFree(p unsafe.Pointer) {}
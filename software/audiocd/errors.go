@@ -78,3 +78,38 @@ func (pe AudioCDError) name() string {
 		return fmt.Sprintf("unknown error code: %v", int(pe))
 	}
 }
+
+// SenseError is returned when the drive rejects a command sent directly
+// to the device, e.g. by [AudioCD.Capabilities]. It holds the sense key
+// and additional sense code reported by the drive.
+type SenseError struct {
+	Key  byte // sense key, e.g. 0x05 for ILLEGAL REQUEST
+	ASC  byte // additional sense code
+	ASCQ byte // additional sense code qualifier
+}
+
+func (e SenseError) Error() string {
+	return fmt.Sprintf("audiocd: command failed: sense key %Xh, ASC/ASCQ %02Xh/%02Xh", e.Key, e.ASC, e.ASCQ)
+}
+
+// IsIllegalRequest reports whether the drive rejected the command
+// as unsupported or malformed.
+func (e SenseError) IsIllegalRequest() bool {
+	return e.Key == 0x05
+}
+
+// decodeSense parses fixed or descriptor format sense data.
+func decodeSense(b []byte) SenseError {
+	if len(b) < 4 {
+		return SenseError{}
+	}
+	switch b[0] & 0x7F {
+	case 0x72, 0x73: // descriptor format
+		return SenseError{Key: b[1] & 0x0F, ASC: b[2], ASCQ: b[3]}
+	default: // fixed format
+		if len(b) < 14 {
+			return SenseError{Key: b[2] & 0x0F}
+		}
+		return SenseError{Key: b[2] & 0x0F, ASC: b[12], ASCQ: b[13]}
+	}
+}
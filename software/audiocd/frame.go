@@ -0,0 +1,146 @@
+package audiocd
+
+import (
+	"encoding/binary"
+	"fmt"
+	"iter"
+)
+
+// Frame is a single stereo sample: one signed 16-bit sample
+// for each channel.
+//
+// Note that this is a sample frame, not a Redbook frame
+// (which is equivalent to a [Sector]).
+type Frame struct {
+	L, R int16
+}
+
+// Sector is the audio contained in one sector of CD data.
+type Sector [SamplesPerSector]Frame
+
+// sampleScale maps the full int16 range onto [-1, 1).
+const sampleScale = 1 << (BitsPerSample - 1)
+
+// Float32 returns the samples scaled to the range [-1, 1).
+func (f Frame) Float32() (l, r float32) {
+	return float32(f.L) / sampleScale, float32(f.R) / sampleScale
+}
+
+// Float64 returns the samples scaled to the range [-1, 1).
+func (f Frame) Float64() (l, r float64) {
+	return float64(f.L) / sampleScale, float64(f.R) / sampleScale
+}
+
+// FrameFromFloat64 converts samples in the range [-1, 1] into a Frame,
+// clipping values outside the range. It is the inverse of [Frame.Float64].
+func FrameFromFloat64(l, r float64) Frame {
+	return Frame{L: floatToSample(l), R: floatToSample(r)}
+}
+
+func floatToSample(v float64) int16 {
+	v *= sampleScale
+	if v >= sampleScale-1 {
+		return sampleScale - 1
+	}
+	if v <= -sampleScale {
+		return -sampleScale
+	}
+	return int16(v)
+}
+
+// DecodeFrames decodes host byte order PCM data, as returned by
+// [AudioCD.Read], into dst. It returns the number of frames decoded,
+// which is the smaller of len(dst) and len(p)/[BytesPerSampleFrame].
+func DecodeFrames(dst []Frame, p []byte) int {
+	n := min(len(dst), len(p)/BytesPerSampleFrame)
+	for i := range n {
+		b := p[i*BytesPerSampleFrame:]
+		dst[i].L = int16(binary.NativeEndian.Uint16(b[0:]))
+		dst[i].R = int16(binary.NativeEndian.Uint16(b[BytesPerSample:]))
+	}
+	return n
+}
+
+// EncodeFrames is the inverse of [DecodeFrames], writing frames into p
+// in host byte order. It returns the number of frames encoded.
+func EncodeFrames(p []byte, src []Frame) int {
+	n := min(len(src), len(p)/BytesPerSampleFrame)
+	for i := range n {
+		b := p[i*BytesPerSampleFrame:]
+		binary.NativeEndian.PutUint16(b[0:], uint16(src[i].L))
+		binary.NativeEndian.PutUint16(b[BytesPerSample:], uint16(src[i].R))
+	}
+	return n
+}
+
+// ReadFrames reads decoded audio from the current position into p.
+// It returns the number of frames read. The position must be aligned
+// to a frame, e.g. by using [AudioCD.SeekSample].
+func (cd *AudioCD) ReadFrames(p []Frame) (n int, err error) {
+	if cd.trueOffset%BytesPerSampleFrame != 0 {
+		return 0, fmt.Errorf("audiocd: position not aligned to a sample frame")
+	}
+	buf := make([]byte, len(p)*BytesPerSampleFrame)
+	read := 0
+	for read < len(buf) {
+		nn, err := cd.Read(buf[read:])
+		read += nn
+		if err != nil {
+			return DecodeFrames(p, buf[:read]), err
+		}
+	}
+	return DecodeFrames(p, buf), nil
+}
+
+// Sectors returns an iterator over the decoded audio of the sectors
+// in [start, end), keyed by sector index. The iterator seeks the
+// drive to start, so the read position is changed as a side effect.
+//
+// Iteration stops early if reading fails; the error can be
+// retrieved with [AudioCD.Err].
+func (cd *AudioCD) Sectors(start, end int) iter.Seq2[int, Sector] {
+	return func(yield func(int, Sector) bool) {
+		cd.err = nil
+		if _, err := cd.SeekToSector(start); err != nil {
+			cd.err = err
+			return
+		}
+		buf := make([]byte, BytesPerSector)
+		for i := start; i < end; i++ {
+			read := 0
+			for read < len(buf) {
+				n, err := cd.Read(buf[read:])
+				read += n
+				if err != nil {
+					cd.err = err
+					return
+				}
+			}
+			var s Sector
+			DecodeFrames(s[:], buf)
+			if !yield(i, s) {
+				return
+			}
+		}
+	}
+}
+
+// Frames returns an iterator over every frame of the sectors in
+// [start, end). See [AudioCD.Sectors].
+func (cd *AudioCD) Frames(start, end int) iter.Seq[Frame] {
+	return func(yield func(Frame) bool) {
+		for _, s := range cd.Sectors(start, end) {
+			for _, f := range s {
+				if !yield(f) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Err returns the error, if any, that stopped the most recent
+// iteration of [AudioCD.Sectors] or [AudioCD.Frames].
+func (cd *AudioCD) Err() error {
+	return cd.err
+}
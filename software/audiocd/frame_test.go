@@ -0,0 +1,79 @@
+package audiocd
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeFrames(t *testing.T) {
+	p := make([]byte, 3*BytesPerSampleFrame)
+	for i, v := range []int16{1, -1, 0x1234, -0x1234, 32767, -32768} {
+		binary.NativeEndian.PutUint16(p[i*BytesPerSample:], uint16(v))
+	}
+
+	frames := make([]Frame, 4)
+	n := DecodeFrames(frames, p)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, []Frame{{1, -1}, {0x1234, -0x1234}, {32767, -32768}, {}}, frames)
+
+	// partial frames are ignored
+	assert.Equal(t, 2, DecodeFrames(frames, p[:2*BytesPerSampleFrame+2]))
+	assert.Equal(t, 1, DecodeFrames(frames[:1], p))
+
+	out := make([]byte, len(p))
+	assert.Equal(t, 3, EncodeFrames(out, frames))
+	assert.Equal(t, p, out)
+}
+
+func TestFrameScaling(t *testing.T) {
+	l, r := Frame{L: -32768, R: 0}.Float64()
+	assert.Equal(t, -1.0, l)
+	assert.Equal(t, 0.0, r)
+
+	l, r = Frame{L: 16384, R: -16384}.Float64()
+	assert.Equal(t, 0.5, l)
+	assert.Equal(t, -0.5, r)
+
+	l32, r32 := Frame{L: 32767, R: 1}.Float32()
+	assert.Less(t, l32, float32(1))
+	assert.Greater(t, r32, float32(0))
+
+	for _, f := range []Frame{{0, 0}, {1, -1}, {12345, -12345}, {32767, -32768}} {
+		assert.Equal(t, f, FrameFromFloat64(f.Float64()))
+	}
+	assert.Equal(t, Frame{32767, -32768}, FrameFromFloat64(2, -2))
+}
+
+func TestSectorIterator(t *testing.T) {
+	cd := AudioCD{}
+	err := cd.Open()
+	failIfErr(t, err)
+	defer cd.Close()
+
+	var sectors []int
+	for i, s := range cd.Sectors(10, 15) {
+		sectors = append(sectors, i)
+		assert.Len(t, s, SamplesPerSector)
+	}
+	failIfErr(t, cd.Err())
+	assert.Equal(t, []int{10, 11, 12, 13, 14}, sectors)
+
+	// stopping early leaves the drive positioned after the last sector read
+	for i := range cd.Sectors(20, 30) {
+		if i == 21 {
+			break
+		}
+	}
+	pos, err := cd.Seek(0, 1)
+	failIfErr(t, err)
+	assert.Equal(t, int64(22*BytesPerSector), pos)
+
+	n := 0
+	for range cd.Frames(0, 2) {
+		n++
+	}
+	failIfErr(t, cd.Err())
+	assert.Equal(t, 2*SamplesPerSector, n)
+}
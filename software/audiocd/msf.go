@@ -0,0 +1,37 @@
+package audiocd
+
+import (
+	"io"
+
+	"github.com/rabidaudio/cdz-nuts/audiocd/redbook"
+)
+
+// MSF is a Redbook timecode in minutes, seconds and frames; see
+// [redbook.MSF].
+type MSF = redbook.MSF
+
+// MSFFromSectors converts a sector count into a timecode.
+func MSFFromSectors(sectors int) MSF { return redbook.MSFFromSectors(sectors) }
+
+// MSFFromLBA converts a logical block address into the absolute disc time.
+func MSFFromLBA(lba int) MSF { return redbook.MSFFromLBA(lba) }
+
+// MSFFromSamples converts a number of samples per channel into a timecode.
+func MSFFromSamples(samples int64) MSF { return redbook.MSFFromSamples(samples) }
+
+// ParseMSF parses a timecode of the form MM:SS:FF.
+func ParseMSF(s string) (MSF, error) { return redbook.ParseMSF(s) }
+
+// SeekSample seeks to the given sample (counted per channel) from
+// the start of the disk. Unlike [AudioCD.SeekToSector], this allows
+// positioning within a sector.
+func (cd *AudioCD) SeekSample(sample int64) (int64, error) {
+	return cd.Seek(sample*BytesPerSampleFrame, io.SeekStart)
+}
+
+// SeekMSF seeks to the given time from the start of the disk. The
+// timecode is treated as a duration, so 00:00:00 is sector 0. To seek
+// to an absolute disc address, use [AudioCD.SeekToSector] with [MSF.LBA].
+func (cd *AudioCD) SeekMSF(m MSF) (int64, error) {
+	return cd.SeekToSector(m.Sectors())
+}
@@ -0,0 +1,33 @@
+package audiocd
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeekSampleBackAndForth(t *testing.T) {
+	cd := AudioCD{}
+	failIfErr(t, cd.Open())
+	defer cd.Close()
+	read := func(sample int64) []byte {
+		t.Helper()
+		_, err := cd.SeekSample(sample)
+		failIfErr(t, err)
+		p := make([]byte, 64)
+		_, err = io.ReadFull(&cd, p)
+		failIfErr(t, err)
+		return p
+	}
+	target := int64(5*SamplesPerSector + 7)
+	want := read(target)
+
+	// buffer past the target, then seek back before it and forward
+	// to it again, which must not be served from the old buffer
+	read(0)
+	_, err := io.ReadFull(&cd, make([]byte, 20*BytesPerSector))
+	failIfErr(t, err)
+	read(2 * SamplesPerSector)
+	assert.Equal(t, want, read(target))
+}
@@ -0,0 +1,116 @@
+package redbook
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// LeadInSectors is the number of sectors between the absolute time
+// reported in the subchannel (and used by TOC dumps) and logical block
+// address 0. The first track of a disc conventionally starts at
+// 00:02:00, which is LBA 0.
+const LeadInSectors = 2 * SectorsPerSecond
+
+// SamplesPerSector is the number of samples per channel contained
+// in one sector of audio (588).
+const SamplesPerSector = SampleRate / SectorsPerSecond
+
+// BytesPerSampleFrame is the number of bytes used by one sample
+// of every channel (4).
+const BytesPerSampleFrame = Channels * BytesPerSample
+
+// MSF is a Redbook timecode in minutes, seconds and frames, where a
+// frame is 1/75th of a second and equivalent to one sector.
+//
+// An MSF can either describe a duration (e.g. a track length or a cue
+// sheet INDEX, which is relative to the start of the file) or an absolute
+// disc address, which includes the [LeadInSectors] offset. Use
+// [MSFFromSectors] and [MSF.Sectors] for the former and [MSFFromLBA]
+// and [MSF.LBA] for the latter.
+type MSF struct {
+	Minutes int
+	Seconds int // 0 <= Seconds < 60
+	Frames  int // 0 <= Frames < 75
+}
+
+// MSFFromSectors converts a sector count into a timecode.
+// Negative counts are clamped to zero.
+func MSFFromSectors(sectors int) MSF {
+	if sectors < 0 {
+		sectors = 0
+	}
+	return MSF{
+		Minutes: sectors / (60 * SectorsPerSecond),
+		Seconds: (sectors / SectorsPerSecond) % 60,
+		Frames:  sectors % SectorsPerSecond,
+	}
+}
+
+// MSFFromLBA converts a logical block address into the absolute
+// disc time, including the lead-in offset. LBA 0 is 00:02:00.
+func MSFFromLBA(lba int) MSF {
+	return MSFFromSectors(lba + LeadInSectors)
+}
+
+// MSFFromSamples converts a number of samples per channel into a
+// timecode, rounding down to the containing sector.
+func MSFFromSamples(samples int64) MSF {
+	return MSFFromSectors(int(samples / SamplesPerSector))
+}
+
+// ParseMSF parses a timecode of the form MM:SS:FF, as used by
+// cue sheets and TOC dumps. Minutes may exceed two digits.
+func ParseMSF(s string) (MSF, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return MSF{}, fmt.Errorf("redbook: invalid timecode %q: expected MM:SS:FF", s)
+	}
+	var v [3]int
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 || strings.HasPrefix(p, "+") {
+			return MSF{}, fmt.Errorf("redbook: invalid timecode %q", s)
+		}
+		v[i] = n
+	}
+	m := MSF{Minutes: v[0], Seconds: v[1], Frames: v[2]}
+	if !m.IsValid() {
+		return MSF{}, fmt.Errorf("redbook: invalid timecode %q: out of range", s)
+	}
+	return m, nil
+}
+
+// IsValid reports whether each field of the timecode is within range.
+func (m MSF) IsValid() bool {
+	return m.Minutes >= 0 &&
+		m.Seconds >= 0 && m.Seconds < 60 &&
+		m.Frames >= 0 && m.Frames < SectorsPerSecond
+}
+
+// String formats the timecode as MM:SS:FF.
+func (m MSF) String() string {
+	return fmt.Sprintf("%02d:%02d:%02d", m.Minutes, m.Seconds, m.Frames)
+}
+
+// Sectors returns the number of sectors the timecode spans.
+func (m MSF) Sectors() int {
+	return (m.Minutes*60+m.Seconds)*SectorsPerSecond + m.Frames
+}
+
+// LBA returns the logical block address of an absolute disc time,
+// removing the lead-in offset. Times before 00:02:00 return
+// negative addresses.
+func (m MSF) LBA() int {
+	return m.Sectors() - LeadInSectors
+}
+
+// Samples returns the number of samples per channel the timecode spans.
+func (m MSF) Samples() int64 {
+	return int64(m.Sectors()) * SamplesPerSector
+}
+
+// Bytes returns the number of bytes of PCM data the timecode spans.
+func (m MSF) Bytes() int64 {
+	return int64(m.Sectors()) * BytesPerSector
+}
@@ -0,0 +1,59 @@
+package redbook
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMSF(t *testing.T) {
+	m, err := ParseMSF("03:15:42")
+	assert.NoError(t, err)
+	assert.Equal(t, MSF{Minutes: 3, Seconds: 15, Frames: 42}, m)
+
+	m, err = ParseMSF("102:00:00")
+	assert.NoError(t, err)
+	assert.Equal(t, 102, m.Minutes)
+
+	for _, s := range []string{"", "00:00", "1:2:3:4", "00:60:00", "00:00:75", "-1:00:00", "aa:00:00", "00:+1:00"} {
+		_, err := ParseMSF(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestMSFString(t *testing.T) {
+	assert.Equal(t, "00:02:00", MSFFromLBA(0).String())
+	assert.Equal(t, "03:15:42", MSF{3, 15, 42}.String())
+	assert.Equal(t, "102:00:01", MSF{102, 0, 1}.String())
+}
+
+func TestMSFSectors(t *testing.T) {
+	for _, n := range []int{0, 1, 74, 75, 4499, 4500, 44988, 56891} {
+		m := MSFFromSectors(n)
+		assert.True(t, m.IsValid())
+		assert.Equal(t, n, m.Sectors())
+		assert.Equal(t, n, MSFFromLBA(n).LBA())
+
+		p, err := ParseMSF(m.String())
+		assert.NoError(t, err)
+		assert.Equal(t, m, p)
+	}
+
+	assert.Equal(t, MSF{0, 0, 0}, MSFFromSectors(-5))
+	assert.Equal(t, MSF{0, 0, 0}, MSFFromLBA(-LeadInSectors))
+	assert.Equal(t, -LeadInSectors, MSF{}.LBA())
+	assert.Equal(t, MSF{10, 1, 63}, MSFFromLBA(44988))
+}
+
+func TestMSFSamples(t *testing.T) {
+	assert.Equal(t, 588, SamplesPerSector)
+	assert.Equal(t, BytesPerSector, SamplesPerSector*BytesPerSampleFrame)
+
+	m := MSF{Minutes: 1}
+	assert.Equal(t, int64(60*SampleRate), m.Samples())
+	assert.Equal(t, int64(60*SampleRate*BytesPerSampleFrame), m.Bytes())
+
+	assert.Equal(t, MSF{0, 1, 0}, MSFFromSamples(SampleRate))
+	assert.Equal(t, MSF{0, 0, 1}, MSFFromSamples(SamplesPerSector+1))
+	assert.Equal(t, MSF{0, 0, 0}, MSFFromSamples(SamplesPerSector-1))
+}
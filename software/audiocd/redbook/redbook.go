@@ -0,0 +1,46 @@
+// Package redbook holds the units and timecodes of the Red Book
+// standard for audio CDs (CD-DA). Unlike audiocd, which re-exports it,
+// it's pure Go, so packages which only deal in CD audio don't need cgo.
+package redbook
+
+// SampleRate is the number of samples per second. All Redbook audio
+// CDs use at 44.1KHz.
+const SampleRate = 44100
+
+// Samples are signed 16-bit
+const BitsPerSample = 16
+const BytesPerSample = BitsPerSample / 8
+
+// Channels is the number of audio channels in the data. All Redbook
+// audio CDs are stereo.
+//
+// CDParanoia source code detects 4-cannel audio on bit 8 of table of contents
+// flags. [Wikipedia] notes that four-channel audio support was planned but never
+// implemented and no known drives support it.
+//
+// [Wikipedia]: https://en.wikipedia.org/wiki/Compact_Disc_Digital_Audio#Audio_format
+const Channels = 2
+
+// SectorsPerSecond is the number of audio frames in one second of audio.
+// An audio frame is the smallest valid unit of length for a track, defined
+// as 1/75th of a second. Redbook track offsets are specified in MM:SS:FF.
+//
+// Note that this definition of frame is interchangeable with sector.
+// It is distinct from a 33-byte channel data frame, which this package does
+// not concern itself with.
+//
+// For more information, see [Wikipedia].
+//
+// [Wikipedia]: https://en.wikipedia.org/wiki/Compact_Disc_Digital_Audio#Frames_and_timecode_frames
+const SectorsPerSecond = 75
+
+// SamplesPerFrame is the number of 16-bit audio samples per channel
+// that appear within one frame of data (294).
+const SamplesPerFrame = SampleRate / SectorsPerSecond / Channels
+
+// BytesPerSector is the number of bytes of audio contained in one sector of
+// CD data (and equivalently in one frame of samples), 2352 bytes.
+//
+// Sectors are the unit of interest when reading data from CDs. Drives read
+// data in units of sectors.
+const BytesPerSector = SampleRate * Channels * BytesPerSample / SectorsPerSecond
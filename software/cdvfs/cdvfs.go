@@ -0,0 +1,102 @@
+// Package cdvfs builds the CDs served by package vfs from audio CDs read
+// by package audiocd. It's separate from vfs so that vfs doesn't need
+// cgo.
+package cdvfs
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/rabidaudio/cdz-nuts/audiocd"
+	"github.com/rabidaudio/cdz-nuts/vfs"
+)
+
+// Disc is a source of CD audio with a table of contents, such as
+// an opened [audiocd.AudioCD]. Reads are in bytes from sector 0.
+type Disc interface {
+	io.ReadSeeker
+	TOC() []audiocd.TrackPosition
+}
+
+// FromAudioCD builds a CD from the table of contents of disc, which must
+// already be open. Each track reads its own range of the disc, seeking as
+// needed, so tracks can be read in any order. The tracks share a cache
+// of whole CD sectors, so the drive is only asked for each sector once
+// however the host's reads line up with it. Data tracks aren't served,
+// but are kept in DataTracks for the disc ID.
+//
+// The returned CD has no name or metadata; set them before loading it
+// to include them in the filesystem.
+func FromAudioCD(disc Disc) (vfs.CD, error) {
+	toc := disc.TOC()
+	if len(toc) == 0 {
+		return vfs.CD{}, fmt.Errorf("no tracks found on disc")
+	}
+
+	cache := newSectorCache(disc, sectorCacheSize, sectorReadAhead)
+	cd := vfs.CD{Tracks: make([]vfs.Track, 0, len(toc))}
+	for _, tp := range toc {
+		if !tp.IsAudio() {
+			cd.DataTracks = append(cd.DataTracks, vfs.Track{
+				StartSector:   tp.StartSector,
+				LengthSectors: tp.LengthSectors,
+			})
+			continue
+		}
+		cd.Tracks = append(cd.Tracks, vfs.Track{
+			ReadSeeker: &trackReader{
+				cache: cache,
+				start: int64(tp.StartSector) * audiocd.BytesPerSector,
+				size:  int64(tp.LengthSectors) * audiocd.BytesPerSector,
+			},
+			Filename:      fmt.Sprintf("Track %02d", tp.TrackNum),
+			LengthSectors: tp.LengthSectors,
+			StartSector:   tp.StartSector,
+		})
+	}
+	if len(cd.Tracks) == 0 {
+		return vfs.CD{}, fmt.Errorf("no audio tracks found on disc")
+	}
+	return cd, nil
+}
+
+// trackReader is a view of a single track of a disc.
+type trackReader struct {
+	cache  *sectorCache
+	start  int64 // offset of the track on the disc, in bytes
+	size   int64
+	offset int64 // read position within the track
+}
+
+func (t *trackReader) Read(p []byte) (int, error) {
+	if t.offset >= t.size {
+		return 0, io.EOF
+	}
+	p = p[:min(int64(len(p)), t.size-t.offset)]
+
+	end := int((t.start + t.size) / audiocd.BytesPerSector)
+	n, err := t.cache.readAt(p, t.start+t.offset, end)
+	t.offset += int64(n)
+	return n, err
+}
+
+func (t *trackReader) Seek(offset int64, whence int) (int64, error) {
+	var newOffset int64
+	switch whence {
+	case io.SeekCurrent:
+		newOffset = t.offset + offset
+	case io.SeekEnd:
+		newOffset = t.size + offset
+	default:
+		newOffset = offset
+	}
+	if newOffset < 0 {
+		return t.offset, fmt.Errorf("seek before start of track")
+	}
+	t.offset = newOffset
+	return newOffset, nil
+}
+
+// ensure interface conformation
+var _ Disc = (*audiocd.AudioCD)(nil)
+var _ io.ReadSeeker = (*trackReader)(nil)
@@ -0,0 +1,147 @@
+package cdvfs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/rabidaudio/cdz-nuts/audiocd"
+	"github.com/rabidaudio/cdz-nuts/vfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDisc is a disc whose data is a function of the byte offset
+type fakeDisc struct {
+	toc    []audiocd.TrackPosition
+	offset int64
+	// reads and sectors count the reads from the disc and the sectors
+	// read, and unaligned the reads that aren't of whole sectors
+	reads, sectors, unaligned int
+	err                       error // returned by reads if set
+}
+
+func discByte(off int64) byte {
+	return byte(off % 251)
+}
+
+func (d *fakeDisc) TOC() []audiocd.TrackPosition {
+	return d.toc
+}
+
+func (d *fakeDisc) Read(p []byte) (int, error) {
+	if d.err != nil {
+		return 0, d.err
+	}
+	d.reads++
+	d.sectors += len(p) / audiocd.BytesPerSector
+	if d.offset%audiocd.BytesPerSector != 0 || len(p)%audiocd.BytesPerSector != 0 {
+		d.unaligned++
+	}
+	for i := range p {
+		p[i] = discByte(d.offset + int64(i))
+	}
+	d.offset += int64(len(p))
+	return len(p), nil
+}
+
+func (d *fakeDisc) Seek(offset int64, whence int) (int64, error) {
+	if whence != io.SeekStart {
+		return d.offset, fmt.Errorf("unsupported whence")
+	}
+	d.offset = offset
+	return offset, nil
+}
+
+func newFakeDisc() *fakeDisc {
+	return &fakeDisc{toc: []audiocd.TrackPosition{
+		{TrackNum: 1, StartSector: 0, LengthSectors: 10},
+		{TrackNum: 2, StartSector: 10, LengthSectors: 7},
+		{TrackNum: 3, StartSector: 17, LengthSectors: 3},
+		{TrackNum: 4, StartSector: 20, LengthSectors: 100, Flags: 0x04}, // data
+	}}
+}
+
+func TestFromAudioCD(t *testing.T) {
+	cd, err := FromAudioCD(newFakeDisc())
+	assert.NoError(t, err)
+	assert.Len(t, cd.Tracks, 3)
+	assert.Equal(t, 10, cd.Tracks[0].LengthSectors)
+	assert.Equal(t, 7, cd.Tracks[1].LengthSectors)
+	assert.Equal(t, "Track 02", cd.Tracks[1].Filename)
+	assert.Equal(t, 10, cd.Tracks[1].StartSector)
+	// the data track isn't served but counts towards the disc ID
+	assert.Equal(t, []vfs.Track{{StartSector: 20, LengthSectors: 100}}, cd.DataTracks)
+
+	// tracks are scoped to their range of the disc, and can be
+	// read interleaved
+	t2 := cd.Tracks[1]
+	t1 := cd.Tracks[0]
+	p := make([]byte, 100)
+	_, err = io.ReadFull(t2, p)
+	assert.NoError(t, err)
+	assert.Equal(t, discByte(10*audiocd.BytesPerSector), p[0])
+	_, err = io.ReadFull(t1, p)
+	assert.NoError(t, err)
+	assert.Equal(t, discByte(0), p[0])
+	_, err = io.ReadFull(t2, p)
+	assert.NoError(t, err)
+	assert.Equal(t, discByte(10*audiocd.BytesPerSector+100), p[0])
+
+	data, err := io.ReadAll(cd.Tracks[2])
+	assert.NoError(t, err)
+	assert.Len(t, data, 3*audiocd.BytesPerSector)
+
+	_, err = t2.Seek(-1, io.SeekEnd)
+	assert.NoError(t, err)
+	n, err := t2.Read(p)
+	assert.Equal(t, 1, n)
+	assert.NoError(t, err)
+	assert.Equal(t, discByte(17*audiocd.BytesPerSector-1), p[0])
+	_, err = t2.Read(p)
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestFromAudioCDNoTracks(t *testing.T) {
+	_, err := FromAudioCD(&fakeDisc{})
+	assert.Error(t, err)
+
+	_, err = FromAudioCD(&fakeDisc{toc: []audiocd.TrackPosition{
+		{TrackNum: 1, LengthSectors: 10, Flags: 0x04},
+	}})
+	assert.Error(t, err)
+}
+
+// readFile reads a file of fsys through its block device, which is how
+// the host reads it.
+func readFile(t *testing.T, fsys *vfs.Filesystem, r vfs.TrackRange) []byte {
+	buf := make([]byte, r.Extent.Length())
+	require.NoError(t, fsys.ReadBlocks(context.Background(), r.Extent.LBA, buf))
+	return buf[:r.FileInfo.Size()]
+}
+
+func TestLoadAudioCD(t *testing.T) {
+	cd, err := FromAudioCD(newFakeDisc())
+	assert.NoError(t, err)
+
+	fsys, err := vfs.Create()
+	assert.NoError(t, err)
+	defer fsys.Close()
+	err = fsys.LoadCD(cd)
+	assert.NoError(t, err)
+
+	ranges, err := fsys.TrackRanges()
+	require.NoError(t, err)
+	require.Len(t, ranges, 3)
+	assert.Equal(t, "02.wav", ranges[1].FileInfo.Name())
+	data := readFile(t, fsys, ranges[1])
+	assert.Len(t, data, vfs.WavHeaderSize+7*audiocd.BytesPerSector)
+
+	expected := make([]byte, 7*audiocd.BytesPerSector)
+	for i := range expected {
+		expected[i] = discByte(10*audiocd.BytesPerSector + int64(i))
+	}
+	assert.True(t, bytes.Equal(expected, data[vfs.WavHeaderSize:]))
+}
@@ -0,0 +1,111 @@
+package cdvfs
+
+import (
+	"container/list"
+	"io"
+	"sync"
+
+	"github.com/rabidaudio/cdz-nuts/audiocd"
+)
+
+const (
+	// sectorCacheSize is the number of CD sectors kept for each disc,
+	// about 1.2MB.
+	sectorCacheSize = 512
+	// sectorReadAhead is the number of sectors read from the disc at once
+	// while the host reads sequentially, about half a second of audio.
+	sectorReadAhead = 38
+)
+
+// sectorCache reads a disc in whole CD sectors, which is how drives
+// deliver them, and keeps the most recently used. The host reads files
+// in 512 byte blocks which don't line up with CD sectors, so most
+// sectors are needed by several host reads.
+//
+// Sectors missing from the cache are read from the disc together, and
+// when the host reads sequentially, the following sectors are read
+// along with them. It's safe for concurrent use.
+type sectorCache struct {
+	mu        sync.Mutex
+	disc      Disc
+	capacity  int
+	readAhead int
+	sectors   map[int]*list.Element
+	lru       list.List // of *cachedSector, most recently used first
+	next      int       // the sector after the last read from the disc
+}
+
+type cachedSector struct {
+	n    int
+	data []byte
+}
+
+func newSectorCache(disc Disc, capacity, readAhead int) *sectorCache {
+	return &sectorCache{
+		disc:      disc,
+		capacity:  capacity,
+		readAhead: readAhead,
+		sectors:   make(map[int]*list.Element),
+		next:      -1,
+	}
+}
+
+// readAt fills p with the audio at byte offset off of the disc. Reading
+// ahead stops at the sector end, the end of the track.
+func (c *sectorCache) readAt(p []byte, off int64, end int) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	last := int((off + int64(len(p)) - 1) / audiocd.BytesPerSector)
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		data, err := c.sector(int(pos/audiocd.BytesPerSector), last, end)
+		if err != nil {
+			return n, err
+		}
+		n += copy(p[n:], data[pos%audiocd.BytesPerSector:])
+	}
+	return n, nil
+}
+
+// sector returns sector s of the disc. If it isn't cached, it's read
+// along with the following sectors up to last which aren't cached, or
+// further up to end if reading sequentially.
+func (c *sectorCache) sector(s, last, end int) ([]byte, error) {
+	if el, ok := c.sectors[s]; ok {
+		c.lru.MoveToFront(el)
+		return el.Value.(*cachedSector).data, nil
+	}
+
+	upto := last
+	if s == c.next {
+		upto = max(upto, s+c.readAhead-1)
+	}
+	upto = min(upto, end-1, s+c.capacity-1)
+	stop := s + 1
+	for stop <= upto && c.sectors[stop] == nil {
+		stop++
+	}
+
+	buf := make([]byte, (stop-s)*audiocd.BytesPerSector)
+	if _, err := c.disc.Seek(int64(s)*audiocd.BytesPerSector, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(c.disc, buf); err != nil {
+		return nil, err
+	}
+	c.next = stop
+	for i := s; i < stop; i++ {
+		c.add(i, buf[(i-s)*audiocd.BytesPerSector:][:audiocd.BytesPerSector])
+	}
+	return buf[:audiocd.BytesPerSector], nil
+}
+
+// add caches a sector, evicting the least recently used if full.
+func (c *sectorCache) add(n int, data []byte) {
+	c.sectors[n] = c.lru.PushFront(&cachedSector{n: n, data: data})
+	if c.lru.Len() > c.capacity {
+		old := c.lru.Remove(c.lru.Back()).(*cachedSector)
+		delete(c.sectors, old.n)
+	}
+}
@@ -0,0 +1,188 @@
+package cdvfs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/rabidaudio/cdz-nuts/audiocd"
+	"github.com/rabidaudio/cdz-nuts/vfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// loadFakeDisc loads a fake disc of longer tracks, returning the disc,
+// the range of each track file and its expected contents.
+func loadFakeDisc(t *testing.T) (*vfs.Filesystem, *fakeDisc, []vfs.TrackRange, [][]byte) {
+	toc := []audiocd.TrackPosition{
+		{TrackNum: 1, StartSector: 0, LengthSectors: 200},
+		{TrackNum: 2, StartSector: 200, LengthSectors: 151},
+		{TrackNum: 3, StartSector: 351, LengthSectors: 60},
+	}
+	load := func(disc *fakeDisc) (*vfs.Filesystem, []vfs.TrackRange) {
+		cd, err := FromAudioCD(disc)
+		require.NoError(t, err)
+		cd.Name = "Fake"
+		fsys, err := vfs.Create()
+		require.NoError(t, err)
+		require.NoError(t, fsys.LoadCD(cd))
+		ranges, err := fsys.TrackRanges()
+		require.NoError(t, err)
+		return fsys, ranges
+	}
+	disc := &fakeDisc{toc: toc}
+	fsys, ranges := load(disc)
+
+	// the headers are read from a copy, so that the disc isn't read yet
+	ref, refRanges := load(&fakeDisc{toc: toc})
+	defer ref.Close()
+	var files [][]byte
+	for i, r := range refRanges {
+		tp := toc[i]
+		size := int64(tp.LengthSectors) * audiocd.BytesPerSector
+		header := r.FileInfo.Size() - size
+		want := readFileBlocks(t, ref, r.Extent.LBA, 0, int(header)/vfs.SECTOR_SIZE+1)[:header]
+		for off := range size {
+			want = append(want, discByte(int64(tp.StartSector)*audiocd.BytesPerSector+off))
+		}
+		files = append(files, want)
+	}
+	return fsys, disc, ranges, files
+}
+
+// readFileBlocks reads count blocks of a file at block i.
+func readFileBlocks(t *testing.T, fsys *vfs.Filesystem, lba, i int64, count int) []byte {
+	buf := make([]byte, count*vfs.SECTOR_SIZE)
+	require.NoError(t, fsys.ReadBlocks(context.Background(), lba+i, buf))
+	return buf
+}
+
+// fileBlocks returns blocks of the expected contents of a file, padded
+// with zeros like the slack space after it.
+func fileBlocks(file []byte, i int64, count int) []byte {
+	b := make([]byte, count*vfs.SECTOR_SIZE)
+	if start := i * vfs.SECTOR_SIZE; start < int64(len(file)) {
+		copy(b, file[start:])
+	}
+	return b
+}
+
+func TestSectorCacheSequential(t *testing.T) {
+	fsys, disc, ranges, files := loadFakeDisc(t)
+	defer fsys.Close()
+
+	for ti, file := range files {
+		blocks := (int64(len(file)) + vfs.SECTOR_SIZE - 1) / vfs.SECTOR_SIZE
+		for i := int64(0); i < blocks; i++ {
+			got := readFileBlocks(t, fsys, ranges[ti].Extent.LBA, i, 1)
+			if !bytes.Equal(fileBlocks(file, i, 1), got) {
+				t.Fatalf("track %v block %v differs", ti+1, i)
+			}
+		}
+	}
+
+	// each sector was read from the disc once, in a few large reads
+	assert.Equal(t, 200+151+60, disc.sectors)
+	assert.LessOrEqual(t, disc.reads, 3*2+(200+151+60)/sectorReadAhead)
+	assert.Zero(t, disc.unaligned)
+}
+
+func TestSectorCacheRandom(t *testing.T) {
+	fsys, disc, ranges, files := loadFakeDisc(t)
+	defer fsys.Close()
+
+	rng := rand.New(rand.NewSource(1))
+	for range 2000 {
+		ti := rng.Intn(len(files))
+		blocks := (int64(len(files[ti])) + vfs.SECTOR_SIZE - 1) / vfs.SECTOR_SIZE
+		count := 1 + rng.Intn(16)
+		i := rng.Int63n(blocks - int64(count) + 1)
+		got := readFileBlocks(t, fsys, ranges[ti].Extent.LBA, i, count)
+		if !bytes.Equal(fileBlocks(files[ti], i, count), got) {
+			t.Fatalf("track %v blocks %v-%v differ", ti+1, i, i+int64(count)-1)
+		}
+	}
+
+	// the whole disc fits in the cache, so no sector is read twice
+	assert.LessOrEqual(t, disc.sectors, 200+151+60)
+	assert.Zero(t, disc.unaligned)
+}
+
+func TestSectorCacheLRU(t *testing.T) {
+	disc := newFakeDisc()
+	c := newSectorCache(disc, 4, 1)
+	read := func(sector int) {
+		p := make([]byte, 10)
+		off := int64(sector)*audiocd.BytesPerSector + 100
+		_, err := c.readAt(p, off, 20)
+		require.NoError(t, err)
+		for i, b := range p {
+			require.Equal(t, discByte(off+int64(i)), b)
+		}
+	}
+	reads := func(n int) {
+		t.Helper()
+		assert.Equal(t, n, disc.reads)
+	}
+
+	for s := range 4 {
+		read(s)
+	}
+	reads(4)
+	read(0)
+	reads(4)
+	read(5) // evicts 1, which is least recently used
+	reads(5)
+	read(0)
+	read(2)
+	reads(5)
+	read(1)
+	reads(6)
+	assert.Equal(t, 4, c.lru.Len())
+	assert.Len(t, c.sectors, 4)
+}
+
+func TestSectorCacheCoalesce(t *testing.T) {
+	disc := newFakeDisc()
+	c := newSectorCache(disc, 100, 4)
+	p := make([]byte, 3*audiocd.BytesPerSector)
+
+	// sectors missing from a read are read together
+	_, err := c.readAt(p[:audiocd.BytesPerSector], 3*audiocd.BytesPerSector, 10)
+	require.NoError(t, err)
+	_, err = c.readAt(p, audiocd.BytesPerSector+500, 10)
+	require.NoError(t, err)
+	for i, b := range p {
+		require.Equal(t, discByte(audiocd.BytesPerSector+500+int64(i)), b)
+	}
+	assert.Equal(t, 3, disc.reads) // sector 3, then 1-2, then 4
+	assert.Equal(t, 4, disc.sectors)
+
+	// sequential reads read ahead, but not past the end of the track
+	disc.reads, disc.sectors = 0, 0
+	_, err = c.readAt(p[:10], 5*audiocd.BytesPerSector, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 4, disc.sectors) // 5-8
+	_, err = c.readAt(p[:10], 9*audiocd.BytesPerSector, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 5, disc.sectors) // 9
+	assert.Equal(t, 2, disc.reads)
+	assert.Zero(t, disc.unaligned)
+}
+
+func TestSectorCacheError(t *testing.T) {
+	disc := newFakeDisc()
+	disc.err = fmt.Errorf("scratched")
+	c := newSectorCache(disc, 4, 1)
+	p := make([]byte, 10)
+	_, err := c.readAt(p, 0, 10)
+	assert.ErrorContains(t, err, "scratched")
+	assert.Empty(t, c.sectors)
+
+	disc.err = nil
+	_, err = c.readAt(p, 0, 10)
+	require.NoError(t, err)
+	assert.Equal(t, discByte(0), p[0])
+}
@@ -0,0 +1,102 @@
+// Command export writes the virtual disk for the audio CD in a drive to
+// an image file, such as to write onto a USB stick with dd, or to diff
+// with an image from an earlier version. With -time, the image is
+// reproducible: exporting the same CD again gives the same bytes.
+//
+//	export [-device /dev/cdrom] [-time 2025-08-01T12:00:00Z] out.img
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/rabidaudio/cdz-nuts/audiocd"
+	"github.com/rabidaudio/cdz-nuts/cdvfs"
+	"github.com/rabidaudio/cdz-nuts/vfs"
+)
+
+var profiles = map[string]vfs.Profile{}
+
+func init() {
+	for _, p := range []vfs.Profile{vfs.ProfileDefault, vfs.ProfileASCII, vfs.ProfileShortNames, vfs.ProfileMP3} {
+		profiles[p.Name] = p
+	}
+}
+
+func main() {
+	device := flag.String("device", "/dev/cdrom", "the CD drive")
+	created := flag.String("time", "", "the creation `time` of the image in RFC 3339 format, instead of now")
+	serial := flag.Uint("serial", 0, "the volume serial `number`, instead of the disc ID")
+	label := flag.String("label", "", "the volume label, instead of the CD's title")
+	profile := flag.String("profile", vfs.ProfileDefault.Name, "the `name` of the host profile")
+	name := flag.String("name", "Audio CD", "the name of the CD's directory")
+	fit := flag.Bool("fit", false, "make the disk as small as the CD allows")
+	whole := flag.Bool("whole", false, "serve the CD as a single WAV file with a cue sheet")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] out.img\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := export(flag.Arg(0), *device, *created, uint32(*serial), *label, *profile, *name, *fit, *whole); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func export(path, device, created string, serial uint32, label, profile, name string, fit, whole bool) error {
+	opts := vfs.Options{Serial: serial, Label: label}
+	if created != "" {
+		var err error
+		if opts.Time, err = time.Parse(time.RFC3339, created); err != nil {
+			return err
+		}
+	}
+	p, ok := profiles[profile]
+	if !ok {
+		return fmt.Errorf("unknown profile %q", profile)
+	}
+
+	disc := &audiocd.AudioCD{Device: device}
+	if err := disc.Open(); err != nil {
+		return err
+	}
+	defer disc.Close()
+	cd, err := cdvfs.FromAudioCD(disc)
+	if err != nil {
+		return err
+	}
+	cd.Name, cd.WholeDisc = name, whole
+
+	fsys, err := vfs.CreateWith(opts)
+	if err != nil {
+		return err
+	}
+	defer fsys.Close()
+	if err := fsys.SetProfile(p); err != nil {
+		return err
+	}
+	if err := fsys.LoadCD(cd); err != nil {
+		return err
+	}
+	if fit {
+		if err := fsys.Fit(); err != nil {
+			return err
+		}
+	}
+
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := fsys.Export(out); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
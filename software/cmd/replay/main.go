@@ -0,0 +1,49 @@
+// Command replay repeats the host reads recorded in a trace against a
+// virtual disk with the same CDs, to reproduce a host's access pattern
+// without the host. Traces are recorded with
+// [vfs.Filesystem.StartTrace].
+//
+//	replay [-realtime] trace.jsonl
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/rabidaudio/cdz-nuts/vfs"
+)
+
+func main() {
+	realtime := flag.Bool("realtime", false, "replay with the recorded delays between requests")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [-realtime] trace.jsonl\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	f, err := os.Open(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer f.Close()
+
+	stats, err := vfs.Replay(f, *realtime)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Printf("reads:       %d (%d bytes)\n", stats.Reads, stats.Bytes)
+	if stats.Reads > 0 {
+		n := time.Duration(stats.Reads)
+		fmt.Printf("latency:     %v mean, %v max\n", stats.Latency/n, stats.MaxLatency)
+		fmt.Printf("recorded:    %v mean\n", stats.Recorded/n)
+	}
+	fmt.Printf("mismatches:  %d\n", stats.Mismatches)
+}
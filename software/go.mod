@@ -5,6 +5,7 @@ go 1.24.6
 require (
 	github.com/diskfs/go-diskfs v1.6.0
 	github.com/faiface/beep v1.1.0
+	github.com/hajimehoshi/go-mp3 v0.3.0
 	github.com/stianeikeland/go-rpio/v4 v4.6.0
 	github.com/stretchr/testify v1.10.0
 )
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"io"
 	"time"
 
 	"github.com/faiface/beep"
@@ -34,27 +33,17 @@ func NewStreamer(cd audiocd.AudioCD) (*cdStreamer, error) {
 }
 
 func (s *cdStreamer) Stream(samples [][2]float64) (n int, ok bool) {
-	f := audiocd.Channels * audiocd.BytesPerSample
-	buf := make([]byte, len(samples)*f)
-	for n < len(buf) {
-		nn, err := s.AudioCD.Read(buf[n:])
-		s.err = err
-		n += nn
-		if err != nil {
-			return 0, false
-		}
+	frames := make([]audiocd.Frame, len(samples))
+	n, err := s.AudioCD.ReadFrames(frames)
+	s.err = err
+	for i, f := range frames[:n] {
+		samples[i][0], samples[i][1] = f.Float64()
 	}
-
-	extractFrame := func(p []byte) (l, r float64) {
-		li := int16(p[0]) + int16(p[1])*(1<<8)
-		ri := int16(p[2]) + int16(p[3])*(1<<8)
-		return float64(li) / (1<<16 - 1), float64(ri) / (1<<16 - 1)
-	}
-	for i := range len(samples) {
-		samples[i][0], samples[i][1] = extractFrame(buf[i*f : (i+1)*f])
+	s.offset += n
+	if err != nil {
+		return n, n > 0
 	}
-
-	return n / f, true
+	return n, true
 }
 
 func (s *cdStreamer) Err() error {
@@ -62,7 +51,7 @@ func (s *cdStreamer) Err() error {
 }
 
 func (s *cdStreamer) Len() int {
-	return int(s.AudioCD.LengthSectors()) * audiocd.SamplesPerFrame * audiocd.Channels
+	return s.AudioCD.LengthSectors() * audiocd.SamplesPerSector
 }
 
 func (s *cdStreamer) Position() int {
@@ -70,9 +59,12 @@ func (s *cdStreamer) Position() int {
 }
 
 func (s *cdStreamer) Seek(p int) error {
-	// seek to the start of the sector
-	_, err := s.AudioCD.Seek(int64(p*audiocd.BytesPerSample), io.SeekStart)
-	return err
+	_, err := s.AudioCD.SeekSample(int64(p))
+	if err != nil {
+		return err
+	}
+	s.offset = p
+	return nil
 }
 
 func (s *cdStreamer) Close() error {
@@ -104,6 +96,11 @@ func main() {
 	// 	panic(err)
 	// }
 	// defer f.Close()
+	// fi, err := f.Stat()
+	// if err != nil {
+	// 	panic(err)
+	// }
+	// dev := vfs.NewImageDevice(f, fi.Size())
 
 	// sdev, err := spi.Open()
 	// if err != nil {
@@ -113,7 +110,7 @@ func main() {
 
 	// done := make(chan struct{})
 	// go func() {
-	// 	err = PollTransfer(sdev, f, done)
+	// 	err = PollTransfer(sdev, dev, done)
 	// }()
 
 	// sigs := make(chan os.Signal, 1)
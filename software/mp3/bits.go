@@ -0,0 +1,20 @@
+package mp3
+
+// bitWriter writes big-endian bit fields into a byte slice.
+type bitWriter struct {
+	buf  []byte
+	bits int // number of bits written
+}
+
+func (w *bitWriter) write(v uint32, n int) {
+	for n > 0 {
+		n--
+		if w.bits%8 == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		if v>>n&1 != 0 {
+			w.buf[len(w.buf)-1] |= 0x80 >> (w.bits % 8)
+		}
+		w.bits++
+	}
+}
@@ -0,0 +1,116 @@
+package mp3
+
+import "math"
+
+// Subbands is the number of subbands of the polyphase filterbank.
+const Subbands = 32
+
+// granuleLines is the number of MDCT lines (and samples) in a granule.
+const granuleLines = 576
+
+// subbandSamples is the number of samples of each subband in a granule.
+const subbandSamples = granuleLines / Subbands
+
+var (
+	analysisWindow [512]float64
+	analysisMatrix [Subbands][64]float64
+	mdctMatrix     [subbandSamples][2 * subbandSamples]float64
+	aliasCS        [8]float64
+	aliasCA        [8]float64
+)
+
+func init() {
+	for i, d := range synthesisWindow {
+		analysisWindow[i] = float64(d) / (1 << 16) / 32
+	}
+	for k := range Subbands {
+		for i := range 64 {
+			analysisMatrix[k][i] = math.Cos(float64((2*k+1)*(i-16)) * math.Pi / 64)
+		}
+	}
+	// the MDCT includes the sine window for normal (long) blocks, and is
+	// scaled so that the decoder's IMDCT and overlap-add reconstruct the
+	// subband samples
+	for k := range subbandSamples {
+		for n := range 2 * subbandSamples {
+			w := math.Sin(math.Pi / 36 * (float64(n) + 0.5))
+			c := math.Cos(math.Pi / 72 * float64((2*n+1+subbandSamples)*(2*k+1)))
+			mdctMatrix[k][n] = w * c / 9
+		}
+	}
+	for i, c := range aliasCoefficients {
+		sq := math.Sqrt(1 + c*c)
+		aliasCS[i] = 1 / sq
+		aliasCA[i] = c / sq
+	}
+}
+
+// analysis is the polyphase analysis filterbank, which splits audio into
+// 32 equal width subbands.
+type analysis struct {
+	x [512]float64 // input history, most recent first
+}
+
+// filter consumes 32 new samples and computes one sample of each subband.
+func (a *analysis) filter(in []float64, out *[Subbands]float64) {
+	copy(a.x[Subbands:], a.x[:512-Subbands])
+	for i := range Subbands {
+		a.x[Subbands-1-i] = in[i]
+	}
+	var y [64]float64
+	for i := range 64 {
+		var sum float64
+		for j := 0; j < 512; j += 64 {
+			sum += analysisWindow[i+j] * a.x[i+j]
+		}
+		y[i] = sum
+	}
+	for k := range Subbands {
+		var sum float64
+		for i, m := range analysisMatrix[k] {
+			sum += m * y[i]
+		}
+		out[k] = sum
+	}
+}
+
+// mdct transforms the subband samples of the previous and current
+// granules into the MDCT lines of the current granule, and applies
+// alias reduction between subbands.
+//
+// Subband samples are indexed [time][subband].
+func mdct(prev, cur *[subbandSamples][Subbands]float64, xr []float64) {
+	var z [2 * subbandSamples]float64
+	for sb := range Subbands {
+		for t := range subbandSamples {
+			z[t] = prev[t][sb]
+			z[t+subbandSamples] = cur[t][sb]
+		}
+		if sb%2 == 1 {
+			// undo the frequency inversion of odd subbands, which the
+			// decoder reverses after the IMDCT
+			for t := 1; t < len(z); t += 2 {
+				z[t] = -z[t]
+			}
+		}
+		lines := xr[sb*subbandSamples : (sb+1)*subbandSamples]
+		for k := range lines {
+			var sum float64
+			for n, m := range mdctMatrix[k] {
+				sum += m * z[n]
+			}
+			lines[k] = sum
+		}
+	}
+
+	// the butterflies are the inverse of those in the decoder
+	for sb := 1; sb < Subbands; sb++ {
+		for i := range aliasCS {
+			lo := sb*subbandSamples - 1 - i
+			hi := sb*subbandSamples + i
+			bu, bd := xr[lo], xr[hi]
+			xr[lo] = bu*aliasCS[i] + bd*aliasCA[i]
+			xr[hi] = bd*aliasCS[i] - bu*aliasCA[i]
+		}
+	}
+}
@@ -0,0 +1,239 @@
+// Package mp3 is a pure Go constant bitrate MP3 (MPEG-1 Layer III)
+// encoder for CD audio.
+//
+// Frames are encoded independently, without the bit reservoir, so any
+// frame can be encoded on its own from the audio around it. Combined with
+// the constant bitrate, this allows random access into an MP3 file that
+// is encoded as it's read; see [Reader].
+//
+// The encoder has no psychoacoustic model: it uses long blocks only and
+// a uniform quantizer step across frequencies, chosen to fill each frame.
+// Frequencies above a cutoff depending on the bitrate are removed.
+package mp3
+
+import (
+	"fmt"
+)
+
+// SampleRate is the sample rate of the audio, which is always CD audio.
+const SampleRate = 44100
+
+// Channels is the number of channels, which is always stereo.
+const Channels = 2
+
+// SamplesPerFrame is the number of samples per channel in each frame.
+const SamplesPerFrame = 2 * granuleLines
+
+// EncoderDelay is the number of samples of delay added by the encoder
+// and decoder filterbanks: decoded audio starts after this many samples.
+const EncoderDelay = granuleLines + 481
+
+// DefaultBitrate is the bitrate used if none is specified, in kbps.
+const DefaultBitrate = 192
+
+// Bitrates are the valid bitrates, in kbps.
+var Bitrates = []int{32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320}
+
+const (
+	headerSize   = 4
+	sideInfoSize = 32 // for stereo MPEG-1
+)
+
+// FrameHistory is the number of samples per channel before a frame
+// needed to encode it: a granule for the overlap of the MDCT, and the
+// length of the analysis filter.
+const FrameHistory = granuleLines + 512
+
+// Encoder encodes frames of CD audio at a constant bitrate.
+type Encoder struct {
+	bitrate int // kbps
+	index   int // bitrate_index in the frame header
+	cutoff  int // number of MDCT lines kept
+}
+
+// NewEncoder creates an encoder for the given bitrate in kbps,
+// which must be one of [Bitrates].
+func NewEncoder(bitrate int) (*Encoder, error) {
+	for i, b := range Bitrates {
+		if b == bitrate {
+			return &Encoder{
+				bitrate: bitrate,
+				index:   i + 1,
+				cutoff:  cutoffLines(bitrate),
+			}, nil
+		}
+	}
+	return nil, fmt.Errorf("mp3: unsupported bitrate %vkbps", bitrate)
+}
+
+// cutoffLines returns the number of MDCT lines to keep at a bitrate.
+// Higher frequencies are inaudible to most people and don't fit well
+// at low bitrates.
+func cutoffLines(bitrate int) int {
+	var hz int
+	switch {
+	case bitrate <= 64:
+		hz = 11000
+	case bitrate <= 96:
+		hz = 14000
+	case bitrate <= 128:
+		hz = 16000
+	case bitrate <= 192:
+		hz = 18500
+	default:
+		hz = 20000
+	}
+	return hz * granuleLines / (SampleRate / 2)
+}
+
+// Bitrate returns the bitrate in kbps.
+func (e *Encoder) Bitrate() int {
+	return e.bitrate
+}
+
+// FrameCount returns the number of frames needed to encode the given
+// number of samples per channel, including the encoder delay.
+func (e *Encoder) FrameCount(samples int64) int64 {
+	return (samples + EncoderDelay + SamplesPerFrame - 1) / SamplesPerFrame
+}
+
+// FrameOffset returns the byte offset of frame n from the first frame.
+// Frames are padded by a byte as needed to keep the bitrate constant.
+func (e *Encoder) FrameOffset(n int64) int64 {
+	return n * 144 * int64(e.bitrate) * 1000 / SampleRate
+}
+
+// FrameSize returns the size of frame n in bytes.
+func (e *Encoder) FrameSize(n int64) int {
+	return int(e.FrameOffset(n+1) - e.FrameOffset(n))
+}
+
+// FrameAt returns the frame containing the byte offset off.
+func (e *Encoder) FrameAt(off int64) int64 {
+	n := off * SampleRate / (144 * int64(e.bitrate) * 1000)
+	for e.FrameOffset(n+1) <= off {
+		n++
+	}
+	for n > 0 && e.FrameOffset(n) > off {
+		n--
+	}
+	return n
+}
+
+// Size returns the size in bytes of the encoded frames for the given
+// number of samples per channel.
+func (e *Encoder) Size(samples int64) int64 {
+	return e.FrameOffset(e.FrameCount(samples))
+}
+
+// EncodeFrame appends frame n to dst. pcm holds interleaved stereo
+// samples, starting FrameHistory samples per channel before the first
+// sample of the frame and including all of the frame's samples.
+// Samples before the start of the audio must be zero.
+func (e *Encoder) EncodeFrame(dst []byte, n int64, pcm []int16) []byte {
+	if len(pcm) < (FrameHistory+SamplesPerFrame)*Channels {
+		panic("mp3: not enough samples for frame")
+	}
+
+	// split into subbands: the granule before the frame, and its two granules
+	var sub [Channels][3][subbandSamples][Subbands]float64
+	var in [Subbands]float64
+	for ch := range Channels {
+		var a analysis
+		for block := range (FrameHistory + SamplesPerFrame) / Subbands {
+			for i := range in {
+				in[i] = float64(pcm[(block*Subbands+i)*Channels+ch]) / (1 << 15)
+			}
+			// the first blocks only fill the filter
+			t := block - (FrameHistory-granuleLines)/Subbands
+			if t < 0 {
+				var discard [Subbands]float64
+				a.filter(in[:], &discard)
+				continue
+			}
+			a.filter(in[:], &sub[ch][t/subbandSamples][t%subbandSamples])
+		}
+	}
+
+	var xr [2][Channels][granuleLines]float64
+	for gr := range 2 {
+		for ch := range Channels {
+			mdct(&sub[ch][gr], &sub[ch][gr+1], xr[gr][ch][:])
+			clear(xr[gr][ch][e.cutoff:])
+		}
+	}
+
+	// divide the bits between granules and channels, letting each use
+	// what the previous ones didn't
+	size := e.FrameSize(n)
+	avail := (size - headerSize - sideInfoSize) * 8
+	var g [2][Channels]granule
+	for gr := range 2 {
+		for ch := range Channels {
+			left := (2-gr)*Channels - ch
+			g[gr][ch].encode(xr[gr][ch][:], avail/left)
+			avail -= g[gr][ch].part23
+		}
+	}
+
+	w := bitWriter{buf: dst}
+	start := len(dst)
+	e.writeHeader(&w, size > int(144*int64(e.bitrate)*1000/SampleRate))
+	writeSideInfo(&w, &g)
+	for gr := range 2 {
+		for ch := range Channels {
+			g[gr][ch].writeHuffman(&w)
+		}
+	}
+	// the rest of the frame is ancillary data
+	for len(w.buf)-start < size {
+		w.buf = append(w.buf, 0)
+	}
+	return w.buf
+}
+
+func (e *Encoder) writeHeader(w *bitWriter, padding bool) {
+	w.write(0xFFF, 12) // sync
+	w.write(1, 1)      // MPEG-1
+	w.write(1, 2)      // Layer III
+	w.write(1, 1)      // no CRC
+	w.write(uint32(e.index), 4)
+	w.write(0, 2) // 44.1kHz
+	if padding {
+		w.write(1, 1)
+	} else {
+		w.write(0, 1)
+	}
+	w.write(0, 1) // private
+	w.write(0, 2) // stereo
+	w.write(0, 2) // mode extension
+	w.write(0, 1) // not copyrighted
+	w.write(1, 1) // original
+	w.write(0, 2) // no emphasis
+}
+
+func writeSideInfo(w *bitWriter, g *[2][Channels]granule) {
+	w.write(0, 9) // main_data_begin: no bit reservoir
+	w.write(0, 3) // private bits
+	for range Channels {
+		w.write(0, 4) // scfsi
+	}
+	for gr := range 2 {
+		for ch := range Channels {
+			gi := &g[gr][ch]
+			w.write(uint32(gi.part23), 12)
+			w.write(uint32(gi.bigValues), 9)
+			w.write(uint32(gi.globalGain), 8)
+			w.write(0, 4) // scalefac_compress: no scalefactors
+			w.write(0, 1) // window_switching_flag: long blocks
+			for _, t := range gi.tableSelect {
+				w.write(uint32(t), 5)
+			}
+			w.write(uint32(gi.region0), 4)
+			w.write(uint32(gi.region1), 3)
+			w.write(0, 1) // preflag
+			w.write(0, 1) // scalefac_scale
+			w.write(uint32(gi.count1Table), 1)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package mp3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"testing"
+
+	gomp3 "github.com/hajimehoshi/go-mp3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHuffmanTables(t *testing.T) {
+	tables := map[string]*huffTable{"32": &huff32, "33": &huff33}
+	for i, bt := range bigValueTables {
+		if bt.huff != nil {
+			tables[string(rune('0'+i/10))+string(rune('0'+i%10))] = bt.huff
+		}
+	}
+	for name, table := range tables {
+		t.Run(name, func(t *testing.T) {
+			assert.Len(t, table.codes, len(table.lens))
+			// a complete prefix code fills the code space exactly
+			kraft := 0.0
+			for i, l := range table.lens {
+				require.NotZero(t, l)
+				assert.Less(t, int(table.codes[i]), 1<<l)
+				kraft += math.Pow(2, -float64(l))
+			}
+			assert.InDelta(t, 1.0, kraft, 1e-9)
+			for i := range table.lens {
+				for j := range table.lens {
+					if i == j || table.lens[i] > table.lens[j] {
+						continue
+					}
+					prefix := table.codes[j] >> (table.lens[j] - table.lens[i])
+					assert.False(t, prefix == table.codes[i], "code %v is a prefix of %v", i, j)
+				}
+			}
+		})
+	}
+}
+
+func TestFrameSizes(t *testing.T) {
+	enc, err := NewEncoder(128)
+	require.NoError(t, err)
+	assert.Equal(t, 417, enc.FrameSize(0))
+	// 128kbps frames average 417.96 bytes
+	assert.Equal(t, int64(417959), enc.FrameOffset(1000))
+	for _, off := range []int64{0, 1, 416, 417, 418, 834, 835, 417958, 417959} {
+		n := enc.FrameAt(off)
+		assert.LessOrEqual(t, enc.FrameOffset(n), off)
+		assert.Greater(t, enc.FrameOffset(n+1), off)
+	}
+
+	assert.Equal(t, int64(1), enc.FrameCount(0))
+	assert.Equal(t, int64(1), enc.FrameCount(SamplesPerFrame-EncoderDelay))
+	assert.Equal(t, int64(2), enc.FrameCount(SamplesPerFrame-EncoderDelay+1))
+
+	_, err = NewEncoder(100)
+	assert.Error(t, err)
+}
+
+// pcmBytes converts interleaved stereo samples to little-endian bytes.
+func pcmBytes(pcm []int16) []byte {
+	b := make([]byte, len(pcm)*2)
+	for i, s := range pcm {
+		binary.LittleEndian.PutUint16(b[i*2:], uint16(s))
+	}
+	return b
+}
+
+// tones generates a different sine wave on each channel.
+func tones(samples int) []int16 {
+	pcm := make([]int16, samples*Channels)
+	for i := range samples {
+		t := float64(i) / SampleRate
+		pcm[i*2] = int16(12000 * math.Sin(2*math.Pi*1000*t))
+		pcm[i*2+1] = int16(8000 * math.Sin(2*math.Pi*440*t))
+	}
+	return pcm
+}
+
+func encodeAll(t *testing.T, pcm []int16, bitrate int) []byte {
+	r, err := NewReader(bytes.NewReader(pcmBytes(pcm)), int64(len(pcm)/Channels), bitrate)
+	require.NoError(t, err)
+	b, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, r.Size(), int64(len(b)))
+	return b
+}
+
+// decodeAll decodes a stream with go-mp3, which shares no code with the
+// encoder, to interleaved stereo samples.
+func decodeAll(t *testing.T, b []byte) []float64 {
+	d, err := gomp3.NewDecoder(bytes.NewReader(b))
+	require.NoError(t, err)
+	require.Equal(t, SampleRate, d.SampleRate())
+	pcm, err := io.ReadAll(d)
+	require.NoError(t, err)
+	out := make([]float64, len(pcm)/2)
+	for i := range out {
+		out[i] = float64(int16(binary.LittleEndian.Uint16(pcm[i*2:]))) / (1 << 15)
+	}
+	return out
+}
+
+func TestEncodeDecode(t *testing.T) {
+	const samples = SampleRate / 2
+	pcm := tones(samples)
+	for _, bitrate := range []int{64, 128, 320} {
+		b := encodeAll(t, pcm, bitrate)
+		out := decodeAll(t, b)
+		require.GreaterOrEqual(t, len(out), (samples+EncoderDelay)*Channels)
+
+		for ch := range Channels {
+			var signal, noise float64
+			for i := range samples {
+				want := float64(pcm[i*2+ch]) / (1 << 15)
+				got := out[(i+EncoderDelay)*2+ch]
+				signal += want * want
+				noise += (got - want) * (got - want)
+			}
+			snr := 10 * math.Log10(signal/noise)
+			assert.Greater(t, snr, 40.0, "%vkbps channel %v", bitrate, ch)
+		}
+	}
+}
+
+func TestEncodeSilence(t *testing.T) {
+	pcm := make([]int16, SamplesPerFrame*3*Channels)
+	out := decodeAll(t, encodeAll(t, pcm, DefaultBitrate))
+	for _, s := range out {
+		require.Zero(t, s)
+	}
+}
+
+func TestEncodeFullScale(t *testing.T) {
+	// square waves at full scale need the largest quantized values
+	pcm := make([]int16, SamplesPerFrame*4*Channels)
+	for i := range pcm {
+		if i/100%2 == 0 {
+			pcm[i] = math.MaxInt16
+		} else {
+			pcm[i] = math.MinInt16
+		}
+	}
+	decodeAll(t, encodeAll(t, pcm, 32))
+}
+
+func TestEncodeNoise(t *testing.T) {
+	// white noise doesn't fit, so the quantizer is coarse
+	rng := rand.New(rand.NewSource(1))
+	pcm := make([]int16, SamplesPerFrame*4*Channels)
+	for i := range pcm {
+		pcm[i] = int16(rng.Intn(1<<16) - 1<<15)
+	}
+	for _, bitrate := range []int{32, 128} {
+		decodeAll(t, encodeAll(t, pcm, bitrate))
+	}
+}
+
+func TestReaderRandomAccess(t *testing.T) {
+	pcm := tones(SamplesPerFrame * 6)
+	want := encodeAll(t, pcm, 160)
+
+	r, err := NewReader(bytes.NewReader(pcmBytes(pcm)), int64(len(pcm)/Channels), 160)
+	require.NoError(t, err)
+	rng := rand.New(rand.NewSource(1))
+	buf := make([]byte, 1500)
+	for range 50 {
+		off := rng.Int63n(r.Size())
+		_, err := r.Seek(off, io.SeekStart)
+		require.NoError(t, err)
+		n, err := io.ReadFull(r, buf)
+		if off+int64(len(buf)) > r.Size() {
+			require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+		} else {
+			require.NoError(t, err)
+		}
+		require.Equal(t, want[off:off+int64(n)], buf[:n], "offset %v", off)
+	}
+
+	end, err := r.Seek(0, io.SeekEnd)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(want)), end)
+	_, err = r.Read(buf)
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+// BenchmarkEncode encodes a second of audio per iteration. x-realtime is
+// how many seconds of audio are encoded per second, which has to stay
+// above 1 on the slowest host serving MP3s, a Raspberry Pi, for playback
+// not to stall.
+func BenchmarkEncode(b *testing.B) {
+	pcm := pcmBytes(tones(SampleRate))
+	for _, bitrate := range []int{DefaultBitrate, 320} {
+		b.Run(fmt.Sprintf("%vkbps", bitrate), func(b *testing.B) {
+			b.SetBytes(int64(len(pcm)))
+			for range b.N {
+				r, err := NewReader(bytes.NewReader(pcm), SampleRate, bitrate)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := io.Copy(io.Discard, r); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "x-realtime")
+		})
+	}
+}
@@ -0,0 +1,304 @@
+package mp3
+
+import "math"
+
+// maxQuantized is the largest value that can be coded, using 13 linbits.
+const maxQuantized = 15 + 1<<13 - 1
+
+// maxPart23 is the largest number of bits of Huffman data in a granule.
+const maxPart23 = 1<<12 - 1
+
+// granule is the quantized and Huffman coded data for one channel of a
+// granule. Scalefactors are not used, so the quantizer step is uniform
+// across frequencies and set by globalGain.
+type granule struct {
+	q          [granuleLines]int
+	globalGain int
+
+	bigValues   int // number of pairs in the big values region
+	count1      int // number of quadruples in the count1 region
+	tableSelect [3]int
+	region0     int // region0_count
+	region1     int // region1_count
+	count1Table int // 0 for table A, 1 for table B
+	part23      int // bits of Huffman data
+}
+
+// quantize sets the quantized values for the given global gain, using
+// precomputed |xr|^(3/4). It returns the largest magnitude.
+func (g *granule) quantize(xr, xr34 []float64, gain int) int {
+	g.globalGain = gain
+	step := math.Pow(2, -0.1875*float64(gain-210))
+	top := 0
+	for i, x := range xr34 {
+		v := int(x*step + 0.4054)
+		top = max(top, v)
+		if xr[i] < 0 {
+			v = -v
+		}
+		g.q[i] = v
+	}
+	return top
+}
+
+// encode quantizes the lines in xr with the smallest global gain whose
+// Huffman data fits in bits.
+func (g *granule) encode(xr []float64, bits int) {
+	var xr34 [granuleLines]float64
+	peak := 0.0
+	for i, x := range xr {
+		xr34[i] = math.Pow(math.Abs(x), 0.75)
+		peak = max(peak, xr34[i])
+	}
+	bits = min(bits, maxPart23)
+
+	// the smallest gain that doesn't overflow the quantizer
+	lo := 0
+	if peak > 0 {
+		lo = 210 + int(math.Ceil(math.Log2(peak/(maxQuantized-0.4054))/0.1875))
+		lo = max(lo, 0)
+	}
+	hi := 255
+	if lo > hi {
+		lo = hi
+	}
+	// binary search for the smallest gain that fits
+	for lo < hi {
+		mid := (lo + hi) / 2
+		g.quantize(xr, xr34[:], mid)
+		if g.layout() <= bits {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	g.quantize(xr, xr34[:], lo)
+	if g.layout() > bits {
+		// even the largest step doesn't fit; drop the highest lines
+		for i := granuleLines - 1; i >= 0 && g.layout() > bits; i-- {
+			g.q[i] = 0
+		}
+	}
+}
+
+// layout divides the quantized values into regions, selects the Huffman
+// tables, and returns the number of bits needed.
+func (g *granule) layout() int {
+	// trailing zeros are not coded
+	i := granuleLines
+	for i > 1 && g.q[i-1] == 0 && g.q[i-2] == 0 {
+		i -= 2
+	}
+	// quadruples of values up to 1 are coded in the count1 region
+	g.count1 = 0
+	for i > 3 && abs(g.q[i-1]) <= 1 && abs(g.q[i-2]) <= 1 && abs(g.q[i-3]) <= 1 && abs(g.q[i-4]) <= 1 {
+		i -= 4
+		g.count1++
+	}
+	g.bigValues = i / 2
+
+	bits := g.count1Bits(i)
+	g.tableSelect = [3]int{}
+	g.region0, g.region1 = 0, 0
+	if g.bigValues == 0 {
+		g.part23 = bits
+		return bits
+	}
+
+	// split the big values region on scalefactor band boundaries
+	end := g.bigValues * 2
+	bands := 0
+	for sfbLong[bands] < end {
+		bands++
+	}
+	r0 := subdivision[bands][0]
+	for r0 > 0 && sfbLong[r0+1] > end {
+		r0--
+	}
+	r1 := subdivision[bands][1]
+	for r1 > 0 && sfbLong[r0+r1+2] > end {
+		r1--
+	}
+	g.region0, g.region1 = r0, r1
+	a1 := min(sfbLong[r0+1], end)
+	a2 := min(sfbLong[r0+r1+2], end)
+
+	for r, bounds := range [3][2]int{{0, a1}, {a1, a2}, {a2, end}} {
+		t, n := g.chooseTable(bounds[0], bounds[1])
+		g.tableSelect[r] = t
+		bits += n
+	}
+	g.part23 = bits
+	return bits
+}
+
+// count1Bits selects the count1 table for the quadruples starting at
+// start and returns the bits needed.
+func (g *granule) count1Bits(start int) int {
+	a, b := 0, 0
+	for i := range g.count1 {
+		v := g.q[start+i*4 : start+i*4+4]
+		idx, signs := 0, 0
+		for _, x := range v {
+			idx <<= 1
+			if x != 0 {
+				idx |= 1
+				signs++
+			}
+		}
+		a += int(huff32.lens[idx]) + signs
+		b += int(huff33.lens[idx]) + signs
+	}
+	if b < a {
+		g.count1Table = 1
+		return b
+	}
+	g.count1Table = 0
+	return a
+}
+
+// candidateTables are the tables without linbits able to code values
+// up to the index.
+var candidateTables = [16][]int{
+	0: {0}, 1: {1}, 2: {2, 3}, 3: {5, 6},
+	4: {7, 8, 9}, 5: {7, 8, 9},
+	6: {10, 11, 12}, 7: {10, 11, 12},
+	8: {13, 15}, 9: {13, 15}, 10: {13, 15}, 11: {13, 15},
+	12: {13, 15}, 13: {13, 15}, 14: {13, 15}, 15: {13, 15},
+}
+
+// chooseTable selects the table that codes the pairs in [start, end)
+// with the fewest bits.
+func (g *granule) chooseTable(start, end int) (int, int) {
+	top := 0
+	for _, v := range g.q[start:end] {
+		top = max(top, abs(v))
+	}
+	if top < 16 {
+		best, bestBits := 0, math.MaxInt
+		for _, t := range candidateTables[top] {
+			if n := g.pairBits(t, start, end); n < bestBits {
+				best, bestBits = t, n
+			}
+		}
+		return best, bestBits
+	}
+
+	// escape the overflow with the fewest linbits in each family
+	best, bestBits := 0, math.MaxInt
+	for _, family := range [2][2]int{{16, 23}, {24, 31}} {
+		for t := family[0]; t <= family[1]; t++ {
+			if top-15 < 1<<bigValueTables[t].linbits {
+				if n := g.pairBits(t, start, end); n < bestBits {
+					best, bestBits = t, n
+				}
+				break
+			}
+		}
+	}
+	return best, bestBits
+}
+
+// pairBits counts the bits to code the pairs in [start, end) with table t.
+func (g *granule) pairBits(t, start, end int) int {
+	if t == 0 {
+		return 0
+	}
+	bt := bigValueTables[t]
+	bits := 0
+	for i := start; i < end; i += 2 {
+		x, y := abs(g.q[i]), abs(g.q[i+1])
+		if bt.linbits > 0 {
+			if x >= 15 {
+				x = 15
+				bits += bt.linbits
+			}
+			if y >= 15 {
+				y = 15
+				bits += bt.linbits
+			}
+		}
+		bits += int(bt.huff.lens[x*bt.huff.dim+y])
+		if x != 0 {
+			bits++
+		}
+		if y != 0 {
+			bits++
+		}
+	}
+	return bits
+}
+
+// writeHuffman writes the Huffman coded data of the granule.
+func (g *granule) writeHuffman(w *bitWriter) {
+	end := g.bigValues * 2
+	a1 := min(sfbLong[g.region0+1], end)
+	a2 := min(sfbLong[g.region0+g.region1+2], end)
+	for i := 0; i < end; i += 2 {
+		t := g.tableSelect[2]
+		if i < a1 {
+			t = g.tableSelect[0]
+		} else if i < a2 {
+			t = g.tableSelect[1]
+		}
+		if t == 0 {
+			continue
+		}
+		bt := bigValueTables[t]
+		x, y := abs(g.q[i]), abs(g.q[i+1])
+		xc, yc := x, y
+		if bt.linbits > 0 {
+			xc, yc = min(x, 15), min(y, 15)
+		}
+		idx := xc*bt.huff.dim + yc
+		w.write(uint32(bt.huff.codes[idx]), int(bt.huff.lens[idx]))
+		if xc == 15 && bt.linbits > 0 {
+			w.write(uint32(x-15), bt.linbits)
+		}
+		if x != 0 {
+			w.write(sign(g.q[i]), 1)
+		}
+		if yc == 15 && bt.linbits > 0 {
+			w.write(uint32(y-15), bt.linbits)
+		}
+		if y != 0 {
+			w.write(sign(g.q[i+1]), 1)
+		}
+	}
+
+	table := &huff32
+	if g.count1Table == 1 {
+		table = &huff33
+	}
+	for i := range g.count1 {
+		v := g.q[end+i*4 : end+i*4+4]
+		idx := 0
+		for _, x := range v {
+			idx <<= 1
+			if x != 0 {
+				idx |= 1
+			}
+		}
+		w.write(uint32(table.codes[idx]), int(table.lens[idx]))
+		for _, x := range v {
+			if x != 0 {
+				w.write(sign(x), 1)
+			}
+		}
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// sign returns the sign bit of x, which is 1 for negative values.
+func sign(x int) uint32 {
+	if x < 0 {
+		return 1
+	}
+	return 0
+}
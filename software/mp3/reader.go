@@ -0,0 +1,118 @@
+package mp3
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// bytesPerSample is the size of a stereo 16-bit sample frame.
+const bytesPerSample = Channels * 2
+
+// Reader encodes PCM audio as MP3 frames as they're read. It supports
+// seeking to any byte: only the frames containing the bytes read are
+// encoded, from the audio around them.
+//
+// The output is a bare sequence of frames with no tags.
+type Reader struct {
+	enc     *Encoder
+	pcm     io.ReadSeeker
+	samples int64 // length of the audio in samples per channel
+	offset  int64
+
+	// the most recently encoded frame
+	frame    int64
+	frameBuf []byte
+
+	raw []byte
+	in  []int16
+}
+
+// NewReader creates a Reader encoding the given number of samples of
+// CD audio (44.1kHz stereo 16-bit little-endian) read from pcm.
+func NewReader(pcm io.ReadSeeker, samples int64, bitrate int) (*Reader, error) {
+	enc, err := NewEncoder(bitrate)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{
+		enc:     enc,
+		pcm:     pcm,
+		samples: samples,
+		frame:   -1,
+		raw:     make([]byte, (FrameHistory+SamplesPerFrame)*bytesPerSample),
+		in:      make([]int16, (FrameHistory+SamplesPerFrame)*Channels),
+	}, nil
+}
+
+// Size returns the size of the encoded audio in bytes.
+func (r *Reader) Size() int64 {
+	return r.enc.Size(r.samples)
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	size := r.Size()
+	if r.offset >= size {
+		return 0, io.EOF
+	}
+	n := 0
+	for n < len(p) && r.offset < size {
+		frame := r.enc.FrameAt(r.offset)
+		if err := r.encode(frame); err != nil {
+			return n, err
+		}
+		c := copy(p[n:], r.frameBuf[r.offset-r.enc.FrameOffset(frame):])
+		n += c
+		r.offset += int64(c)
+	}
+	return n, nil
+}
+
+func (r *Reader) Seek(offset int64, whence int) (int64, error) {
+	var newOffset int64
+	switch whence {
+	case io.SeekCurrent:
+		newOffset = r.offset + offset
+	case io.SeekEnd:
+		newOffset = r.Size() + offset
+	default:
+		newOffset = offset
+	}
+	if newOffset < 0 {
+		return r.offset, fmt.Errorf("seek before start of mp3")
+	}
+	r.offset = newOffset
+	return newOffset, nil
+}
+
+// encode encodes frame n into frameBuf, unless it's already there.
+func (r *Reader) encode(n int64) error {
+	if r.frame == n {
+		return nil
+	}
+	r.frame = -1
+
+	// read the audio needed, which may extend past either end
+	start := n*SamplesPerFrame - FrameHistory
+	first, last := max(start, 0), min(start+FrameHistory+SamplesPerFrame, r.samples)
+	clear(r.raw)
+	if first < last {
+		if _, err := r.pcm.Seek(first*bytesPerSample, io.SeekStart); err != nil {
+			return err
+		}
+		buf := r.raw[(first-start)*bytesPerSample : (last-start)*bytesPerSample]
+		if _, err := io.ReadFull(r.pcm, buf); err != nil {
+			return fmt.Errorf("mp3: reading audio: %w", err)
+		}
+	}
+	for i := range r.in {
+		r.in[i] = int16(binary.LittleEndian.Uint16(r.raw[i*2:]))
+	}
+
+	r.frameBuf = r.enc.EncodeFrame(r.frameBuf[:0], n, r.in)
+	r.frame = n
+	return nil
+}
+
+// ensure interface conformation
+var _ io.ReadSeeker = (*Reader)(nil)
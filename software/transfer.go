@@ -1,15 +1,16 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"io"
-	"os"
 	"time"
 
 	"github.com/rabidaudio/cdz-nuts/vfs"
 )
 
-func PollTransfer(s *Spi, f *os.File, close chan struct{}) error {
+func PollTransfer(s spiI, dev vfs.BlockDevice, close chan struct{}) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 	for {
 		select {
 		case <-time.After(time.Millisecond):
@@ -19,11 +20,7 @@ func PollTransfer(s *Spi, f *os.File, close chan struct{}) error {
 			}
 			if dr.Requested {
 				fmt.Printf("received request %v\n", dr)
-				addr := dr.Address * vfs.SECTOR_SIZE
-				f.Seek(int64(addr), io.SeekStart)
-				count := int64(vfs.SECTOR_SIZE) * int64(dr.SectorCount)
-				_, err = io.CopyN(s, f, count)
-				if err != nil {
+				if err := serveRequest(ctx, s, dev, dr); err != nil {
 					return err
 				}
 			}
@@ -33,3 +30,13 @@ func PollTransfer(s *Spi, f *os.File, close chan struct{}) error {
 		}
 	}
 }
+
+// serveRequest writes the sectors requested by the mcu.
+func serveRequest(ctx context.Context, s spiI, dev vfs.BlockDevice, dr DataRequest) error {
+	buf := make([]byte, dev.BlockSize()*int(dr.SectorCount))
+	if err := dev.ReadBlocks(ctx, int64(dr.Address), buf); err != nil {
+		return err
+	}
+	_, err := s.Write(buf)
+	return err
+}
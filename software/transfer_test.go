@@ -0,0 +1,35 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/rabidaudio/cdz-nuts/vfs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServeRequest(t *testing.T) {
+	image := make([]byte, 8*vfs.SECTOR_SIZE)
+	for i := range image {
+		image[i] = byte(i / vfs.SECTOR_SIZE)
+	}
+	dev := vfs.NewImageDevice(bytes.NewReader(image), int64(len(image)))
+	m := &MSpi{RequestedBlock: 3}
+	ctx := context.Background()
+
+	dr, err := m.Query()
+	failIfErr(t, err)
+	assert.True(t, dr.Requested)
+	failIfErr(t, serveRequest(ctx, m, dev, dr))
+	assert.Equal(t, vfs.SECTOR_SIZE, m.BytesWritten)
+
+	dr, err = m.Query()
+	failIfErr(t, err)
+	assert.False(t, dr.Requested)
+
+	// requests past the end of the disk fail
+	err = serveRequest(ctx, m, dev, DataRequest{Requested: true, Address: 7, SectorCount: 2})
+	assert.Error(t, err)
+	assert.Equal(t, vfs.SECTOR_SIZE, m.BytesWritten)
+}
@@ -0,0 +1,116 @@
+package vfs
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// album is a CD loaded into the filesystem.
+type album struct {
+	cd     CD
+	dir    *entry   // the directory of the album
+	tracks []*entry // the track files, in order
+	disc   *entry   // the whole disc file, instead of track files
+}
+
+// album returns the loaded CD with the given name, if any.
+func (f *Filesystem) album(name string) *album {
+	for _, a := range f.albums {
+		if a.cd.Name == name {
+			return a
+		}
+	}
+	return nil
+}
+
+// Albums returns the names of the loaded CDs, in the order they were loaded.
+func (f *Filesystem) Albums() []string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	names := make([]string, len(f.albums))
+	for i, a := range f.albums {
+		names[i] = a.cd.Name
+	}
+	return names
+}
+
+// SetArtistDirs sets whether album directories are grouped in a directory
+// for each artist. It can't be changed while CDs are loaded.
+func (f *Filesystem) SetArtistDirs(group bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.albums) > 0 {
+		return fmt.Errorf("can't change layout while CDs are loaded")
+	}
+	f.artistDirs = group
+	f.traceEvent(TraceEvent{Op: TraceDisk, Disk: f.traceDiskInfo()})
+	return f.switchOverlay()
+}
+
+// dirName returns the name of the directory for the CD. Within an
+// artist's directory, the album title alone is enough.
+func (f *Filesystem) dirName(cd CD) string {
+	names := []string{cd.Name, cd.Title}
+	if f.artistDirs {
+		names = []string{cd.Title, cd.Name}
+	}
+	for _, name := range names {
+		if name := f.profile.Names.longName(name); name != "" {
+			return name
+		}
+	}
+	return "Unknown Album"
+}
+
+// artistDir returns the directory for the CD's artist, creating it if
+// needed.
+func (f *Filesystem) artistDir(cd CD) *entry {
+	name := f.profile.Names.longName(cd.Artist)
+	if name == "" {
+		name = "Unknown Artist"
+	}
+	root := f.vol.root
+	for _, c := range root.children {
+		if c.dir && strings.EqualFold(c.name, name) {
+			return c
+		}
+	}
+	dir := &entry{name: name, dir: true, parent: root, modTime: f.now()}
+	root.children = append(root.children, dir)
+	return dir
+}
+
+// uniqueName returns a variation of name that isn't used by the
+// children of dir. FAT names are case insensitive.
+func uniqueName(dir *entry, name string) string {
+	used := func(name string) bool {
+		return slices.ContainsFunc(dir.children, func(c *entry) bool {
+			return strings.EqualFold(c.name, name)
+		})
+	}
+	unique := name
+	for n := 2; used(unique); n++ {
+		unique = fmt.Sprintf("%v (%d)", name, n)
+	}
+	return unique
+}
+
+// addAlbum adds the directory of an album to the tree.
+func (f *Filesystem) addAlbum(a *album) {
+	parent := a.dir.parent
+	parent.children = append(parent.children, a.dir)
+	f.albums = append(f.albums, a)
+}
+
+// removeAlbum removes the directory of an album from the tree, along
+// with its artist directory if it's left empty.
+func (f *Filesystem) removeAlbum(a *album) {
+	f.albums = slices.DeleteFunc(f.albums, func(b *album) bool { return b == a })
+	parent := a.dir.parent
+	parent.children = slices.DeleteFunc(parent.children, func(e *entry) bool { return e == a.dir })
+	if parent != f.vol.root && len(parent.children) == 0 {
+		root := f.vol.root
+		root.children = slices.DeleteFunc(root.children, func(e *entry) bool { return e == parent })
+	}
+}
@@ -0,0 +1,138 @@
+package vfs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var MURMUR = CD{
+	Name:   "R.E.M. - Murmur",
+	Title:  "Murmur",
+	Artist: "R.E.M.",
+	Tracks: []Track{
+		{Title: "Radio Free Europe", LengthSectors: secondsToSectors(4, 6)},
+		{Title: "Pilgrimage", LengthSectors: secondsToSectors(4, 30)},
+		{Title: "Laughing", LengthSectors: secondsToSectors(3, 57)},
+	},
+}
+
+func TestMultipleAlbums(t *testing.T) {
+	fsys := createAt(t, testTime)
+	defer fsys.Close()
+
+	require.NoError(t, fsys.LoadCD(CHRONIC_TOWN))
+	require.NoError(t, fsys.LoadCD(MURMUR))
+	assert.Equal(t, []string{CHRONIC_TOWN.Name, MURMUR.Name}, fsys.Albums())
+	assert.ErrorContains(t, fsys.LoadCD(MURMUR), "already loaded")
+
+	pfs := parseImage(t, fsys)
+	files, err := pfs.ReadDir("/R.E.M. - Murmur")
+	require.NoError(t, err)
+	assert.Len(t, files, 2+len(MURMUR.Tracks))
+	path, ok := fsys.trackPath(MURMUR, 1)
+	assert.True(t, ok)
+	assert.Equal(t, "/R.E.M. - Murmur/02 - Pilgrimage.wav", path)
+
+	ranges, err := fsys.TrackRanges()
+	require.NoError(t, err)
+	assert.Len(t, ranges, len(CHRONIC_TOWN.Tracks)+len(MURMUR.Tracks))
+}
+
+func TestEjectAlbum(t *testing.T) {
+	fsys := createAt(t, testTime)
+	defer fsys.Close()
+
+	require.NoError(t, fsys.LoadCD(CHRONIC_TOWN))
+	require.NoError(t, fsys.LoadCD(MURMUR))
+	murmur := fsys.album(MURMUR.Name)
+	clusters := make([]uint32, len(murmur.tracks))
+	for i, e := range murmur.tracks {
+		clusters[i] = e.cluster
+	}
+
+	require.NoError(t, fsys.Eject(CHRONIC_TOWN.Name))
+	assert.Error(t, fsys.Eject(CHRONIC_TOWN.Name))
+	assert.Equal(t, []string{MURMUR.Name}, fsys.Albums())
+	// the files of the other CD don't move
+	for i, e := range murmur.tracks {
+		assert.Equal(t, clusters[i], e.cluster)
+	}
+	_, ok := fsys.trackPath(CHRONIC_TOWN, 0)
+	assert.False(t, ok)
+
+	// the freed space is reused
+	cd := CHRONIC_TOWN
+	cd.Name = "Chronic Town (Reissue)"
+	require.NoError(t, fsys.LoadCD(cd))
+	assert.Less(t, fsys.album(cd.Name).tracks[0].cluster, clusters[0])
+
+	pfs := parseImage(t, fsys)
+	readImageFile(t, pfs, "/Chronic Town (Reissue)/05 - Stumble.wav")
+	readImageFile(t, pfs, "/R.E.M. - Murmur/03 - Laughing.wav")
+
+	require.NoError(t, fsys.EjectAll())
+	assert.Empty(t, fsys.Albums())
+	assert.Empty(t, fsys.vol.root.children)
+}
+
+func TestArtistDirs(t *testing.T) {
+	fsys := createAt(t, testTime)
+	defer fsys.Close()
+
+	require.NoError(t, fsys.SetArtistDirs(true))
+	require.NoError(t, fsys.LoadCD(CHRONIC_TOWN))
+	require.NoError(t, fsys.LoadCD(MURMUR))
+	assert.Error(t, fsys.SetArtistDirs(false))
+
+	path, _ := fsys.trackPath(MURMUR, 0)
+	assert.Equal(t, "/R.E.M/Murmur/01 - Radio Free Europe.wav", path)
+	pfs := parseImage(t, fsys)
+	files, err := pfs.ReadDir("/R.E.M")
+	require.NoError(t, err)
+	assert.Len(t, files, 2+2)
+	readImageFile(t, pfs, "/R.E.M/Chronic Town/01 - Wolves, Lower.wav")
+
+	require.NoError(t, fsys.Eject(CHRONIC_TOWN.Name))
+	assert.Len(t, fsys.vol.root.children, 1)
+	// trailing dots are dropped from names, and the artist directory goes
+	// with its last album
+	require.NoError(t, fsys.Eject(MURMUR.Name))
+	assert.Empty(t, fsys.vol.root.children)
+}
+
+func TestAlbumDirNames(t *testing.T) {
+	fsys := createAt(t, testTime)
+	defer fsys.Close()
+
+	require.NoError(t, fsys.LoadCD(CD{Name: "a", Tracks: []Track{{LengthSectors: 75}}}))
+	require.NoError(t, fsys.LoadCD(CD{Tracks: []Track{{LengthSectors: 75}}}))
+
+	var names []string
+	for _, c := range fsys.vol.root.children {
+		names = append(names, c.name)
+	}
+	assert.Equal(t, []string{"a", "Unknown Album"}, names)
+
+	// names are unique regardless of case
+	require.NoError(t, fsys.LoadCD(CD{Name: "A ", Tracks: []Track{{LengthSectors: 75}}}))
+	assert.Equal(t, "A (2)", fsys.vol.root.children[2].name)
+}
+
+func TestStableShortNames(t *testing.T) {
+	fsys := createAt(t, testTime)
+	defer fsys.Close()
+
+	a := CD{Name: "Greatest Hits 1", Tracks: []Track{{LengthSectors: 75}}}
+	b := CD{Name: "Greatest Hits 2", Tracks: []Track{{LengthSectors: 75}}}
+	require.NoError(t, fsys.LoadCD(a))
+	require.NoError(t, fsys.LoadCD(b))
+	assert.Equal(t, "GREATE~2   ", fsys.album(b.Name).dir.short)
+
+	// ejecting the first CD doesn't rename the second
+	require.NoError(t, fsys.Eject(a.Name))
+	assert.Equal(t, "GREATE~2   ", fsys.album(b.Name).dir.short)
+	require.NoError(t, fsys.LoadCD(a))
+	assert.Equal(t, "GREATE~1   ", fsys.album(a.Name).dir.short)
+}
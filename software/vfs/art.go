@@ -0,0 +1,112 @@
+package vfs
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"os"
+
+	// decoders for cover images
+	_ "image/gif"
+	_ "image/png"
+)
+
+// DefaultCoverSize is the largest width and height of album art in the
+// built-in profiles, which most devices with a screen can display.
+const DefaultCoverSize = 500
+
+// coverQuality is the JPEG quality album art is encoded with.
+const coverQuality = 90
+
+// coverNames are the names of the album art files, which players look
+// for in the album directory.
+var coverNames = []string{"folder.jpg", "cover.jpg"}
+
+// ReadCover reads a cover image from a file, such as a user supplied
+// image or one saved in a metadata cache, for use as [CD.Cover].
+func ReadCover(path string) ([]byte, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := image.DecodeConfig(bytes.NewReader(b)); err != nil {
+		return nil, fmt.Errorf("invalid cover image %v: %w", path, err)
+	}
+	return b, nil
+}
+
+// scaleCover decodes a JPEG, PNG or GIF image and re-encodes it as a
+// baseline JPEG no larger than size in either dimension. Images are
+// always re-encoded since many devices can't display progressive JPEGs.
+func scaleCover(data []byte, size int) ([]byte, error) {
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid cover image: %w", err)
+	}
+	sb := src.Bounds()
+	w, h := sb.Dx(), sb.Dy()
+	if w > size || h > size {
+		// keep the aspect ratio
+		if w >= h {
+			w, h = size, max(1, h*size/sb.Dx())
+		} else {
+			w, h = max(1, w*size/sb.Dy()), size
+		}
+	}
+
+	var buf bytes.Buffer
+	err = jpeg.Encode(&buf, scaleImage(src, w, h), &jpeg.Options{Quality: coverQuality})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// scaleImage scales an image down to w by h pixels, averaging the
+// source pixels covered by each destination pixel.
+func scaleImage(src image.Image, w, h int) *image.RGBA {
+	sb := src.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, sb.Dx(), sb.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, sb.Min, draw.Src)
+	if w == sb.Dx() && h == sb.Dy() {
+		return rgba
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		y0, y1 := y*sb.Dy()/h, max((y+1)*sb.Dy()/h, y*sb.Dy()/h+1)
+		for x := range w {
+			x0, x1 := x*sb.Dx()/w, max((x+1)*sb.Dx()/w, x*sb.Dx()/w+1)
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := rgba.Pix[sy*rgba.Stride+x0*4 : sy*rgba.Stride+x1*4]
+				for i, v := range row {
+					sum[i%4] += int(v)
+				}
+			}
+			n := (y1 - y0) * (x1 - x0)
+			px := dst.Pix[y*dst.Stride+x*4:]
+			for i, s := range sum {
+				px[i] = uint8((s + n/2) / n)
+			}
+		}
+	}
+	return dst
+}
+
+// coverFiles returns the album art files for dir.
+func (f *Filesystem) coverFiles(cover []byte, dir *entry) []*entry {
+	files := make([]*entry, len(coverNames))
+	for i, name := range coverNames {
+		files[i] = &entry{
+			name:    name,
+			size:    int64(len(cover)),
+			header:  cover,
+			parent:  dir,
+			modTime: f.now(),
+		}
+	}
+	return files
+}
@@ -0,0 +1,118 @@
+package vfs
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCover renders a w by h PNG.
+func testCover(t *testing.T, w, h int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			img.Set(x, y, color.RGBA{uint8(x * 255 / w), uint8(y * 255 / h), 128, 255})
+		}
+	}
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+func TestScaleCover(t *testing.T) {
+	cases := []struct {
+		w, h, size int
+		outW, outH int
+	}{
+		{800, 600, 300, 300, 225},
+		{600, 800, 300, 225, 300},
+		{200, 100, 300, 200, 100}, // never scaled up
+		{3000, 1, 500, 500, 1},
+	}
+	for _, c := range cases {
+		b, err := scaleCover(testCover(t, c.w, c.h), c.size)
+		require.NoError(t, err)
+		cfg, format, err := image.DecodeConfig(bytes.NewReader(b))
+		require.NoError(t, err)
+		assert.Equal(t, "jpeg", format)
+		assert.Equal(t, [2]int{c.outW, c.outH}, [2]int{cfg.Width, cfg.Height}, "%vx%v", c.w, c.h)
+	}
+
+	_, err := scaleCover([]byte("not an image"), 300)
+	assert.Error(t, err)
+}
+
+func TestScaleImage(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for x := range 4 {
+		src.Set(x, 0, color.RGBA{0, 0, 0, 255})
+		src.Set(x, 1, color.RGBA{200, 100, 50, 255})
+	}
+	dst := scaleImage(src, 2, 1)
+	assert.Equal(t, color.RGBA{100, 50, 25, 255}, dst.At(1, 0))
+}
+
+func TestReadCover(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cover.png")
+	require.NoError(t, os.WriteFile(path, testCover(t, 10, 10), 0644))
+	b, err := ReadCover(path)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, b)
+
+	bad := filepath.Join(dir, "cover.txt")
+	require.NoError(t, os.WriteFile(bad, []byte("hello"), 0644))
+	_, err = ReadCover(bad)
+	assert.Error(t, err)
+	_, err = ReadCover(filepath.Join(dir, "missing.jpg"))
+	assert.Error(t, err)
+}
+
+func TestCoverFiles(t *testing.T) {
+	cd := CHRONIC_TOWN
+	cd.Cover = testCover(t, 1000, 1000)
+
+	fsys := createAt(t, testTime)
+	defer fsys.Close()
+	require.NoError(t, fsys.LoadCD(cd))
+
+	pfs := parseImage(t, fsys)
+	folder := readImageFile(t, pfs, "/R.E.M. - Chronic Town/folder.jpg")
+	cover := readImageFile(t, pfs, "/R.E.M. - Chronic Town/cover.jpg")
+	assert.Equal(t, folder, cover)
+	img, err := jpeg.Decode(bytes.NewReader([]byte(folder)))
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, DefaultCoverSize, DefaultCoverSize), img.Bounds())
+
+	// the same image is embedded in the track tags
+	wav := readImageFile(t, pfs, "/R.E.M. - Chronic Town/01 - Wolves, Lower.wav")
+	id3 := riffChunks(t, []byte(wav[12:]))["id3 "]
+	assert.Contains(t, string(id3), "APIC")
+	assert.True(t, bytes.HasSuffix(id3, []byte(folder)))
+}
+
+func TestCoverProfile(t *testing.T) {
+	cd := CHRONIC_TOWN
+	cd.Cover = testCover(t, 100, 100)
+
+	fsys := createAt(t, testTime)
+	defer fsys.Close()
+	require.NoError(t, fsys.SetProfile(ProfileShortNames))
+	require.NoError(t, fsys.LoadCD(cd))
+	// no album art for this profile
+	assert.Len(t, fsys.vol.root.children[0].children, len(cd.Tracks))
+	assert.Equal(t, trackHeader(CHRONIC_TOWN, 0), fsys.albums[0].tracks[0].header)
+	require.NoError(t, fsys.Eject(cd.Name))
+
+	cd.Cover = []byte("not an image")
+	require.NoError(t, fsys.SetProfile(ProfileDefault))
+	assert.Error(t, fsys.LoadCD(cd))
+}
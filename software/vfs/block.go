@@ -0,0 +1,112 @@
+package vfs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// BlockDevice is a disk read in fixed size blocks, as hosts address
+// it. Implementations are safe for concurrent use.
+type BlockDevice interface {
+	// ReadBlocks fills buf, whose length must be a multiple of the
+	// block size, with the blocks starting at lba.
+	ReadBlocks(ctx context.Context, lba int64, buf []byte) error
+	// BlockSize returns the size of a block in bytes.
+	BlockSize() int
+	// BlockCount returns the number of blocks on the disk.
+	BlockCount() int64
+}
+
+var (
+	_ BlockDevice = (*Filesystem)(nil)
+	_ BlockDevice = (*ImageDevice)(nil)
+)
+
+// checkBlocks checks that a read of buf at lba is within a disk of
+// count blocks of the given size.
+func checkBlocks(lba int64, buf []byte, size int, count int64) error {
+	if len(buf)%size != 0 {
+		return fmt.Errorf("read of %v bytes isn't a whole number of %v byte blocks", len(buf), size)
+	}
+	if lba < 0 || lba+int64(len(buf)/size) > count {
+		return fmt.Errorf("read of %v blocks at %v is outside the disk of %v blocks", len(buf)/size, lba, count)
+	}
+	return nil
+}
+
+// ReadBlocks implements [BlockDevice]. Reads may be concurrent with
+// each other and with changes to the filesystem, such as loading a CD.
+func (f *Filesystem) ReadBlocks(ctx context.Context, lba int64, buf []byte) error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if err := checkBlocks(lba, buf, SECTOR_SIZE, f.vol.Size()/SECTOR_SIZE); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	off := lba * SECTOR_SIZE
+	var c cursor
+	n := 0
+	var err error
+	for n < len(buf) && err == nil {
+		// reading tracks may be slow, so check between regions
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		var nn int
+		nn, err = f.readRegion(buf[n:], off+int64(n), &c)
+		n += nn
+	}
+	f.traceRead(start, off, len(buf), n, err)
+	return err
+}
+
+// BlockSize implements [BlockDevice]. Blocks are sectors of 512 bytes.
+func (f *Filesystem) BlockSize() int {
+	return SECTOR_SIZE
+}
+
+// BlockCount implements [BlockDevice].
+func (f *Filesystem) BlockCount() int64 {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.vol.Size() / SECTOR_SIZE
+}
+
+// ImageDevice is a [BlockDevice] serving a disk image, such as one
+// written from a [Filesystem] earlier, in 512 byte sectors.
+type ImageDevice struct {
+	r    io.ReaderAt
+	size int64
+}
+
+// NewImageDevice returns a device serving the image of the given size
+// in bytes read from r, which must be safe for concurrent use, as
+// [os.File] is. A partial sector at the end of the image is left out.
+func NewImageDevice(r io.ReaderAt, size int64) *ImageDevice {
+	return &ImageDevice{r: r, size: size}
+}
+
+// ReadBlocks implements [BlockDevice].
+func (d *ImageDevice) ReadBlocks(ctx context.Context, lba int64, buf []byte) error {
+	if err := checkBlocks(lba, buf, SECTOR_SIZE, d.BlockCount()); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	_, err := d.r.ReadAt(buf, lba*SECTOR_SIZE)
+	return err
+}
+
+// BlockSize implements [BlockDevice].
+func (d *ImageDevice) BlockSize() int {
+	return SECTOR_SIZE
+}
+
+// BlockCount implements [BlockDevice].
+func (d *ImageDevice) BlockCount() int64 {
+	return d.size / SECTOR_SIZE
+}
@@ -0,0 +1,100 @@
+package vfs
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadBlocks(t *testing.T) {
+	fsys := createAt(t, testTime)
+	defer fsys.Close()
+	require.NoError(t, fsys.SetLayout(Layout{Type: FAT16, Superfloppy: true, Size: 16 * 1024 * 1024}))
+	require.NoError(t, fsys.LoadCD(testDisc()))
+
+	var dev BlockDevice = fsys
+	assert.Equal(t, SECTOR_SIZE, dev.BlockSize())
+	assert.Equal(t, int64(16*1024*1024/SECTOR_SIZE), dev.BlockCount())
+
+	image := make([]byte, fsys.vol.Size())
+	_, err := fsys.vol.ReadAt(image, 0)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	buf := make([]byte, 300*SECTOR_SIZE)
+	require.NoError(t, dev.ReadBlocks(ctx, 0, buf))
+	assert.Equal(t, image[:len(buf)], buf)
+	last := dev.BlockCount() - 1
+	require.NoError(t, dev.ReadBlocks(ctx, last, buf[:SECTOR_SIZE]))
+	assert.Equal(t, image[last*SECTOR_SIZE:], buf[:SECTOR_SIZE])
+
+	assert.ErrorContains(t, dev.ReadBlocks(ctx, 0, buf[:100]), "whole number")
+	assert.ErrorContains(t, dev.ReadBlocks(ctx, last, buf[:2*SECTOR_SIZE]), "outside the disk")
+	assert.ErrorContains(t, dev.ReadBlocks(ctx, -1, buf[:SECTOR_SIZE]), "outside the disk")
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.ErrorIs(t, dev.ReadBlocks(cancelled, 0, buf), context.Canceled)
+
+	img := NewImageDevice(bytes.NewReader(image[:len(image)-100]), int64(len(image)-100))
+	assert.Equal(t, dev.BlockCount()-1, img.BlockCount())
+	require.NoError(t, img.ReadBlocks(ctx, 10, buf[:4*SECTOR_SIZE]))
+	assert.Equal(t, image[10*SECTOR_SIZE:14*SECTOR_SIZE], buf[:4*SECTOR_SIZE])
+	assert.Error(t, img.ReadBlocks(ctx, last, buf[:SECTOR_SIZE]))
+}
+
+func TestReadBlocksConcurrent(t *testing.T) {
+	fsys := createAt(t, testTime)
+	defer fsys.Close()
+	require.NoError(t, fsys.SetLayout(Layout{Type: FAT32, Superfloppy: true, Size: 64 * 1024 * 1024}))
+	cd := testDisc()
+	require.NoError(t, fsys.LoadCD(cd))
+
+	// the sectors of the tracks, which stay put while other CDs come
+	// and go
+	want := make(map[int64][]byte)
+	var lbas []int64
+	for _, e := range fsys.album(cd.Name).tracks {
+		lba := fsys.vol.clusterOffset(e.cluster) / SECTOR_SIZE
+		for i := range int64(e.clusters) * int64(fsys.vol.sectorsPerCluster) {
+			b := make([]byte, SECTOR_SIZE)
+			_, err := fsys.vol.ReadAt(b, (lba+i)*SECTOR_SIZE)
+			require.NoError(t, err)
+			want[lba+i] = b
+			lbas = append(lbas, lba+i)
+		}
+	}
+
+	var wg sync.WaitGroup
+	ctx := context.Background()
+	for g := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(int64(g)))
+			buf := make([]byte, SECTOR_SIZE)
+			for range 2000 {
+				lba := lbas[rng.Intn(len(lbas))]
+				if err := fsys.ReadBlocks(ctx, lba, buf); err != nil {
+					t.Error(err)
+					return
+				}
+				if !bytes.Equal(want[lba], buf) {
+					t.Errorf("sector %v differs", lba)
+					return
+				}
+			}
+		}()
+	}
+	for i := range 20 {
+		other := CD{Name: "Other " + strconv.Itoa(i), Tracks: []Track{{LengthSectors: 10}}}
+		require.NoError(t, fsys.LoadCD(other))
+		require.NoError(t, fsys.Eject(other.Name))
+	}
+	wg.Wait()
+}
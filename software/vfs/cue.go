@@ -0,0 +1,174 @@
+package vfs
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/rabidaudio/cdz-nuts/audiocd/redbook"
+)
+
+// discDataBytes returns the size of the audio of every track of a CD.
+func discDataBytes(cd CD) int64 {
+	var size int64
+	for i := range cd.Tracks {
+		size += trackDataBytes(&cd.Tracks[i])
+	}
+	return size
+}
+
+// discHeader returns the WAV header of a CD loaded as a whole disc, with
+// a cue point at the start of each track, labelled with its title.
+func discHeader(cd CD) []byte {
+	tags := Tags{Title: cd.Title, Artist: cd.Artist, Album: cd.Title, Cover: cd.Cover}
+	cues := make([]cuePoint, len(cd.Tracks))
+	var sectors int64
+	for i, t := range cd.Tracks {
+		cues[i] = cuePoint{
+			frame: sectors * redbook.BytesPerSector / wavBlockAlign,
+			label: t.Title,
+		}
+		sectors += int64(t.LengthSectors)
+	}
+	return wavHeader(discDataBytes(cd), tags, cues)
+}
+
+// discFile returns the WAV file of a CD loaded as a whole disc, in dir.
+func (f *Filesystem) discFile(cd CD, dir *entry) *entry {
+	header := discHeader(cd)
+	return &entry{
+		name:    withExt(f.dirName(cd), ".wav"),
+		size:    int64(len(header)) + discDataBytes(cd),
+		header:  header,
+		src:     &discReader{tracks: cd.Tracks},
+		parent:  dir,
+		modTime: f.now(),
+		track:   true,
+	}
+}
+
+// cueSheet adds the cue sheet of a CD loaded as a whole disc to its
+// directory. The name of the disc file must be final.
+func (f *Filesystem) cueSheet(a *album) {
+	if a.disc == nil {
+		return
+	}
+	data := renderCue(a.cd, a.dir, a.disc)
+	a.dir.children = append(a.dir.children, &entry{
+		name:    withExt(f.dirName(a.cd), ".cue"),
+		size:    int64(len(data)),
+		header:  data,
+		parent:  a.dir,
+		modTime: f.now(),
+	})
+}
+
+// renderCue renders the cue sheet of the whole disc file wav in dir. Like
+// M3U playlists, it's encoded in Latin-1, which is what most players
+// expect, and refers to the file by its 8.3 name if need be.
+//
+// See https://wiki.hydrogenaud.io/index.php?title=Cue_sheet
+func renderCue(cd CD, dir, wav *entry) []byte {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "REM DISCID %08X\r\n", cd.DiscID())
+	if cd.Artist != "" {
+		fmt.Fprintf(&sb, "PERFORMER %s\r\n", cueString(cd.Artist))
+	}
+	if cd.Title != "" {
+		fmt.Fprintf(&sb, "TITLE %s\r\n", cueString(cd.Title))
+	}
+	fmt.Fprintf(&sb, "FILE %s WAVE\r\n", cueString(relativePath(dir, wav, true)))
+	start := 0
+	for i, t := range cd.Tracks {
+		fmt.Fprintf(&sb, "  TRACK %02d AUDIO\r\n", i+1)
+		if t.Title != "" {
+			fmt.Fprintf(&sb, "    TITLE %s\r\n", cueString(t.Title))
+		}
+		if t.Artist != "" {
+			fmt.Fprintf(&sb, "    PERFORMER %s\r\n", cueString(t.Artist))
+		}
+		fmt.Fprintf(&sb, "    INDEX 01 %s\r\n", redbook.MSFFromSectors(start).String())
+		start += t.LengthSectors
+	}
+	return toLatin1(sb.String())
+}
+
+// cueString quotes s for a cue sheet, which has no escapes, so double
+// quotes become single quotes and control characters spaces.
+func cueString(s string) string {
+	if !isLatin1(s) {
+		s = Transliterate(s)
+	}
+	return `"` + strings.Map(func(r rune) rune {
+		switch {
+		case r == '"':
+			return '\''
+		case r < 0x20:
+			return ' '
+		}
+		return r
+	}, s) + `"`
+}
+
+// discReader reads the audio of every track of a CD in order, as if it
+// were one track. Reads are passed on to the tracks, so tracks read from
+// a disc read the same sectors of it as they would on their own. Tracks
+// without a source, or whose source ends early, read as silence.
+type discReader struct {
+	tracks []Track
+	offset int64
+}
+
+func (d *discReader) Read(p []byte) (int, error) {
+	var start int64
+	for _, t := range d.tracks {
+		size := trackDataBytes(&t)
+		if d.offset >= start+size {
+			start += size
+			continue
+		}
+		// stop at the end of the track
+		p = p[:min(int64(len(p)), start+size-d.offset)]
+		n, err := readTrack(t, p, d.offset-start)
+		d.offset += int64(n)
+		return n, err
+	}
+	return 0, io.EOF
+}
+
+// readTrack fills p with the audio of a track at off.
+func readTrack(t Track, p []byte, off int64) (int, error) {
+	if t.ReadSeeker == nil {
+		clear(p)
+		return len(p), nil
+	}
+	if _, err := t.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(t, p)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		clear(p[n:])
+		return len(p), nil
+	}
+	return n, err
+}
+
+func (d *discReader) Seek(offset int64, whence int) (int64, error) {
+	var newOffset int64
+	switch whence {
+	case io.SeekCurrent:
+		newOffset = d.offset + offset
+	case io.SeekEnd:
+		newOffset = discDataBytes(CD{Tracks: d.tracks}) + offset
+	default:
+		newOffset = offset
+	}
+	if newOffset < 0 {
+		return d.offset, fmt.Errorf("seek before start of disc")
+	}
+	d.offset = newOffset
+	return newOffset, nil
+}
+
+// ensure interface conformation
+var _ io.ReadSeeker = (*discReader)(nil)
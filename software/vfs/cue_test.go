@@ -0,0 +1,180 @@
+package vfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/rabidaudio/cdz-nuts/audiocd/redbook"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// discByte is the byte at offset off of the disc of wholeDisc.
+func discByte(off int64) byte {
+	return byte(off % 251)
+}
+
+// wholeDisc returns a CD of three tracks, of 10, 7 and 3 sectors, which
+// read as one disc whose bytes are given by discByte.
+func wholeDisc() CD {
+	var cd CD
+	var off int64
+	for i, sectors := range []int{10, 7, 3} {
+		data := make([]byte, sectors*redbook.BytesPerSector)
+		for j := range data {
+			data[j] = discByte(off + int64(j))
+		}
+		off += int64(len(data))
+		cd.Tracks = append(cd.Tracks, Track{
+			ReadSeeker:    bytes.NewReader(data),
+			Filename:      fmt.Sprintf("Track %02d", i+1),
+			LengthSectors: sectors,
+		})
+	}
+	cd.Name, cd.Title, cd.Artist = "Live", `Live at "Home"`, "Tester"
+	cd.Tracks[0].Title = "Intro"
+	cd.Tracks[1].Title, cd.Tracks[1].Artist = "Song", "Guest"
+	cd.WholeDisc = true
+	return cd
+}
+
+func TestWholeDisc(t *testing.T) {
+	fsys := createAt(t, testTime)
+	defer fsys.Close()
+	p := ProfileDefault
+	p.Playlists = PlaylistM3U
+	require.NoError(t, fsys.SetProfile(p))
+	cd := wholeDisc()
+	require.NoError(t, fsys.LoadCD(cd))
+
+	violations, err := fsys.Verify()
+	require.NoError(t, err)
+	assert.Empty(t, violations)
+	tv, err := openTestVolume(fsys.vol)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"/Live/Live.wav", "/Live/Live.cue", "/Live/Live.m3u"}, tv.walk())
+	assert.Empty(t, tv.problems)
+	_, ok := fsys.trackPath(cd, 0)
+	assert.False(t, ok)
+
+	// the audio is the audio tracks of the disc, in one piece
+	b, err := tv.readFile("/Live/Live.wav")
+	require.NoError(t, err)
+	header := discHeader(cd)
+	require.Len(t, b, len(header)+20*redbook.BytesPerSector)
+	assert.Equal(t, header, b[:len(header)])
+	for i, c := range b[len(header):] {
+		if c != discByte(int64(i)) {
+			t.Fatalf("audio differs from the disc at %v", i)
+		}
+	}
+
+	// the adtl LIST follows the INFO LIST, so replaces it here
+	chunks := riffChunks(t, header[12:])
+	assert.Contains(t, chunks, "id3 ")
+	cue := chunks["cue "]
+	require.Len(t, cue, 4+3*24)
+	assert.Equal(t, uint32(3), binary.LittleEndian.Uint32(cue))
+	for i, frame := range []uint32{0, 10 * 588, 17 * 588} {
+		point := cue[4+i*24:]
+		assert.Equal(t, uint32(i+1), binary.LittleEndian.Uint32(point))
+		assert.Equal(t, "data", string(point[8:12]))
+		assert.Equal(t, frame, binary.LittleEndian.Uint32(point[20:]))
+	}
+	adtl := chunks["LIST"]
+	assert.Equal(t, "adtl", string(adtl[:4]))
+	assert.Equal(t, "labl\x0A\x00\x00\x00\x01\x00\x00\x00Intro\x00labl\x09\x00\x00\x00\x02\x00\x00\x00Song\x00\x00", string(adtl[4:]))
+
+	sheet, err := tv.readFile("/Live/Live.cue")
+	require.NoError(t, err)
+	assert.Equal(t, "REM DISCID 06000003\r\n"+
+		"PERFORMER \"Tester\"\r\n"+
+		"TITLE \"Live at 'Home'\"\r\n"+
+		"FILE \"Live.wav\" WAVE\r\n"+
+		"  TRACK 01 AUDIO\r\n"+
+		"    TITLE \"Intro\"\r\n"+
+		"    INDEX 01 00:00:00\r\n"+
+		"  TRACK 02 AUDIO\r\n"+
+		"    TITLE \"Song\"\r\n"+
+		"    PERFORMER \"Guest\"\r\n"+
+		"    INDEX 01 00:00:10\r\n"+
+		"  TRACK 03 AUDIO\r\n"+
+		"    INDEX 01 00:00:17\r\n", string(sheet))
+
+	m3u, err := tv.readFile("/Live/Live.m3u")
+	require.NoError(t, err)
+	assert.Equal(t, "#EXTM3U\r\n#EXTINF:0,Tester - Live at \"Home\"\r\nLive.wav\r\n", string(m3u))
+
+	ranges, err := fsys.TrackRanges()
+	require.NoError(t, err)
+	require.Len(t, ranges, 1)
+	assert.Equal(t, "Live.wav", ranges[0].FileInfo.Name())
+	assert.Equal(t, int64(len(b)), ranges[0].FileInfo.Size())
+	assert.GreaterOrEqual(t, ranges[0].Extent.Length(), int64(len(b)))
+
+	// tracks of the disc can't be added to playlists
+	require.NoError(t, fsys.AddPlaylist(Playlist{Name: "Mix", Tracks: []PlaylistTrack{{cd.Name, 2}}}))
+	tv, err = openTestVolume(fsys.vol)
+	require.NoError(t, err)
+	assert.NotContains(t, tv.walk(), "/Mix.m3u")
+}
+
+func TestWholeDiscShortNames(t *testing.T) {
+	fsys := createAt(t, testTime)
+	defer fsys.Close()
+	require.NoError(t, fsys.SetProfile(ProfileShortNames))
+	cd := wholeDisc()
+	cd.Name = "Live Recording"
+	require.NoError(t, fsys.LoadCD(cd))
+
+	tv, err := openTestVolume(fsys.vol)
+	require.NoError(t, err)
+	sheet, err := tv.readFile("/LIVERECO/LIVERECO.CUE")
+	require.NoError(t, err)
+	assert.Contains(t, string(sheet), "FILE \"LIVERECO.WAV\" WAVE\r\n")
+}
+
+func TestWholeDiscMP3(t *testing.T) {
+	fsys := createAt(t, testTime)
+	defer fsys.Close()
+	require.NoError(t, fsys.SetProfile(ProfileMP3))
+	assert.ErrorContains(t, fsys.LoadCD(wholeDisc()), "only be served as WAV")
+	assert.Empty(t, fsys.Albums())
+}
+
+func TestDiscReader(t *testing.T) {
+	const sector = redbook.BytesPerSector
+	first := bytes.Repeat([]byte{1}, 2*sector)
+	short := bytes.Repeat([]byte{3}, sector)
+	r := &discReader{tracks: []Track{
+		{ReadSeeker: bytes.NewReader(first), LengthSectors: 2},
+		{LengthSectors: 1}, // no source
+		{ReadSeeker: bytes.NewReader(short), LengthSectors: 2},
+	}}
+
+	// reads stop at the end of each track
+	p := make([]byte, 3*sector)
+	n, err := r.Read(p)
+	require.NoError(t, err)
+	assert.Equal(t, 2*sector, n)
+
+	_, err = r.Seek(-3*sector-10, io.SeekEnd)
+	require.NoError(t, err)
+	b, err := io.ReadAll(r)
+	require.NoError(t, err)
+	want := append(bytes.Repeat([]byte{1}, 10), make([]byte, sector)...)
+	want = append(want, short...)
+	want = append(want, make([]byte, sector)...) // past the end of the source
+	assert.Equal(t, want, b)
+
+	_, err = r.Seek(-1, io.SeekStart)
+	assert.Error(t, err)
+}
+
+func TestCueString(t *testing.T) {
+	assert.Equal(t, `"Ágætis 'byrjun' live"`, cueString("Ágætis \"byrjun\"\tlive"))
+	assert.Equal(t, `"Kino"`, cueString("Кино"))
+}
@@ -0,0 +1,45 @@
+package vfs
+
+import (
+	"slices"
+
+	"github.com/rabidaudio/cdz-nuts/audiocd/redbook"
+)
+
+// DiscID returns the FreeDB disc ID of the CD, computed from its table of
+// contents: where each track starts, data tracks included, and where the
+// last one ends. If no track has a StartSector, the tracks are taken to
+// be back to back from the start of the disc, with any data tracks last,
+// which only gives the real ID if the disc was laid out that way. It's
+// the same whenever the same CD is read.
+func (cd CD) DiscID() uint32 {
+	digitSum := func(n int) int {
+		sum := 0
+		for ; n > 0; n /= 10 {
+			sum += n % 10
+		}
+		return sum
+	}
+	tracks := slices.Concat(cd.Tracks, cd.DataTracks)
+	if len(tracks) == 0 {
+		return 0
+	}
+	if !slices.ContainsFunc(tracks, func(t Track) bool { return t.StartSector != 0 }) {
+		start := 0
+		for i := range tracks {
+			tracks[i].StartSector = start
+			start += tracks[i].LengthSectors
+		}
+	}
+	slices.SortStableFunc(tracks, func(a, b Track) int { return a.StartSector - b.StartSector })
+
+	// positions count from the start of the lead-in
+	n, leadOut := 0, 0
+	for _, t := range tracks {
+		n += digitSum((t.StartSector + redbook.LeadInSectors) / redbook.SectorsPerSecond)
+		leadOut = max(leadOut, t.StartSector+t.LengthSectors)
+	}
+	seconds := (leadOut+redbook.LeadInSectors)/redbook.SectorsPerSecond -
+		(tracks[0].StartSector+redbook.LeadInSectors)/redbook.SectorsPerSecond
+	return uint32(n%0xFF)<<24 | uint32(seconds)<<8 | uint32(len(tracks))
+}
@@ -0,0 +1,42 @@
+package vfs
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// withStarts returns a copy of cd with its tracks back to back from
+// sector first, as they'd be given by the table of contents.
+func withStarts(cd CD, first int) CD {
+	cd.Tracks = slices.Clone(cd.Tracks)
+	for i := range cd.Tracks {
+		cd.Tracks[i].StartSector = first
+		first += cd.Tracks[i].LengthSectors
+	}
+	return cd
+}
+
+func TestDiscID(t *testing.T) {
+	// computed by hand with the FreeDB algorithm
+	assert.Equal(t, uint32(0x4E04C705), CHRONIC_TOWN.DiscID())
+	assert.Equal(t, CHRONIC_TOWN.DiscID(), CHRONIC_TOWN.DiscID())
+	assert.NotEqual(t, CHRONIC_TOWN.DiscID(), MURMUR.DiscID())
+	// the same as when the starts are given
+	assert.Equal(t, uint32(0x4E04C705), withStarts(CHRONIC_TOWN, 0).DiscID())
+
+	// the first track starts after a pregap
+	pregap := withStarts(CHRONIC_TOWN, 182)
+	assert.Equal(t, uint32(0x4604C705), pregap.DiscID())
+
+	// an enhanced CD, with a data track in a second session after the
+	// audio tracks
+	enhanced := withStarts(CHRONIC_TOWN, 0)
+	enhanced.DataTracks = []Track{{StartSector: 103125, LengthSectors: 10000}}
+	assert.Equal(t, uint32(0x6005E406), enhanced.DiscID())
+
+	// positions survive a trace, so replayed disks have the same serial
+	assert.Equal(t, pregap.DiscID(), traceAlbum(pregap).cd().DiscID())
+	assert.Equal(t, enhanced.DiscID(), traceAlbum(enhanced).cd().DiscID())
+}
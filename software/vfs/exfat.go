@@ -0,0 +1,260 @@
+package vfs
+
+import (
+	"encoding/binary"
+	"math/bits"
+	"sync"
+	"unicode"
+	"unicode/utf16"
+)
+
+// exFAT structures, from Microsoft's exFAT file system specification.
+// The volume starts with a boot region and its backup, followed by a
+// single FAT. The allocation bitmap and up-case table are stored in the
+// cluster heap, like files, and referenced from the root directory.
+const (
+	exfatBootSectors = 12 // boot sector, extended boot sectors, OEM parameters, reserved and checksum
+	exfatNameChars   = 15 // UTF-16 characters per file name entry
+
+	exfatEntryBitmap   = 0x81
+	exfatEntryUpcase   = 0x82
+	exfatEntryLabel    = 0x83
+	exfatEntryFile     = 0x85
+	exfatEntryStream   = 0xC0
+	exfatEntryFileName = 0xC1
+
+	exfatAllocationPossible = 0x01
+	exfatMaxLabel           = 11
+)
+
+// exfatSystemFiles returns the allocation bitmap and up-case table of a
+// volume with the given number of clusters. The bitmap is rendered once
+// the volume is allocated.
+func exfatSystemFiles(clusterCount uint32) []*entry {
+	table := upcaseTable()
+	return []*entry{
+		{name: "allocation bitmap", size: int64(clusterCount+7) / 8},
+		{name: "up-case table", size: int64(len(table)), header: table},
+	}
+}
+
+// exfatEntrySetSize returns the number of directory entries describing a
+// file with the given name.
+func exfatEntrySetSize(name string) int {
+	n := len(utf16.Encode([]rune(name)))
+	return 2 + (n+exfatNameChars-1)/exfatNameChars
+}
+
+// exfatUpcase returns the upper case of a UTF-16 code unit, as recorded
+// in the up-case table.
+func exfatUpcase(c uint16) uint16 {
+	if utf16.IsSurrogate(rune(c)) {
+		return c
+	}
+	u := unicode.ToUpper(rune(c))
+	if u > 0xFFFF {
+		return c
+	}
+	return uint16(u)
+}
+
+// upcaseTable returns the compressed up-case table, in which runs of
+// characters that are their own upper case are recorded as 0xFFFF and
+// the length of the run.
+var upcaseTable = sync.OnceValue(func() []byte {
+	var table []uint16
+	for c := 0; c <= 0xFFFF; {
+		run := 0
+		for c+run <= 0xFFFF && exfatUpcase(uint16(c+run)) == uint16(c+run) {
+			run++
+		}
+		if run > 1 {
+			table = append(table, 0xFFFF, uint16(run))
+			c += run
+			continue
+		}
+		table = append(table, exfatUpcase(uint16(c)))
+		c++
+	}
+	b := make([]byte, len(table)*2)
+	for i, u := range table {
+		binary.LittleEndian.PutUint16(b[i*2:], u)
+	}
+	return b
+})
+
+// exfatChecksum32 computes the checksum of the boot region and up-case
+// table, skipping the bytes for which skip returns true.
+func exfatChecksum32(sum uint32, b []byte, skip func(i int) bool) uint32 {
+	for i, c := range b {
+		if skip != nil && skip(i) {
+			continue
+		}
+		sum = bits.RotateLeft32(sum, -1) + uint32(c)
+	}
+	return sum
+}
+
+// exfatChecksum16 computes the checksum of an entry set or name,
+// skipping the bytes for which skip returns true.
+func exfatChecksum16(sum uint16, b []byte, skip func(i int) bool) uint16 {
+	for i, c := range b {
+		if skip != nil && skip(i) {
+			continue
+		}
+		sum = bits.RotateLeft16(sum, -1) + uint16(c)
+	}
+	return sum
+}
+
+// nameHash hashes the upper case of a name, so that lookups needn't
+// compare every name in a directory.
+func nameHash(name []uint16) uint16 {
+	var sum uint16
+	for _, c := range name {
+		u := exfatUpcase(c)
+		sum = exfatChecksum16(sum, []byte{byte(u), byte(u >> 8)}, nil)
+	}
+	return sum
+}
+
+// renderExFAT computes the boot region and the allocation bitmap.
+func (v *volume) renderExFAT() {
+	bitmap := v.system[0]
+	bm := make([]byte, bitmap.size)
+	for _, x := range v.extents {
+		for c := x.e.cluster; c < x.e.cluster+x.e.clusters; c++ {
+			i := c - firstCluster
+			bm[i/8] |= 1 << (i % 8)
+		}
+	}
+	bitmap.header = bm
+
+	region := make([]byte, exfatBootSectors*SECTOR_SIZE)
+	b := region[:SECTOR_SIZE]
+	copy(b[0:], []byte{0xEB, 0x76, 0x90})
+	copy(b[3:11], "EXFAT   ")
+	binary.LittleEndian.PutUint64(b[64:], uint64(v.start))
+	binary.LittleEndian.PutUint64(b[72:], uint64(v.partSectors))
+	binary.LittleEndian.PutUint32(b[80:], v.reservedSectors)
+	binary.LittleEndian.PutUint32(b[84:], v.fatSectors)
+	binary.LittleEndian.PutUint32(b[88:], v.dataSector())
+	binary.LittleEndian.PutUint32(b[92:], v.clusterCount)
+	binary.LittleEndian.PutUint32(b[96:], v.root.cluster)
+	binary.LittleEndian.PutUint32(b[100:], v.serial)
+	binary.LittleEndian.PutUint16(b[104:], 0x0100) // revision 1.00
+	b[108] = byte(bits.TrailingZeros(SECTOR_SIZE))
+	b[109] = byte(bits.TrailingZeros32(v.sectorsPerCluster))
+	b[110] = byte(v.fatCount)
+	b[111] = 0x80 // drive number
+	b[112] = byte(uint64(v.clusterCount-v.freeClusters) * 100 / uint64(v.clusterCount))
+	b[510], b[511] = 0x55, 0xAA
+	// the extended boot sectors are only signed
+	for s := 1; s <= 8; s++ {
+		binary.LittleEndian.PutUint32(region[(s+1)*SECTOR_SIZE-4:], 0xAA550000)
+	}
+
+	// the volume flags and percent in use can change without updating
+	// the checksum
+	sum := exfatChecksum32(0, region[:11*SECTOR_SIZE], func(i int) bool {
+		return i == 106 || i == 107 || i == 112
+	})
+	for i := 11 * SECTOR_SIZE; i < len(region); i += 4 {
+		binary.LittleEndian.PutUint32(region[i:], sum)
+	}
+	v.bootRegion = region
+}
+
+// exfatBootSector returns sector s of the volume, which precedes the FAT.
+func (v *volume) exfatBootSector(s int64) []byte {
+	if s >= 2*exfatBootSectors {
+		return zeroSector
+	}
+	// the backup boot region is identical
+	s %= exfatBootSectors
+	return v.bootRegion[s*SECTOR_SIZE : (s+1)*SECTOR_SIZE]
+}
+
+// renderExFATDir computes the directory entries of a directory. Unlike
+// FAT, there are no "." and ".." entries.
+func (v *volume) renderExFATDir(d *entry) []byte {
+	b := make([]byte, v.dirSize(d))
+	i := 0
+	next := func() []byte {
+		ent := b[i*dirEntrySize : (i+1)*dirEntrySize]
+		i++
+		return ent
+	}
+
+	if d == v.root {
+		ent := next()
+		ent[0] = exfatEntryLabel
+		label := utf16.Encode([]rune(v.label))
+		label = label[:min(len(label), exfatMaxLabel)]
+		ent[1] = byte(len(label))
+		for j, c := range label {
+			binary.LittleEndian.PutUint16(ent[2+j*2:], c)
+		}
+
+		bitmap, upcase := v.system[0], v.system[1]
+		ent = next()
+		ent[0] = exfatEntryBitmap
+		binary.LittleEndian.PutUint32(ent[20:], bitmap.cluster)
+		binary.LittleEndian.PutUint64(ent[24:], uint64(bitmap.size))
+
+		ent = next()
+		ent[0] = exfatEntryUpcase
+		binary.LittleEndian.PutUint32(ent[4:], exfatChecksum32(0, upcase.header, nil))
+		binary.LittleEndian.PutUint32(ent[20:], upcase.cluster)
+		binary.LittleEndian.PutUint64(ent[24:], uint64(upcase.size))
+	}
+
+	for _, c := range d.children {
+		name := utf16.Encode([]rune(c.name))
+		set := b[i*dirEntrySize : (i+exfatEntrySetSize(c.name))*dirEntrySize]
+
+		file := next()
+		file[0] = exfatEntryFile
+		file[1] = byte(len(set)/dirEntrySize - 1) // secondary entries
+		attr := uint16(attrArchive)
+		size := uint64(c.size)
+		if c.dir {
+			attr = attrDirectory
+			size = uint64(v.dirSize(c))
+		}
+		binary.LittleEndian.PutUint16(file[4:], attr)
+		date, tm := dosTime(c.modTime)
+		ts := uint32(date)<<16 | uint32(tm)
+		binary.LittleEndian.PutUint32(file[8:], ts)  // creation
+		binary.LittleEndian.PutUint32(file[12:], ts) // modification
+		binary.LittleEndian.PutUint32(file[16:], ts) // last access
+		if c.modTime.Year() >= 1980 {
+			// the odd second, in 10ms units
+			file[20] = byte(c.modTime.Second()%2) * 100
+			file[21] = file[20]
+		}
+
+		stream := next()
+		stream[0] = exfatEntryStream
+		stream[1] = exfatAllocationPossible
+		stream[3] = byte(len(name))
+		binary.LittleEndian.PutUint16(stream[4:], nameHash(name))
+		binary.LittleEndian.PutUint64(stream[8:], size) // valid data length
+		binary.LittleEndian.PutUint32(stream[20:], c.cluster)
+		binary.LittleEndian.PutUint64(stream[24:], size)
+
+		for len(name) > 0 {
+			ent := next()
+			ent[0] = exfatEntryFileName
+			n := min(len(name), exfatNameChars)
+			for j, u := range name[:n] {
+				binary.LittleEndian.PutUint16(ent[2+j*2:], u)
+			}
+			name = name[n:]
+		}
+
+		sum := exfatChecksum16(0, set, func(i int) bool { return i == 2 || i == 3 })
+		binary.LittleEndian.PutUint16(file[2:], sum)
+	}
+	return b
+}
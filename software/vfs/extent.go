@@ -0,0 +1,66 @@
+package vfs
+
+import "sort"
+
+// extent is a run of sectors of the disk holding part of an entry,
+// starting at byte offset off within it. Extents cover whole clusters,
+// so they include the slack space after the end of a file.
+type extent struct {
+	lba     int64 // first sector
+	sectors int64
+	e       *entry
+	off     int64
+}
+
+// end returns the sector after the extent.
+func (x extent) end() int64 {
+	return x.lba + x.sectors
+}
+
+// extentIndex maps sectors of the disk to the entries stored there,
+// ordered by sector. Extents don't overlap.
+type extentIndex []extent
+
+// cursor remembers where the previous lookup in an extentIndex ended, so
+// that sequential lookups needn't search. The zero value is ready to
+// use, and a cursor stays valid when the index is rebuilt.
+type cursor struct {
+	i int
+}
+
+// find returns the index of the extent holding the sector lba. If no
+// extent holds it, the index of the next extent is returned instead,
+// which is len(x) if there is none.
+func (x extentIndex) find(lba int64, c *cursor) (int, bool) {
+	// sequential reads are in the same extent as the last, or the next
+	for _, i := range [2]int{c.i, c.i + 1} {
+		if i >= 0 && i < len(x) && x[i].lba <= lba && lba < x[i].end() {
+			c.i = i
+			return i, true
+		}
+	}
+	i := sort.Search(len(x), func(i int) bool { return x[i].end() > lba })
+	c.i = i
+	return i, i < len(x) && x[i].lba <= lba
+}
+
+// buildExtents indexes the entries that own clusters, which must be
+// ordered by cluster.
+func (v *volume) buildExtents(allocated []*entry) {
+	v.extents = make(extentIndex, len(allocated))
+	for i, e := range allocated {
+		v.extents[i] = extent{
+			lba:     v.clusterOffset(e.cluster) / SECTOR_SIZE,
+			sectors: int64(e.clusters) * int64(v.sectorsPerCluster),
+			e:       e,
+		}
+	}
+}
+
+// owner returns the entry that the given cluster is allocated to, if any.
+func (v *volume) owner(cluster uint32, c *cursor) *entry {
+	if i, ok := v.extents.find(v.clusterOffset(cluster)/SECTOR_SIZE, c); ok {
+		return v.extents[i].e
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package vfs
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// findLinear looks up a sector the slow way.
+func findLinear(x extentIndex, lba int64) (int, bool) {
+	for i, ext := range x {
+		if lba < ext.end() {
+			return i, ext.lba <= lba
+		}
+	}
+	return len(x), false
+}
+
+func TestExtentIndex(t *testing.T) {
+	fsys := createAt(t, testTime)
+	defer fsys.Close()
+	require.NoError(t, fsys.SetLayout(Layout{Type: FAT32, Superfloppy: true, Size: 64 * 1024 * 1024}))
+	cd := testDisc()
+	cd.Cover = testCover(t, 10, 10)
+	require.NoError(t, fsys.LoadCD(cd))
+	require.NoError(t, fsys.LoadCD(CD{Name: "Second", Tracks: []Track{{LengthSectors: 100}, {LengthSectors: 3}}}))
+	require.NoError(t, fsys.Eject(cd.Name)) // leave a gap
+	require.NoError(t, fsys.LoadCD(CD{Name: "Third", Tracks: []Track{{LengthSectors: 10}}}))
+
+	x := fsys.vol.extents
+	require.NotEmpty(t, x)
+	for i := 1; i < len(x); i++ {
+		assert.LessOrEqual(t, x[i-1].end(), x[i].lba, "extents overlap")
+	}
+
+	// lookups agree with a linear scan, whether sequential or not
+	var seq cursor
+	end := x[len(x)-1].end() + 10
+	for lba := int64(0); lba < end; lba++ {
+		wi, wok := findLinear(x, lba)
+		i, ok := x.find(lba, &seq)
+		assert.Equal(t, wok, ok, "sector %v", lba)
+		if ok {
+			assert.Equal(t, wi, i, "sector %v", lba)
+		}
+		var c cursor
+		i, ok = x.find(lba, &c)
+		assert.Equal(t, wi, i, "sector %v", lba)
+		assert.Equal(t, wok, ok, "sector %v", lba)
+	}
+	rng := rand.New(rand.NewSource(1))
+	var c cursor
+	for range 1000 {
+		lba := rng.Int63n(end)
+		wi, wok := findLinear(x, lba)
+		i, ok := x.find(lba, &c)
+		assert.Equal(t, wok, ok, "sector %v", lba)
+		if ok {
+			assert.Equal(t, wi, i, "sector %v", lba)
+		}
+	}
+
+	// reading in odd sized pieces, which follow the cursor, matches
+	// reading at random
+	size := end * SECTOR_SIZE
+	want := make([]byte, size)
+	_, err := fsys.vol.ReadAt(want, 0)
+	require.NoError(t, err)
+	r, err := fsys.Reader()
+	require.NoError(t, err)
+	got := make([]byte, 0, size)
+	buf := make([]byte, 3000)
+	for int64(len(got)) < size {
+		n, err := r.Read(buf[:min(int64(len(buf)), size-int64(len(got)))])
+		require.NoError(t, err)
+		got = append(got, buf[:n]...)
+	}
+	assert.True(t, bytes.Equal(want, got))
+}
+
+// benchmarkFilesystem loads the given number of albums of short tracks.
+func benchmarkFilesystem(b *testing.B, albums int) *Filesystem {
+	fsys, err := create(Options{Time: testTime})
+	require.NoError(b, err)
+	require.NoError(b, fsys.SetLayout(Layout{Type: FAT32, Size: 4 << 30}))
+	for i := range albums {
+		cd := CD{Name: "Album " + strconv.Itoa(i)}
+		for range 12 {
+			cd.Tracks = append(cd.Tracks, Track{LengthSectors: 75})
+		}
+		require.NoError(b, fsys.LoadCD(cd))
+	}
+	return fsys
+}
+
+// BenchmarkRead measures the cost of a 512 byte read as the number of
+// tracks grows, which should stay flat.
+func BenchmarkRead(b *testing.B) {
+	for _, albums := range []int{1, 10, 100, 1000} {
+		fsys := benchmarkFilesystem(b, albums)
+		x := fsys.vol.extents
+		// reads stay in the cluster heap, rather than the FAT
+		start, end := x[0].lba*SECTOR_SIZE, x[len(x)-1].end()*SECTOR_SIZE
+		name := fmt.Sprintf("tracks=%d", albums*12)
+
+		b.Run(name+"/sequential", func(b *testing.B) {
+			r, err := fsys.Reader()
+			require.NoError(b, err)
+			r.Seek(start, io.SeekStart)
+			buf := make([]byte, SECTOR_SIZE)
+			b.ResetTimer()
+			for range b.N {
+				if _, err := r.Read(buf); err != nil {
+					b.Fatal(err)
+				}
+				if off, _ := r.Seek(0, io.SeekCurrent); off >= end {
+					r.Seek(start, io.SeekStart)
+				}
+			}
+		})
+
+		b.Run(name+"/random", func(b *testing.B) {
+			r, err := fsys.Reader()
+			require.NoError(b, err)
+			rng := rand.New(rand.NewSource(1))
+			offsets := make([]int64, 4096)
+			for i := range offsets {
+				offsets[i] = start + rng.Int63n((end-start)/SECTOR_SIZE)*SECTOR_SIZE
+			}
+			buf := make([]byte, SECTOR_SIZE)
+			b.ResetTimer()
+			for i := range b.N {
+				r.Seek(offsets[i%len(offsets)], io.SeekStart)
+				if _, err := r.Read(buf); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		fsys.Close()
+	}
+}
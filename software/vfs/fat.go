@@ -0,0 +1,769 @@
+package vfs
+
+import (
+	"cmp"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Layout of the synthesized disk. Unless it's a superfloppy, the disk
+// has an MBR with a single partition, aligned to 1 MiB as most
+// partitioning tools do. The geometry of the volume depends on its
+// [Layout].
+//
+// For the on-disk structures, see Microsoft's FAT specification
+// (fatgen103) and https://en.wikipedia.org/wiki/Design_of_the_FAT_file_system
+const (
+	partitionStart = 2048 // first sector of the partition
+	dirEntrySize   = 32
+	firstCluster   = 2 // the number of the first data cluster
+
+	fsInfoSector     = 1 // FAT32 only, relative to the volume
+	backupBootSector = 6
+
+	partitionTypeFAT12    = 0x01
+	partitionTypeExFAT    = 0x07
+	partitionTypeFAT32LBA = 0x0C
+	partitionTypeFAT16LBA = 0x0E
+	mediaFixedDisk        = 0xF8
+
+	fatFree = 0x00000000
+
+	attrVolumeLabel = 0x08
+	attrDirectory   = 0x10
+	attrArchive     = 0x20
+)
+
+// entry is a file or directory in the virtual filesystem.
+type entry struct {
+	name     string // long name, e.g. "01 - Wolves, Lower.wav"
+	short    string // space padded 8.3 alias, e.g. "01-WOL~1WAV"
+	lfn      bool   // whether long file name entries are needed
+	dir      bool
+	size     int64 // size in bytes of file data, 0 for directories
+	modTime  time.Time
+	header   []byte        // generated data at the start of the file
+	src      io.ReadSeeker // source of file data after the header; nil reads as zeros
+	srcMu    sync.Mutex    // serializes reads of src, which seeks
+	track    bool          // whether the file is a track, which the host can't write
+	parent   *entry
+	children []*entry
+
+	cluster  uint32 // first cluster
+	clusters uint32 // number of contiguous clusters allocated
+	data     []byte // rendered directory entries, for directories
+}
+
+// volume computes the contents of a virtual disk image from a tree of
+// entries, without any backing storage. Every file is allocated a single
+// contiguous run of clusters.
+type volume struct {
+	geometry
+	label     string
+	serial    uint32
+	shortOnly bool // write only 8.3 names
+	created   time.Time
+	root      *entry
+	system    []*entry // exFAT allocation bitmap and up-case table
+
+	superfloppy   bool
+	start         uint32 // first sector of the volume
+	totalSectors  uint32 // size of the whole disk
+	partSectors   uint32 // size of the volume
+	freeClusters  uint32
+	nextFree      uint32
+	extents       extentIndex // where the entries that own clusters are
+	mbr, bootSect []byte
+	fsInfo        []byte
+	bootRegion    []byte // exFAT boot sectors, including the checksum
+}
+
+// newVolume computes the geometry of a disk with the given layout.
+func newVolume(l Layout, label string, serial uint32, created time.Time) (*volume, error) {
+	v := &volume{
+		label:       label,
+		serial:      serial,
+		created:     created,
+		superfloppy: l.Superfloppy,
+		start:       partitionStart,
+	}
+	if l.Superfloppy {
+		v.start = 0
+	}
+	if l.Size/SECTOR_SIZE > math.MaxUint32 {
+		return nil, fmt.Errorf("disk too large")
+	}
+	v.totalSectors = uint32(l.Size / SECTOR_SIZE)
+	if v.totalSectors <= v.start {
+		return nil, fmt.Errorf("disk too small")
+	}
+	v.partSectors = v.totalSectors - v.start
+	if l.ClusterSize%SECTOR_SIZE != 0 {
+		return nil, fmt.Errorf("invalid cluster size %v", l.ClusterSize)
+	}
+	g, err := newGeometry(l.Type, v.partSectors, uint32(l.ClusterSize/SECTOR_SIZE))
+	if err != nil {
+		return nil, err
+	}
+	v.geometry = g
+
+	v.root = &entry{dir: true, modTime: created}
+	if v.fat == ExFAT {
+		v.system = exfatSystemFiles(v.clusterCount)
+	}
+	if err := v.allocate(); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// relayout returns a volume with the given layout holding the entries of
+// v, allocated afresh. If it fails, v is left as it was.
+func (v *volume) relayout(l Layout) (*volume, error) {
+	nv, err := newVolume(l, v.label, v.serial, v.created)
+	if err != nil {
+		return nil, err
+	}
+	nv.shortOnly = v.shortOnly
+
+	type clusters struct{ first, n uint32 }
+	saved := make(map[*entry]clusters)
+	var walk func(e *entry)
+	walk = func(e *entry) {
+		saved[e] = clusters{e.cluster, e.clusters}
+		e.cluster, e.clusters = 0, 0
+		for _, c := range e.children {
+			walk(c)
+		}
+	}
+	walk(v.root)
+	nv.root = v.root
+	if err := nv.allocate(); err != nil {
+		for e, c := range saved {
+			e.cluster, e.clusters = c.first, c.n
+		}
+		return nil, err
+	}
+	return nv, nil
+}
+
+// clustersNeeded returns the number of clusters the entries of v need in a
+// volume with the geometry g.
+func (v *volume) clustersNeeded(g geometry) uint32 {
+	n := uint32(0)
+	var walk func(e *entry)
+	walk = func(e *entry) {
+		n += v.entryClusters(g, e)
+		for _, c := range e.children {
+			walk(c)
+		}
+	}
+	walk(v.root)
+	if g.fat == ExFAT {
+		for _, e := range exfatSystemFiles(g.clusterCount) {
+			n += g.clustersFor(e.size)
+		}
+	}
+	return n
+}
+
+// entryClusters returns the number of clusters e needs in a volume with
+// the geometry g.
+func (v *volume) entryClusters(g geometry, e *entry) uint32 {
+	if !e.dir {
+		return g.clustersFor(e.size)
+	}
+	if e == v.root && g.rootSectors > 0 {
+		return 0 // in the fixed root directory region
+	}
+	return max(1, g.clustersFor(int64(dirEntries(g.fat, e, e == v.root)*dirEntrySize)))
+}
+
+// dirEntries returns the number of directory entries of a directory.
+func dirEntries(t FATType, d *entry, root bool) int {
+	if t == ExFAT {
+		n := 0
+		if root {
+			n = 3 // volume label, allocation bitmap and up-case table
+		}
+		for _, c := range d.children {
+			n += exfatEntrySetSize(c.name)
+		}
+		return n
+	}
+	n := 2 // ".", ".." or volume label
+	for _, c := range d.children {
+		n++
+		if c.lfn {
+			n += lfnEntries(c.name)
+		}
+	}
+	return n
+}
+
+// dataOffset returns the byte offset of the first data cluster.
+func (v *volume) dataOffset() int64 {
+	return int64(v.start+v.dataSector()) * SECTOR_SIZE
+}
+
+// clusterOffset returns the byte offset of the given cluster.
+func (v *volume) clusterOffset(cluster uint32) int64 {
+	return v.dataOffset() + int64(cluster-firstCluster)*v.clusterSize()
+}
+
+// Size returns the size of the disk in bytes.
+func (v *volume) Size() int64 {
+	return int64(v.totalSectors) * SECTOR_SIZE
+}
+
+// shortNames returns whether entries have 8.3 names, which exFAT lacks.
+func (v *volume) shortNames() bool {
+	return v.fat != ExFAT || v.shortOnly
+}
+
+// allocate lays out the entry tree and renders the metadata.
+//
+// Entries keep the clusters they were given by earlier calls whenever
+// they still fit, so that files don't move while a host may be reading
+// them. New entries, and directories that outgrow their clusters, are
+// given the first free run of clusters large enough to hold them,
+// reusing the space of removed entries.
+func (v *volume) allocate() error {
+	type need struct {
+		e *entry
+		n uint32
+	}
+	var needs []need
+	for _, e := range v.system {
+		needs = append(needs, need{e, v.clustersFor(e.size)})
+	}
+	var walk func(e *entry) error
+	walk = func(e *entry) error {
+		if e.dir && v.shortNames() {
+			shortAliases(e, v.shortOnly)
+		}
+		if !e.dir && v.fat != ExFAT && e.size > maxFATFileSize {
+			return fmt.Errorf("%v is too large for %v", e.name, v.fat)
+		}
+		if e == v.root && v.rootSectors > 0 && dirEntries(v.fat, e, true) > rootEntries {
+			return fmt.Errorf("too many files in the root directory")
+		}
+		needs = append(needs, need{e, v.entryClusters(v.geometry, e)})
+		for _, c := range e.children {
+			if err := walk(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(v.root); err != nil {
+		return err
+	}
+
+	placed := make([]*entry, 0, len(needs))
+	var pending []need
+	for _, nd := range needs {
+		switch {
+		case nd.n == 0:
+			nd.e.cluster, nd.e.clusters = 0, 0
+		case nd.e.cluster != 0 && nd.n <= nd.e.clusters:
+			nd.e.clusters = nd.n
+			placed = append(placed, nd.e)
+		default:
+			pending = append(pending, nd)
+		}
+	}
+	sortByCluster(placed)
+
+	for _, nd := range pending {
+		start, ok := v.findFree(placed, nd.e.cluster, nd.n)
+		if !ok {
+			return v.noSpace(placed, nd.e, nd.n)
+		}
+		nd.e.cluster, nd.e.clusters = start, nd.n
+		placed = append(placed, nd.e)
+		sortByCluster(placed)
+	}
+	v.buildExtents(placed)
+
+	used := uint32(0)
+	for _, e := range placed {
+		used += e.clusters
+	}
+	v.freeClusters = v.clusterCount - used
+	next, ok := v.findFree(placed, 0, 1)
+	if !ok {
+		next = 0xFFFFFFFF // unknown
+	}
+	v.nextFree = next
+	v.render()
+	return nil
+}
+
+// assignShortNames assigns 8.3 aliases throughout the tree. Names are
+// final once assigned, since entries keep their aliases.
+func (v *volume) assignShortNames() {
+	var walk func(e *entry)
+	walk = func(e *entry) {
+		if e.dir {
+			shortAliases(e, v.shortOnly)
+			for _, c := range e.children {
+				walk(c)
+			}
+		}
+	}
+	if v.shortNames() {
+		walk(v.root)
+	}
+}
+
+func sortByCluster(entries []*entry) {
+	slices.SortFunc(entries, func(a, b *entry) int {
+		return cmp.Compare(a.cluster, b.cluster)
+	})
+}
+
+// findFree finds n free clusters between the allocated entries, which
+// must be ordered by cluster. If possible, the clusters start at hint,
+// so that an entry can grow in place. Otherwise the first free run
+// large enough is used.
+func (v *volume) findFree(allocated []*entry, hint, n uint32) (uint32, bool) {
+	end := firstCluster + v.clusterCount
+	if hint >= firstCluster && hint+n <= end {
+		free := true
+		for _, e := range allocated {
+			if e.cluster < hint+n && hint < e.cluster+e.clusters {
+				free = false
+				break
+			}
+		}
+		if free {
+			return hint, true
+		}
+	}
+
+	next := uint32(firstCluster)
+	for _, e := range allocated {
+		if e.cluster >= next+n {
+			return next, true
+		}
+		next = max(next, e.cluster+e.clusters)
+	}
+	if next+n <= end {
+		return next, true
+	}
+	return 0, false
+}
+
+// noSpace returns the error for an entry which needs n clusters that
+// can't be found in one run, distinguishing a disk that's full from one
+// whose free space is split between the allocated entries.
+func (v *volume) noSpace(allocated []*entry, e *entry, n uint32) error {
+	free := v.clusterCount
+	for _, a := range allocated {
+		free -= a.clusters
+	}
+	if free < n {
+		return fmt.Errorf("not enough space on disk for %v", e.name)
+	}
+	return fmt.Errorf("not enough contiguous space on disk for %v: it needs %v clusters in a row, "+
+		"and the %v free clusters are split between other files", e.name, n, free)
+}
+
+// fatEOC returns the FAT entry that ends a cluster chain.
+func (v *volume) fatEOC() uint32 {
+	switch v.fat {
+	case FAT12:
+		return 0xFFF
+	case FAT16:
+		return 0xFFFF
+	case ExFAT:
+		return 0xFFFFFFFF
+	}
+	return 0x0FFFFFFF
+}
+
+// fatEntry returns the value of the FAT for the given cluster.
+func (v *volume) fatEntry(cluster uint32, c *cursor) uint32 {
+	switch {
+	case cluster == 0:
+		if v.fat == ExFAT {
+			return 0xFFFFFFF8
+		}
+		// the media type, with the remaining bits set
+		return v.fatEOC()&^0xFF | mediaFixedDisk
+	case cluster == 1:
+		return v.fatEOC()
+	case cluster >= firstCluster+v.clusterCount:
+		return fatFree
+	}
+	e := v.owner(cluster, c)
+	if e == nil {
+		return fatFree
+	}
+	if cluster == e.cluster+e.clusters-1 {
+		return v.fatEOC()
+	}
+	return cluster + 1
+}
+
+// fatSector returns sector i of the FAT.
+func (v *volume) fatSector(i int64) []byte {
+	b := make([]byte, SECTOR_SIZE)
+	var c cursor
+	switch v.fat {
+	case FAT12:
+		// entries are packed in 1.5 bytes, and may straddle sectors
+		off := i * SECTOR_SIZE
+		or := func(pos int64, x byte) {
+			if pos >= off && pos < off+SECTOR_SIZE {
+				b[pos-off] |= x
+			}
+		}
+		for n := uint32(max(0, off*2/3-1)); int64(n)*3/2 < off+SECTOR_SIZE; n++ {
+			e, pos := v.fatEntry(n, &c), int64(n)*3/2
+			if n%2 == 0 {
+				or(pos, byte(e))
+				or(pos+1, byte(e>>8)&0x0F)
+			} else {
+				or(pos, byte(e<<4))
+				or(pos+1, byte(e>>4))
+			}
+		}
+	case FAT16:
+		first := uint32(i * SECTOR_SIZE / 2)
+		for n := range uint32(SECTOR_SIZE / 2) {
+			binary.LittleEndian.PutUint16(b[n*2:], uint16(v.fatEntry(first+n, &c)))
+		}
+	default:
+		first := uint32(i * SECTOR_SIZE / 4)
+		for n := range uint32(SECTOR_SIZE / 4) {
+			binary.LittleEndian.PutUint32(b[n*4:], v.fatEntry(first+n, &c))
+		}
+	}
+	return b
+}
+
+// render computes the fixed metadata sectors and directory contents.
+func (v *volume) render() {
+	if !v.superfloppy {
+		v.mbr = v.renderMBR()
+	}
+	if v.fat == ExFAT {
+		v.renderExFAT()
+	} else {
+		v.bootSect = v.renderBootSector()
+		v.fsInfo = v.renderFSInfo()
+	}
+
+	var walk func(e *entry)
+	walk = func(e *entry) {
+		if !e.dir {
+			return
+		}
+		if v.fat == ExFAT {
+			e.data = v.renderExFATDir(e)
+		} else {
+			e.data = v.renderDir(e)
+		}
+		for _, c := range e.children {
+			walk(c)
+		}
+	}
+	walk(v.root)
+}
+
+func (v *volume) renderMBR() []byte {
+	b := make([]byte, SECTOR_SIZE)
+	binary.LittleEndian.PutUint32(b[440:], v.serial) // disk signature
+	p := b[446:]
+	p[0] = 0x00                            // not bootable
+	copy(p[1:4], []byte{0xFE, 0xFF, 0xFF}) // CHS unused, LBA only
+	switch v.fat {
+	case FAT12:
+		p[4] = partitionTypeFAT12
+	case FAT16:
+		p[4] = partitionTypeFAT16LBA
+	case FAT32:
+		p[4] = partitionTypeFAT32LBA
+	case ExFAT:
+		p[4] = partitionTypeExFAT
+	}
+	copy(p[5:8], []byte{0xFE, 0xFF, 0xFF})
+	binary.LittleEndian.PutUint32(p[8:], v.start)
+	binary.LittleEndian.PutUint32(p[12:], v.partSectors)
+	b[510], b[511] = 0x55, 0xAA
+	return b
+}
+
+func (v *volume) renderBootSector() []byte {
+	b := make([]byte, SECTOR_SIZE)
+	copy(b[0:], []byte{0xEB, 0x58, 0x90})
+	copy(b[3:11], "MSWIN4.1")
+	binary.LittleEndian.PutUint16(b[11:], SECTOR_SIZE)
+	b[13] = byte(v.sectorsPerCluster)
+	binary.LittleEndian.PutUint16(b[14:], uint16(v.reservedSectors))
+	b[16] = byte(v.fatCount)
+	b[21] = mediaFixedDisk
+	binary.LittleEndian.PutUint16(b[24:], 63)  // sectors per track
+	binary.LittleEndian.PutUint16(b[26:], 255) // heads
+	binary.LittleEndian.PutUint32(b[28:], v.start)
+	ext := b[64:] // extended BPB
+	if v.fat == FAT32 {
+		binary.LittleEndian.PutUint32(b[32:], v.partSectors)
+		binary.LittleEndian.PutUint32(b[36:], v.fatSectors)
+		binary.LittleEndian.PutUint32(b[44:], v.root.cluster)
+		binary.LittleEndian.PutUint16(b[48:], fsInfoSector)
+		binary.LittleEndian.PutUint16(b[50:], backupBootSector)
+	} else {
+		b[1] = 0x3C // jump over the shorter BPB
+		binary.LittleEndian.PutUint16(b[17:], rootEntries)
+		if v.partSectors < 0x10000 {
+			binary.LittleEndian.PutUint16(b[19:], uint16(v.partSectors))
+		} else {
+			binary.LittleEndian.PutUint32(b[32:], v.partSectors)
+		}
+		binary.LittleEndian.PutUint16(b[22:], uint16(v.fatSectors))
+		ext = b[36:]
+	}
+	ext[0] = 0x80 // drive number
+	ext[2] = 0x29 // extended boot signature
+	binary.LittleEndian.PutUint32(ext[3:], v.serial)
+	copy(ext[7:18], padName(v.label, 11))
+	copy(ext[18:26], padName(v.fat.String(), 8))
+	b[510], b[511] = 0x55, 0xAA
+	return b
+}
+
+func (v *volume) renderFSInfo() []byte {
+	b := make([]byte, SECTOR_SIZE)
+	binary.LittleEndian.PutUint32(b[0:], 0x41615252)
+	binary.LittleEndian.PutUint32(b[484:], 0x61417272)
+	binary.LittleEndian.PutUint32(b[488:], v.freeClusters)
+	binary.LittleEndian.PutUint32(b[492:], v.nextFree)
+	binary.LittleEndian.PutUint32(b[508:], 0xAA550000)
+	return b
+}
+
+// dirSize returns the size in bytes of the space allocated to a
+// directory.
+func (v *volume) dirSize(d *entry) int64 {
+	if d == v.root && v.rootSectors > 0 {
+		return int64(v.rootSectors) * SECTOR_SIZE
+	}
+	return int64(d.clusters) * v.clusterSize()
+}
+
+// renderDir computes the directory entries of a directory.
+func (v *volume) renderDir(d *entry) []byte {
+	b := make([]byte, v.dirSize(d))
+	i := 0
+	put := func(name string, attr byte, e *entry) {
+		ent := b[i*dirEntrySize : (i+1)*dirEntrySize]
+		copy(ent[0:11], name)
+		ent[11] = attr
+		date, tm := dosTime(e.modTime)
+		binary.LittleEndian.PutUint16(ent[14:], tm)   // creation time
+		binary.LittleEndian.PutUint16(ent[16:], date) // creation date
+		binary.LittleEndian.PutUint16(ent[18:], date) // last access date
+		binary.LittleEndian.PutUint16(ent[22:], tm)   // modification time
+		binary.LittleEndian.PutUint16(ent[24:], date) // modification date
+		if e != v.root && attr != attrVolumeLabel {
+			binary.LittleEndian.PutUint16(ent[20:], uint16(e.cluster>>16))
+			binary.LittleEndian.PutUint16(ent[26:], uint16(e.cluster))
+		}
+		if !e.dir {
+			binary.LittleEndian.PutUint32(ent[28:], uint32(e.size))
+		}
+		i++
+	}
+
+	if d == v.root {
+		put(padName(v.label, 11), attrVolumeLabel, d)
+	} else {
+		put(".          ", attrDirectory, d)
+		put("..         ", attrDirectory, d.parent)
+	}
+	for _, c := range d.children {
+		attr := byte(attrArchive)
+		if c.dir {
+			attr = attrDirectory
+		}
+		if c.lfn {
+			i += copy(b[i*dirEntrySize:], appendLFN(nil, c.name, c.short)) / dirEntrySize
+		}
+		put(c.short, attr, c)
+	}
+	return b
+}
+
+func padName(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s + strings.Repeat(" ", n-len(s))
+}
+
+// dosTime encodes a time in the FAT date and time format, which has
+// 2 second resolution and can't represent times before 1980.
+func dosTime(t time.Time) (date, tm uint16) {
+	if t.Year() < 1980 {
+		return 1<<5 | 1, 0 // 1980-01-01 00:00:00
+	}
+	date = uint16(t.Year()-1980)<<9 | uint16(t.Month())<<5 | uint16(t.Day())
+	tm = uint16(t.Hour())<<11 | uint16(t.Minute())<<5 | uint16(t.Second()/2)
+	return
+}
+
+// readRegion reads from the disk at off, stopping at the end of p or at
+// the boundary of a region: the metadata before the data clusters, a
+// directory, a file or a run of free clusters. The cursor speeds up
+// sequential reads.
+func (v *volume) readRegion(p []byte, off int64, c *cursor) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset")
+	}
+	if off >= v.Size() {
+		return 0, io.EOF
+	}
+	p = p[:min(int64(len(p)), v.Size()-off)]
+
+	dataStart := v.dataOffset()
+	if off < dataStart {
+		p = p[:min(int64(len(p)), dataStart-off)]
+		n := 0
+		for n < len(p) {
+			pos := off + int64(n)
+			n += copy(p[n:], v.sector(pos / SECTOR_SIZE)[pos%SECTOR_SIZE:])
+		}
+		return n, nil
+	}
+
+	i, ok := v.extents.find(off/SECTOR_SIZE, c)
+	if !ok {
+		// free space reads as zeros up to the next allocated cluster
+		end := v.Size()
+		if i < len(v.extents) {
+			end = v.extents[i].lba * SECTOR_SIZE
+		}
+		p = p[:min(int64(len(p)), end-off)]
+		clear(p)
+		return len(p), nil
+	}
+
+	x := v.extents[i]
+	start := x.lba * SECTOR_SIZE
+	p = p[:min(int64(len(p)), x.end()*SECTOR_SIZE-off)]
+	if x.e.dir {
+		return copy(p, x.e.data[x.off+off-start:]), nil
+	}
+	return x.e.readAt(p, x.off+off-start)
+}
+
+// region describes the part of the disk holding the sector lba: "mbr",
+// "unused" before the partition, "boot", "fat", "root" for the fixed
+// root directory of FAT12 and FAT16, "free", or the path of a file or
+// directory.
+func (v *volume) region(lba int64) string {
+	if lba == 0 && !v.superfloppy {
+		return "mbr"
+	}
+	s := lba - int64(v.start)
+	fatStart := int64(v.reservedSectors)
+	rootStart := fatStart + int64(v.fatCount*v.fatSectors)
+	switch {
+	case s < 0:
+		return "unused"
+	case s < fatStart:
+		return "boot"
+	case s < rootStart:
+		return "fat"
+	case s < int64(v.dataSector()):
+		return "root"
+	}
+	var c cursor
+	i, ok := v.extents.find(lba, &c)
+	if !ok {
+		return "free"
+	}
+	e := v.extents[i].e
+	if e.parent == nil && e != v.root {
+		// the exFAT allocation bitmap and up-case table
+		return e.name
+	}
+	return "/" + relativePath(v.root, e, false)
+}
+
+// ReadAt implements io.ReaderAt over the whole disk.
+func (v *volume) ReadAt(p []byte, off int64) (n int, err error) {
+	var c cursor
+	for n < len(p) {
+		nn, err := v.readRegion(p[n:], off+int64(n), &c)
+		n += nn
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// sector returns the contents of a sector before the data region.
+func (v *volume) sector(lba int64) []byte {
+	if lba == 0 && !v.superfloppy {
+		return v.mbr
+	}
+	s := lba - int64(v.start)
+	fatStart := int64(v.reservedSectors)
+	rootStart := fatStart + int64(v.fatCount*v.fatSectors)
+	switch {
+	case s < 0:
+		return zeroSector
+	case v.fat == ExFAT && s < fatStart:
+		return v.exfatBootSector(s)
+	case s == 0, v.fat == FAT32 && s == backupBootSector:
+		return v.bootSect
+	case v.fat == FAT32 && (s == fsInfoSector || s == backupBootSector+fsInfoSector):
+		return v.fsInfo
+	case s < fatStart:
+		return zeroSector
+	case s >= rootStart:
+		// the fixed root directory of FAT12 and FAT16
+		return v.root.data[(s-rootStart)*SECTOR_SIZE:][:SECTOR_SIZE]
+	}
+
+	// all copies of the FAT are identical
+	return v.fatSector((s - fatStart) % int64(v.fatSectors))
+}
+
+var zeroSector = make([]byte, SECTOR_SIZE)
+
+// readAt reads file data at off, which may extend into the slack
+// space of the last cluster. Data past the end of the file, or missing
+// from the source, reads as zeros.
+func (e *entry) readAt(p []byte, off int64) (int, error) {
+	n := 0
+	if hl := int64(len(e.header)); off < hl {
+		n = copy(p, e.header[off:])
+	}
+	if pos := off + int64(n) - int64(len(e.header)); e.src != nil && pos < e.size-int64(len(e.header)) && n < len(p) {
+		want := p[n:min(int64(len(p)), e.size-off)]
+		e.srcMu.Lock()
+		defer e.srcMu.Unlock()
+		if _, err := e.src.Seek(pos, io.SeekStart); err != nil {
+			return n, err
+		}
+		nn, err := io.ReadFull(e.src, want)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return n + nn, err
+		}
+		n += nn
+	}
+	clear(p[n:])
+	return len(p), nil
+}
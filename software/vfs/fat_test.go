@@ -0,0 +1,249 @@
+package vfs
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/diskfs/go-diskfs"
+	"github.com/diskfs/go-diskfs/backend/file"
+	"github.com/diskfs/go-diskfs/filesystem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testTime is used as the creation time for reproducible images
+var testTime = time.Date(2025, 8, 1, 12, 30, 0, 0, time.UTC)
+
+func createAt(t *testing.T, tm time.Time) *Filesystem {
+	fsys, err := create(Options{Time: tm})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fsys
+}
+
+// imageFile adapts a Filesystem's reader to the file interface
+// go-diskfs expects, so that go-diskfs can be used as an independent
+// parser of the synthesized image.
+type imageFile struct {
+	*vfsReader
+}
+
+func (f imageFile) Stat() (fs.FileInfo, error) {
+	return imageInfo{size: f.f.vol.Size()}, nil
+}
+
+func (f imageFile) Close() error { return nil }
+
+type imageInfo struct {
+	size int64
+}
+
+func (i imageInfo) Name() string       { return "disk.img" }
+func (i imageInfo) Size() int64        { return i.size }
+func (i imageInfo) Mode() fs.FileMode  { return 0444 }
+func (i imageInfo) ModTime() time.Time { return time.Time{} }
+func (i imageInfo) IsDir() bool        { return false }
+func (i imageInfo) Sys() any           { return nil }
+
+// parseImage opens the first partition of the image with go-diskfs, or
+// the whole disk if it's a superfloppy.
+func parseImage(t *testing.T, fsys *Filesystem) filesystem.FileSystem {
+	dsk, err := diskfs.OpenBackend(file.New(imageFile{&vfsReader{f: fsys}}, true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	partition := 1
+	if fsys.Layout().Superfloppy {
+		partition = 0
+	}
+	pfs, err := dsk.GetFilesystem(partition)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pfs
+}
+
+func TestImageGeometry(t *testing.T) {
+	fsys := createAt(t, testTime)
+	vol := fsys.vol
+
+	assert.Equal(t, int64(DISK_SIZE), vol.Size())
+	mbr := make([]byte, SECTOR_SIZE)
+	_, err := vol.ReadAt(mbr, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x55, 0xAA}, mbr[510:])
+	assert.Equal(t, byte(partitionTypeFAT32LBA), mbr[446+4])
+	assert.Equal(t, uint32(partitionStart), binary.LittleEndian.Uint32(mbr[446+8:]))
+	assert.Equal(t, vol.totalSectors-partitionStart, binary.LittleEndian.Uint32(mbr[446+12:]))
+
+	// the FAT must be large enough to hold every cluster
+	assert.GreaterOrEqual(t, vol.fatSectors*SECTOR_SIZE/4, vol.clusterCount+firstCluster)
+	// and the data region must fit in the partition
+	dataEnd := vol.clusterOffset(firstCluster + vol.clusterCount)
+	assert.LessOrEqual(t, dataEnd, vol.Size())
+
+	// both copies of the FAT and the boot sector are identical
+	fat1 := make([]byte, SECTOR_SIZE)
+	fat2 := make([]byte, SECTOR_SIZE)
+	vol.ReadAt(fat1, int64(partitionStart+vol.reservedSectors)*SECTOR_SIZE)
+	vol.ReadAt(fat2, int64(partitionStart+vol.reservedSectors+vol.fatSectors)*SECTOR_SIZE)
+	assert.Equal(t, fat1, fat2)
+	assert.Equal(t, uint32(0x0FFFFFFF), binary.LittleEndian.Uint32(fat1[firstCluster*4:]))
+}
+
+func TestDOSTime(t *testing.T) {
+	date, tm := dosTime(time.Date(2025, 8, 1, 12, 30, 15, 0, time.UTC))
+	assert.Equal(t, uint16(45<<9|8<<5|1), date)
+	assert.Equal(t, uint16(12<<11|30<<5|7), tm)
+
+	date, tm = dosTime(time.Time{})
+	assert.Equal(t, uint16(1<<5|1), date)
+	assert.Equal(t, uint16(0), tm)
+}
+
+func TestImageParses(t *testing.T) {
+	fsys := createAt(t, testTime)
+	defer fsys.Close()
+
+	err := fsys.LoadCD(CHRONIC_TOWN)
+	assert.NoError(t, err)
+
+	violations, err := fsys.Verify()
+	assert.NoError(t, err)
+	assert.Empty(t, violations)
+
+	pfs := parseImage(t, fsys)
+	// go-diskfs reads the label as an 8.3 name, trimming the base name
+	assert.Equal(t, "CHRONICTOW", pfs.Label())
+
+	root, err := pfs.ReadDir("/")
+	assert.NoError(t, err)
+	assert.Len(t, root, 1)
+	assert.Equal(t, "R.E.M. - Chronic Town", root[0].Name())
+	assert.True(t, root[0].IsDir())
+
+	files, err := pfs.ReadDir("/R.E.M. - Chronic Town")
+	assert.NoError(t, err)
+	// skip "." and ".."
+	files = files[2:]
+	assert.Len(t, files, len(CHRONIC_TOWN.Tracks))
+	for i, fi := range files {
+		path, _ := fsys.trackPath(CHRONIC_TOWN, i)
+		assert.Equal(t, path, "/R.E.M. - Chronic Town/"+fi.Name())
+		assert.Equal(t, trackSizeBytes(CHRONIC_TOWN, i), fi.Size())
+		assert.Equal(t, testTime, fi.ModTime().UTC())
+	}
+}
+
+// readSparse reads a reference image stored as a gzipped list of
+// non-zero sectors: a little-endian uint32 LBA followed by the sector.
+func readSparse(r io.Reader) (map[uint32][]byte, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	sectors := make(map[uint32][]byte)
+	for {
+		var lba uint32
+		err := binary.Read(zr, binary.LittleEndian, &lba)
+		if err == io.EOF {
+			return sectors, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		b := make([]byte, SECTOR_SIZE)
+		if _, err := io.ReadFull(zr, b); err != nil {
+			return nil, err
+		}
+		sectors[lba] = b
+	}
+}
+
+// openReference opens a reference image stored by readSparse with
+// go-diskfs, from a sparse copy in a temporary file.
+func openReference(t *testing.T, name string) filesystem.FileSystem {
+	in, err := os.Open(name)
+	require.NoError(t, err)
+	defer in.Close()
+	sectors, err := readSparse(in)
+	require.NoError(t, err)
+
+	img, err := os.Create(filepath.Join(t.TempDir(), "reference.img"))
+	require.NoError(t, err)
+	t.Cleanup(func() { img.Close() })
+	// the size of the filesystem is in its boot sector
+	size := int64(binary.LittleEndian.Uint32(sectors[0][32:])) * SECTOR_SIZE
+	require.NoError(t, img.Truncate(size))
+	for lba, s := range sectors {
+		_, err := img.WriteAt(s, int64(lba)*SECTOR_SIZE)
+		require.NoError(t, err)
+	}
+
+	dsk, err := diskfs.OpenBackend(file.New(img, true))
+	require.NoError(t, err)
+	pfs, err := dsk.GetFilesystem(0)
+	require.NoError(t, err)
+	return pfs
+}
+
+// imageTree returns a hash of the contents of every file of a parsed
+// image, by path. Directories end in a slash and have no hash.
+func imageTree(t *testing.T, pfs filesystem.FileSystem) map[string]string {
+	tree := make(map[string]string)
+	var walk func(dir string)
+	walk = func(dir string) {
+		files, err := pfs.ReadDir(dir)
+		require.NoError(t, err)
+		for _, fi := range files {
+			if fi.Name() == "." || fi.Name() == ".." {
+				continue
+			}
+			name := path.Join(dir, fi.Name())
+			if fi.IsDir() {
+				tree[name+"/"] = ""
+				walk(name)
+				continue
+			}
+			sum := sha256.Sum256([]byte(readImageFile(t, pfs, name)))
+			tree[name] = hex.EncodeToString(sum[:])
+		}
+	}
+	walk("/")
+	return tree
+}
+
+// TestReferenceImage compares the files of the synthesized image with
+// those of a reference image built by go-diskfs, see testdata/readme.md.
+func TestReferenceImage(t *testing.T) {
+	fsys := createAt(t, testTime)
+	defer fsys.Close()
+	require.NoError(t, fsys.LoadCD(CHRONIC_TOWN))
+
+	ref := openReference(t, "testdata/chronic_town.img.gz")
+	pfs := parseImage(t, fsys)
+	assert.Equal(t, ref.Label(), pfs.Label())
+	assert.Equal(t, imageTree(t, ref), imageTree(t, pfs))
+}
+
+func BenchmarkCreate(b *testing.B) {
+	for range b.N {
+		fsys, err := Create()
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := fsys.LoadCD(CHRONIC_TOWN); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -1,274 +1,499 @@
 package vfs
 
 import (
+	"encoding/binary"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"os"
 	"strings"
+	"sync"
+	"text/template"
+	"time"
 
-	"github.com/diskfs/go-diskfs"
-	"github.com/diskfs/go-diskfs/disk"
-	"github.com/diskfs/go-diskfs/filesystem"
-	"github.com/diskfs/go-diskfs/filesystem/fat32"
-	"github.com/diskfs/go-diskfs/partition/mbr"
+	"github.com/rabidaudio/cdz-nuts/audiocd/redbook"
+	"github.com/rabidaudio/cdz-nuts/mp3"
 )
 
+// Track is a track on the CD. The ReadSeeker supplies the raw PCM
+// data (44.1KHz stereo 16-bit little-endian), which is served after a
+// generated WAV header, or encoded as MP3, depending on the [Profile].
 type Track struct {
 	io.ReadSeeker
-	Filename     string
-	LengthFrames uint
+	Filename      string
+	LengthSectors int // length of the track in CD sectors of 2352 bytes
+	// Optional sector the track starts at on the disc, from its table of
+	// contents, used for the CD's [CD.DiscID].
+	StartSector int
+	// Optional metadata. If Artist is empty, the CD's Artist is used.
+	Title  string
+	Artist string
 }
 
 type CD struct {
 	Name   string
 	Tracks []Track
+	// Optional data tracks of the disc. They aren't served, but their
+	// StartSector and LengthSectors count towards the [CD.DiscID].
+	DataTracks []Track
+	// Optional album metadata, written to track tags.
+	Title  string
+	Artist string
+	// Optional cover image in JPEG, PNG or GIF format, such as from
+	// [ReadCover]. It's scaled to fit the profile's CoverSize and
+	// written to the album directory and track tags.
+	Cover []byte
+	// If WholeDisc, the CD is served as a single WAV file of every track
+	// in order, with a cue sheet marking where each begins, rather than
+	// as a file for each track. Many players leave a gap between files,
+	// which spoils gapless albums and live recordings. It needs the WAV
+	// format.
+	WholeDisc bool
 }
 
-const DISK_SIZE = 700 * fat32.MB
+const DISK_SIZE = 700 * 1024 * 1024
 const SECTOR_SIZE = 512
 
-// Filesystem represents a virtual FAT32 filesystem containing WAV files
-// corresponding to the tracks on the CD.
+// Filesystem represents a virtual FAT filesystem containing WAV or MP3
+// files corresponding to the tracks of a library of CDs, each in its own
+// directory.
+//
+// The disk image is never stored. Every sector is computed on demand
+// from the CDs, with track data read from the tracks.
+//
+// A Filesystem is safe for concurrent use.
 type Filesystem struct {
-	fs      filesystem.FileSystem
-	Path    string
-	cd      *CD
-	closefn func() error
-}
-
-// sanitizeName takes a file name and converts it to DOS format
-// by uppercasing, limiting to ASCII letters, and triming to 8 chars
-func sanitizeName(name string) string {
-	// https://en.wikipedia.org/wiki/8.3_filename
-	newName := make([]rune, 0, 8)
-	for _, r := range strings.ToUpper(name) {
-		if len(newName) == 8 {
-			break
-		}
-		if r >= 'A' && r <= 'Z' {
-			newName = append(newName, r)
-		}
+	mu         sync.RWMutex // guards the files and the volume
+	vol        *volume
+	layout     Layout
+	albums     []*album
+	now        func() time.Time
+	opts       Options // as given, before defaults
+	trackTmpl  *template.Template
+	profile    Profile
+	artistDirs bool
+
+	playlists    []Playlist
+	virtualFiles []*entry // files of the virtual playlists
+
+	trace *tracer // if tracing
+
+	overlay      map[int64][]byte // sectors written by the host
+	overlayStore OverlayStore
+	overlayID    string // the disk the overlay belongs to
+}
+
+func trackDataBytes(t *Track) int64 {
+	// TODO: artifical track predelay
+	return int64(t.LengthSectors) * redbook.BytesPerSector
+}
+
+// trackTags returns the metadata of track i.
+func trackTags(cd CD, i int) Tags {
+	t := cd.Tracks[i]
+	tags := Tags{
+		Title:  t.Title,
+		Artist: t.Artist,
+		Album:  cd.Title,
+		Track:  i + 1,
+		Tracks: len(cd.Tracks),
+		Cover:  cd.Cover,
+	}
+	if tags.Artist == "" {
+		tags.Artist = cd.Artist
 	}
-	return string(newName)
+	return tags
 }
 
-func trackSizeBytes(t *Track) int64 {
-	// TODO: include metadata, artifical track predelay
-	// 6 samples per channel per frame, 16 bits per sample plus 44 header
-	return int64(t.LengthFrames*6*2) + 44
+// trackHeader returns the WAV header of track i.
+func trackHeader(cd CD, i int) []byte {
+	return wavHeader(trackDataBytes(&cd.Tracks[i]), trackTags(cd, i), nil)
 }
 
-// Create a new filesystem instance. Data is backed by a temporary file.
+// trackSizeBytes returns the size of the WAV file of track i.
+func trackSizeBytes(cd CD, i int) int64 {
+	return int64(len(trackHeader(cd, i))) + trackDataBytes(&cd.Tracks[i])
+}
+
+// Create a new filesystem instance.
 // Be sure to Close() the Filesystem after use.
 func Create() (*Filesystem, error) {
-	// Setup a file in the tmp directory to be a virtual filesystem
-	tmpdir, err := os.MkdirTemp("", "carcd")
-	if err != nil {
-		return nil, err
+	return create(Options{})
+}
+
+// DefaultLabel is the volume label used if none is given.
+const DefaultLabel = "VIRTUALCD"
+
+// Options configure a filesystem created with [CreateWith]. The zero
+// value creates the same filesystem as [Create].
+//
+// Setting Time makes the image reproducible: the same options, CDs and
+// changes always give the same image, byte for byte.
+type Options struct {
+	// Time is the creation time of the volume and the modification time
+	// of every file. If zero, the current time is used, so files are
+	// dated when their CD is loaded.
+	Time time.Time
+	// Serial is the volume serial number. If zero, it's derived from
+	// the disc IDs of the loaded CDs, so that it's the same whenever the
+	// same CDs are loaded, or from the creation time if there are none.
+	Serial uint32
+	// Label is the volume label, of at most 11 characters. If empty,
+	// it's the title of the CD while only one is loaded, and
+	// [DefaultLabel] otherwise.
+	Label string
+}
+
+// CreateWith creates a new filesystem with the given options.
+// Be sure to Close() the Filesystem after use.
+func CreateWith(opts Options) (*Filesystem, error) {
+	return create(opts)
+}
+
+func create(opts Options) (*Filesystem, error) {
+	now := time.Now
+	if !opts.Time.IsZero() {
+		now = func() time.Time { return opts.Time }
 	}
-	dskimg := tmpdir + "/disk.img"
-	dsk, err := diskfs.Create(dskimg, DISK_SIZE, diskfs.SectorSizeDefault)
-	if err != nil {
-		return nil, err
+	if len([]rune(opts.Label)) > 11 {
+		return nil, fmt.Errorf("volume label %q is longer than 11 characters", opts.Label)
 	}
-
-	// create an MBR with one partition
-	table := &mbr.Table{
-		LogicalSectorSize:  SECTOR_SIZE,
-		PhysicalSectorSize: SECTOR_SIZE,
-		Partitions: []*mbr.Partition{
-			{
-				Bootable: false,
-				Type:     mbr.Linux,
-				Start:    0,
-				Size:     uint32(DISK_SIZE) / SECTOR_SIZE,
-			},
-		},
-	}
-	err = dsk.Partition(table)
+	f := &Filesystem{layout: DefaultLayout, now: now, opts: opts, profile: ProfileDefault}
+	created := now()
+	label, serial := f.volumeID(created)
+	vol, err := newVolume(DefaultLayout, label, serial, created)
 	if err != nil {
-		defer os.Remove(dskimg)
 		return nil, err
 	}
-	// Create a FAT32 filesystem
-	fatfs, err := dsk.CreateFilesystem(disk.FilesystemSpec{
-		Partition:   1,
-		FSType:      filesystem.TypeFat32,
-		VolumeLabel: "VIRTUALCD",
-	})
-	if err != nil {
-		defer os.Remove(dskimg)
+	f.vol = vol
+	if err := f.SetTrackTemplate(DefaultTrackTemplate); err != nil {
 		return nil, err
 	}
+	f.overlayID = f.diskID()
+	return f, nil
+}
 
-	closefn := func() (err error) {
-		err = fatfs.Close()
-		if err != nil {
-			return err
+// volumeID returns the label and serial number of the volume, derived
+// from the loaded CDs unless they were given in the options. Some car
+// stereos remember where they were on each disk by its serial number,
+// so the serial stays the same whenever the same CDs are loaded.
+func (f *Filesystem) volumeID(created time.Time) (string, uint32) {
+	label, serial := f.opts.Label, f.opts.Serial
+	if len(f.albums) == 1 {
+		cd := f.albums[0].cd
+		if label == "" {
+			title := cd.Title
+			if title == "" {
+				title = cd.Name
+			}
+			label = volumeLabel(title)
 		}
-		err = os.Remove(dskimg)
-		if err != nil {
-			return err
+		if serial == 0 {
+			serial = cd.DiscID()
 		}
-		err = os.Remove(tmpdir)
-		if err != nil {
-			return err
+	} else if len(f.albums) > 1 && serial == 0 {
+		h := fnv.New32a()
+		for _, a := range f.albums {
+			binary.Write(h, binary.LittleEndian, a.cd.DiscID())
 		}
-		return nil
+		serial = h.Sum32()
 	}
-
-	f := Filesystem{
-		Path:    dskimg,
-		fs:      fatfs,
-		closefn: closefn,
+	if label == "" {
+		label = DefaultLabel
+	}
+	if serial == 0 {
+		// FAT filesystems conventionally use the time of creation as a volume ID
+		serial = timeSerial(created)
 	}
+	return label, serial
+}
 
-	return &f, nil
+// timeSerial returns the serial number of a volume created at t. It
+// hashes the whole time, so volumes created any time apart get
+// different serials.
+func timeSerial(t time.Time) uint32 {
+	h := fnv.New32a()
+	binary.Write(h, binary.LittleEndian, t.UnixNano())
+	return h.Sum32()
 }
 
-// Create virtual files based on the CD configuration
+// LoadCD adds the tracks of a CD to the filesystem, in a directory of
+// its own. CDs are identified by Name, which must be unique among the
+// loaded CDs.
 func (f *Filesystem) LoadCD(cd CD) (err error) {
-	if f.cd != nil {
-		return fmt.Errorf("current CD not ejected")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.album(cd.Name) != nil {
+		return fmt.Errorf("CD %q already loaded", cd.Name)
 	}
 
-	sDirName := dirName(cd)
-	if sDirName != "" {
-		err = f.fs.Mkdir(sDirName)
-		if err != nil {
+	if len(cd.Cover) > 0 && f.profile.CoverSize > 0 {
+		if cd.Cover, err = scaleCover(cd.Cover, f.profile.CoverSize); err != nil {
 			return err
 		}
+	} else {
+		cd.Cover = nil
 	}
+	if err := f.loadCD(cd); err != nil {
+		return err
+	}
+	f.traceEvent(TraceEvent{Op: TraceLoad, Album: traceAlbum(cd)})
+	return f.switchOverlay()
+}
 
-	// Open /dev/zero for reading null bytes
-	// zero, err := os.Open("/dev/zero")
-	// if err != nil {
-	// 	return fmt.Errorf("read /dev/zero: %w", err)
-	// }
-	// defer zero.Close()
-
-	for i, track := range cd.Tracks {
-		// TODO: try reading ID3 data for generating track names
-		fname, _ := trackPath(cd, i)
-		file, err := f.fs.OpenFile(fname, os.O_CREATE|os.O_RDWR)
+// loadCD adds a CD whose cover is already scaled for the profile.
+func (f *Filesystem) loadCD(cd CD) error {
+	if cd.WholeDisc && f.profile.Format != FormatWAV {
+		return fmt.Errorf("CD %q: a whole disc can only be served as WAV", cd.Name)
+	}
+	parent := f.vol.root
+	if f.artistDirs {
+		parent = f.artistDir(cd)
+	}
+	dir := &entry{name: uniqueName(parent, f.dirName(cd)), dir: true, parent: parent, modTime: f.now()}
+
+	a := &album{cd: cd, dir: dir}
+	if cd.WholeDisc {
+		a.disc = f.discFile(cd, dir)
+		dir.children = append(dir.children, a.disc)
+	} else {
+		files, err := f.trackFiles(cd, dir)
 		if err != nil {
-			return fmt.Errorf("create track %v: %w", fname, err)
+			return err
 		}
+		a.tracks = files
+		dir.children = append(dir.children, files...)
+	}
+	if cd.Cover != nil {
+		dir.children = append(dir.children, f.coverFiles(cd.Cover, dir)...)
+	}
 
-		// NOTE: rather than copy from /dev/zero, a much faster way
-		// to initialize the files is to seek the length and then write
-		// zero bytes. This is proabably an implementation quirk though
-		// so there's a test for it in case the behavior changes.
+	f.addAlbum(a)
+	// playlists and cue sheets reference the final track names
+	f.vol.assignShortNames()
+	f.albumPlaylists(a)
+	f.cueSheet(a)
+	if err := f.relayout(); err != nil {
+		f.removeAlbum(a)
+		_ = f.relayout()
+		return err
+	}
+	return nil
+}
 
-		// _, err = io.CopyN(file, zero, trackSizeBytes(&track))
-		// if err != nil {
-		// 	return fmt.Errorf("write null %v: %w", fname, err)
-		// }
+// relayout lays out the volume again after the loaded CDs or the
+// playlists change. The virtual playlists are regenerated first, and the
+// label and serial follow the CDs now loaded.
+func (f *Filesystem) relayout() error {
+	f.updatePlaylists()
+	f.vol.label, f.vol.serial = f.volumeID(f.vol.created)
+	return f.vol.allocate()
+}
 
-		_, err = file.Seek(trackSizeBytes(&track), io.SeekStart)
+// trackFiles returns the files of the tracks of a CD in dir.
+func (f *Filesystem) trackFiles(cd CD, dir *entry) ([]*entry, error) {
+	files := make([]*entry, 0, len(cd.Tracks))
+	used := make(map[string]bool, len(cd.Tracks))
+	for i := range cd.Tracks {
+		// TODO: try reading ID3 data for generating track names
+		fname, err := f.trackFileName(cd, i, used)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		_, err = file.Write([]byte{})
+		e, err := f.trackEntry(cd, i)
 		if err != nil {
+			return nil, err
+		}
+		e.name, e.parent, e.modTime, e.track = fname, dir, f.now(), true
+		files = append(files, e)
+	}
+	return files, nil
+}
+
+// trackEntry returns the file for track i in the profile's format.
+func (f *Filesystem) trackEntry(cd CD, i int) (*entry, error) {
+	track := cd.Tracks[i]
+	if f.profile.Format != FormatMP3 {
+		return &entry{
+			size:   trackSizeBytes(cd, i),
+			header: trackHeader(cd, i),
+			src:    track.ReadSeeker,
+		}, nil
+	}
+
+	pcm := track.ReadSeeker
+	if pcm == nil {
+		pcm = io.NewSectionReader(silence{}, 0, trackDataBytes(&track))
+	}
+	samples := trackDataBytes(&track) / 4
+	r, err := mp3.NewReader(pcm, samples, f.profile.bitrate())
+	if err != nil {
+		return nil, err
+	}
+	// unlike WAV files, tags are always included since players rely on
+	// them for the track number
+	header := trackTags(cd, i).ID3v2()
+	return &entry{
+		size:   int64(len(header)) + r.Size(),
+		header: header,
+		src:    r,
+	}, nil
+}
+
+// silence is the audio of tracks without a source.
+type silence struct{}
+
+func (silence) ReadAt(p []byte, off int64) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// SetProfile configures the filesystem for the host it's presented to.
+// It can't be changed while CDs are loaded.
+func (f *Filesystem) SetProfile(p Profile) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.albums) > 0 {
+		return fmt.Errorf("can't change profile while CDs are loaded")
+	}
+	if p.Format == FormatMP3 {
+		if _, err := mp3.NewEncoder(p.bitrate()); err != nil {
 			return err
 		}
 	}
-	f.cd = &cd
-	return nil
+	f.profile = p
+	f.vol.shortOnly = p.Names == NamesShort
+	f.traceEvent(TraceEvent{Op: TraceDisk, Disk: f.traceDiskInfo()})
+	return f.switchOverlay()
 }
 
-func dirName(cd CD) string {
-	sDirName := sanitizeName(cd.Name)
-	if sDirName != "" {
-		sDirName = "/" + sDirName
+// trackFileName returns the file name of track i, which is unique
+// within used. FAT names are case insensitive.
+func (f *Filesystem) trackFileName(cd CD, i int, used map[string]bool) (string, error) {
+	name, err := f.trackName(cd, i)
+	if err != nil {
+		return "", err
 	}
-	return sDirName
+	ext := f.profile.Format.ext()
+	fname := withExt(name, ext)
+	for n := 2; used[strings.ToUpper(fname)]; n++ {
+		fname = withExt(fmt.Sprintf("%v (%d)", name, n), ext)
+	}
+	used[strings.ToUpper(fname)] = true
+	return fname, nil
 }
 
-func trackPath(cd CD, i int) (string, bool) {
-	if i < 0 || i >= len(cd.Tracks) {
+// trackPath returns the path of the file for track i of a loaded CD.
+func (f *Filesystem) trackPath(cd CD, i int) (string, bool) {
+	a := f.album(cd.Name)
+	if a == nil || i < 0 || i >= len(a.tracks) {
 		return "", false
 	}
-	// t := cd.Tracks[i]
-	return fmt.Sprintf("%v/TRACK%02d.WAV", dirName(cd), i), true
+	return "/" + relativePath(f.vol.root, a.tracks[i], false), true
+}
+
+// Extent is the run of sectors a file occupies on the disk. Every file
+// is a single contiguous run of clusters, so its data is read from
+// consecutive sectors.
+type Extent struct {
+	LBA     int64 // the first sector
+	Sectors int64 // the number of sectors, including the slack after the file
+}
+
+// Offset returns the offset of the extent on the disk in bytes.
+func (x Extent) Offset() int64 {
+	return x.LBA * SECTOR_SIZE
+}
+
+// Length returns the length of the extent in bytes.
+func (x Extent) Length() int64 {
+	return x.Sectors * SECTOR_SIZE
 }
 
 type TrackRange struct {
-	FileInfo   os.FileInfo
-	DiskRanges []fat32.DiskRange
+	FileInfo os.FileInfo
+	Extent   Extent
 }
 
-// Get the block bounds over which the track files are placed
+// Get the extents of the track files, for the tracks of every loaded CD
+// in the order they were loaded. CDs loaded as a whole disc have a
+// single file.
 func (f *Filesystem) TrackRanges() ([]TrackRange, error) {
-	if f.cd == nil {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if len(f.albums) == 0 {
 		return nil, fmt.Errorf("no CD loaded")
 	}
 
-	fileInfo, err := f.fs.ReadDir(dirName(*f.cd))
-	if err != nil {
-		return nil, err
-	}
-
-	trackRanges := make([]TrackRange, len(f.cd.Tracks))
-
-	for i := range f.cd.Tracks {
-		path, ok := trackPath(*f.cd, i)
-		if !ok {
-			return nil, fmt.Errorf("invalid track index")
+	var trackRanges []TrackRange
+	for _, a := range f.albums {
+		files := a.tracks
+		if a.disc != nil {
+			files = []*entry{a.disc}
 		}
-
-		tf, err := f.fs.OpenFile(path, os.O_RDONLY)
-		if err != nil {
-			return nil, err
+		for _, e := range files {
+			trackRanges = append(trackRanges, TrackRange{
+				FileInfo: fileInfo{e},
+				Extent: Extent{
+					LBA:     f.vol.clusterOffset(e.cluster) / SECTOR_SIZE,
+					Sectors: int64(e.clusters) * f.vol.clusterSize() / SECTOR_SIZE,
+				},
+			})
 		}
-		defer tf.Close()
+	}
+	return trackRanges, nil
+}
 
-		fattf, ok := tf.(*fat32.File)
-		if !ok {
-			return nil, fmt.Errorf("not fat32 file")
-		}
-		diskRange, err := fattf.GetDiskRanges()
-		if err != nil {
-			return nil, err
-		}
-		trackRanges[i] = TrackRange{DiskRanges: diskRange}
+// fileInfo implements os.FileInfo for entries.
+type fileInfo struct {
+	e *entry
+}
 
-		for _, fi := range fileInfo {
-			if fi.IsDir() {
-				continue
-			}
-			if name, ok := trackPath(*f.cd, i); ok && strings.HasSuffix(name, fi.Name()) {
-				trackRanges[i].FileInfo = fi
-			}
-		}
-	}
+func (fi fileInfo) Name() string       { return fi.e.name }
+func (fi fileInfo) Size() int64        { return fi.e.size }
+func (fi fileInfo) ModTime() time.Time { return fi.e.modTime }
+func (fi fileInfo) IsDir() bool        { return fi.e.dir }
+func (fi fileInfo) Sys() any           { return nil }
 
-	return trackRanges, nil
+func (fi fileInfo) Mode() os.FileMode {
+	if fi.e.dir {
+		return os.ModeDir | 0555
+	}
+	return 0444
 }
 
-// Delete all files from the filesystem
-func (f *Filesystem) Eject() error {
-	if f.cd == nil {
-		return nil
+// Eject removes the CD with the given name from the filesystem. The
+// space its files used is reused by CDs loaded later, while the files of
+// other CDs stay where they are.
+func (f *Filesystem) Eject(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	a := f.album(name)
+	if a == nil {
+		return fmt.Errorf("CD %q not loaded", name)
 	}
-	for i := range f.cd.Tracks {
-		// TODO: try reading ID3 data for generating track names
-		fname, _ := trackPath(*f.cd, i)
-		err := f.fs.Remove(fname)
-		if err != nil {
-			return err
-		}
+	f.removeAlbum(a)
+	f.traceEvent(TraceEvent{Op: TraceEject, Name: name})
+	if err := f.relayout(); err != nil {
+		return err
 	}
-	err := f.fs.Remove(dirName(*f.cd))
-	if err != nil {
+	return f.switchOverlay()
+}
+
+// EjectAll removes every CD from the filesystem.
+func (f *Filesystem) EjectAll() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for len(f.albums) > 0 {
+		f.removeAlbum(f.albums[0])
+	}
+	f.traceEvent(TraceEvent{Op: TraceEject})
+	if err := f.relayout(); err != nil {
 		return err
 	}
-	f.cd = nil
-	return nil
+	return f.switchOverlay()
 }
 
 func (f *Filesystem) Close() error {
-	f.Eject()
-	return f.closefn()
+	return f.EjectAll()
 }
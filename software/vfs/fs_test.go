@@ -1,20 +1,30 @@
 package vfs
 
 import (
+	"context"
 	"io"
 	"os"
 	"testing"
+	"time"
 
+	"github.com/rabidaudio/cdz-nuts/audiocd/redbook"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestSanitizeName(t *testing.T) {
+	// names are sanitized into the basis of their 8.3 alias, which keeps
+	// digits and transliterates other characters where it can
+	sanitizeName := func(name string) string {
+		base, _, _ := basisName(name, false)
+		return base
+	}
 	assert.Equal(t, "UPCASE", sanitizeName("upcase"))
 	assert.Equal(t, "MYFILE", sanitizeName("my file"))
 	assert.Equal(t, "LIMITSLE", sanitizeName("limitslengthtoeight"))
-	assert.Equal(t, "RMVNUMR", sanitizeName("r3m0v35 num83r5"))
+	assert.Equal(t, "R3M0V35N", sanitizeName("r3m0v35 num83r5"))
 	assert.Equal(t, "", sanitizeName(""))
-	assert.Equal(t, "ILUV", sanitizeName("I luv ĀḞÍ♥︎✨ :3"))
+	assert.Equal(t, "ILUVAFI_", sanitizeName("I luv ĀḞÍ♥︎✨ :3"))
 }
 
 func TestCreate(t *testing.T) {
@@ -24,11 +34,8 @@ func TestCreate(t *testing.T) {
 	assert.NoError(t, err)
 }
 
-func secondsToFrames(min, sec int) uint {
-	// seconds times 44.1KHz = samples
-	// 6 samples * 2 channels in each 33 byte frame (after CIC)
-	samples := ((min * 60) + sec) * 44100
-	return uint(samples / 6)
+func secondsToSectors(min, sec int) int {
+	return ((min * 60) + sec) * redbook.SectorsPerSecond
 }
 
 func copyFile(srcpath, dstpath string) (err error) {
@@ -54,27 +61,34 @@ func copyFile(srcpath, dstpath string) (err error) {
 }
 
 var CHRONIC_TOWN = CD{
-	Name: "R.E.M. - Chronic Town",
+	Name:   "R.E.M. - Chronic Town",
+	Title:  "Chronic Town",
+	Artist: "R.E.M.",
 	Tracks: []Track{
 		{
-			Filename:     "Wolves, Lower",
-			LengthFrames: secondsToFrames(4, 15),
+			Filename:      "Wolves, Lower",
+			Title:         "Wolves, Lower",
+			LengthSectors: secondsToSectors(4, 15),
 		},
 		{
-			Filename:     "Gardening at Night",
-			LengthFrames: secondsToFrames(3, 30),
+			Filename:      "Gardening at Night",
+			Title:         "Gardening at Night",
+			LengthSectors: secondsToSectors(3, 30),
 		},
 		{
-			Filename:     "Carnival of Sorts (Box Cars)",
-			LengthFrames: secondsToFrames(3, 52),
+			Filename:      "Carnival of Sorts (Box Cars)",
+			Title:         "Carnival of Sorts (Box Cars)",
+			LengthSectors: secondsToSectors(3, 52),
 		},
 		{
-			Filename:     "1,000,000",
-			LengthFrames: secondsToFrames(3, 6),
+			Filename:      "1,000,000",
+			Title:         "1,000,000",
+			LengthSectors: secondsToSectors(3, 6),
 		},
 		{
-			Filename:     "Stumble",
-			LengthFrames: secondsToFrames(5, 40),
+			Filename:      "Stumble",
+			Title:         "Stumble",
+			LengthSectors: secondsToSectors(5, 40),
 		},
 	},
 }
@@ -92,8 +106,8 @@ func TestFileSize(t *testing.T) {
 	cd := CD{
 		Tracks: []Track{
 			{
-				Filename:     "Track 1",
-				LengthFrames: 1337,
+				Filename:      "Track 1",
+				LengthSectors: 1337,
 			},
 		},
 	}
@@ -105,18 +119,19 @@ func TestFileSize(t *testing.T) {
 	err = fsys.LoadCD(cd)
 	assert.NoError(t, err)
 
-	t0, err := fsys.fs.OpenFile("/TRACK00.WAV", os.O_RDONLY)
+	pfs := parseImage(t, fsys)
+	t0, err := pfs.OpenFile("/Unknown Album/01.wav", os.O_RDONLY)
 	assert.NoError(t, err)
 	defer t0.Close()
 
-	fileInfo, err := fsys.fs.ReadDir("/")
+	fileInfo, err := pfs.ReadDir("/Unknown Album")
 	assert.NoError(t, err)
 
 	found := false
 	for _, fi := range fileInfo {
-		if fi.Name() == "TRACK00.WAV" {
+		if fi.Name() == "01.wav" {
 			found = true
-			assert.Equal(t, int64(1337*6*2), fi.Size())
+			assert.Equal(t, int64(1337*redbook.BytesPerSector+WavHeaderSize), fi.Size())
 		}
 	}
 	assert.True(t, found)
@@ -135,18 +150,114 @@ func TestTrackRanges(t *testing.T) {
 
 	assert.Equal(t, len(CHRONIC_TOWN.Tracks), len(trackRanges))
 
+	var end int64
 	for i, tr := range CHRONIC_TOWN.Tracks {
-		// assert.Equal(t, i, trackRanges[i].Index)
-		// assert.Equal(t, tr, trackRanges[i].Track)
+		x := trackRanges[i].Extent
+		assert.Equal(t, x.LBA*SECTOR_SIZE, x.Offset())
+		// the extent holds the whole file, and no other
+		assert.GreaterOrEqual(t, x.Length(), int64(tr.LengthSectors*redbook.BytesPerSector))
+		assert.GreaterOrEqual(t, x.Length(), trackRanges[i].FileInfo.Size())
+		assert.Less(t, x.Length()-trackRanges[i].FileInfo.Size(), fsys.vol.clusterSize())
+		assert.GreaterOrEqual(t, x.LBA, end)
+		end = x.LBA + x.Sectors
 
-		totalSize := 0
-		for _, r := range trackRanges[i].DiskRanges {
-			// fmt.Printf("%v\t%v\t%v\n", i, r.Offset, r.Length)
-			totalSize += int(r.Length)
-		}
-		// sum of bytes should be divisible by sector size
-		assert.Equal(t, 0, totalSize%SECTOR_SIZE)
-		// total sector size should be longer than file size
-		assert.GreaterOrEqual(t, totalSize, int(tr.LengthFrames*6*2))
+		// the file starts at the first sector
+		b := make([]byte, SECTOR_SIZE)
+		require.NoError(t, fsys.ReadBlocks(context.Background(), x.LBA, b))
+		header := trackHeader(CHRONIC_TOWN, i)
+		assert.Equal(t, header, b[:len(header)])
+	}
+}
+
+func TestContiguousAllocation(t *testing.T) {
+	fsys := createAt(t, testTime)
+	defer fsys.Close()
+	require.NoError(t, fsys.SetLayout(Layout{Type: FAT16, Size: 32 * 1024 * 1024}))
+	cd := func(name string, sectors int) CD {
+		return CD{Name: name, Tracks: []Track{{LengthSectors: sectors}}}
+	}
+	// 2352 byte CD sectors, so three CDs of 4000 sectors nearly fill the disk
+	require.NoError(t, fsys.LoadCD(cd("A", 4000)))
+	require.NoError(t, fsys.LoadCD(cd("B", 4000)))
+	require.NoError(t, fsys.LoadCD(cd("C", 4000)))
+	require.NoError(t, fsys.Eject("A"))
+	require.NoError(t, fsys.Eject("C"))
+
+	// there's space for D, but not in one run
+	err := fsys.LoadCD(cd("D", 6000))
+	assert.ErrorContains(t, err, "contiguous")
+	err = fsys.LoadCD(cd("E", 12000))
+	assert.ErrorContains(t, err, "not enough space")
+	require.NoError(t, fsys.LoadCD(cd("F", 3000)))
+
+	violations, err := fsys.Verify()
+	require.NoError(t, err)
+	assert.Empty(t, violations)
+}
+
+// bootSectors returns the MBR and the boot sector of the volume.
+func bootSectors(t *testing.T, fsys *Filesystem) []byte {
+	b := make([]byte, 2*SECTOR_SIZE)
+	require.NoError(t, fsys.ReadBlocks(context.Background(), 0, b[:SECTOR_SIZE]))
+	require.NoError(t, fsys.ReadBlocks(context.Background(), int64(fsys.vol.start), b[SECTOR_SIZE:]))
+	return b
+}
+
+func TestVolumeID(t *testing.T) {
+	fsys := createAt(t, testTime)
+	defer fsys.Close()
+	require.NoError(t, fsys.LoadCD(CHRONIC_TOWN))
+	assert.Equal(t, "CHRONIC TOW", fsys.vol.label)
+	assert.Equal(t, CHRONIC_TOWN.DiscID(), fsys.vol.serial)
+
+	// the same TOC gives the same boot sector whenever it's loaded, even
+	// without the tracks' names
+	var toc CD
+	toc.Title = CHRONIC_TOWN.Title
+	for _, tr := range CHRONIC_TOWN.Tracks {
+		toc.Tracks = append(toc.Tracks, Track{LengthSectors: tr.LengthSectors})
+	}
+	later := createAt(t, testTime.Add(36*time.Hour))
+	defer later.Close()
+	require.NoError(t, later.LoadCD(toc))
+	assert.Equal(t, bootSectors(t, fsys), bootSectors(t, later))
+
+	// both CDs identify the disk while they're loaded
+	require.NoError(t, fsys.LoadCD(testDisc()))
+	assert.Equal(t, DefaultLabel, fsys.vol.label)
+	both := fsys.vol.serial
+	assert.NotEqual(t, CHRONIC_TOWN.DiscID(), both)
+	assert.NotEqual(t, testDisc().DiscID(), both)
+	require.NoError(t, fsys.Eject(CHRONIC_TOWN.Name))
+	assert.Equal(t, "TEST DISC", fsys.vol.label)
+	assert.Equal(t, testDisc().DiscID(), fsys.vol.serial)
+
+	// the identity survives relayouts
+	require.NoError(t, fsys.Fit())
+	assert.Equal(t, testDisc().DiscID(), fsys.vol.serial)
+
+	// without CDs it's from the creation time
+	require.NoError(t, fsys.EjectAll())
+	assert.Equal(t, DefaultLabel, fsys.vol.label)
+	assert.Equal(t, uint32(0xFCDA36BA), fsys.vol.serial)
+}
+
+func TestTimeSerial(t *testing.T) {
+	assert.Equal(t, uint32(0xFCDA36BA), timeSerial(testTime))
+	seen := map[uint32]time.Time{}
+	for _, d := range []time.Duration{0, 10 * time.Millisecond, time.Second, time.Minute, time.Hour, 24 * time.Hour, 365 * 24 * time.Hour} {
+		tm := testTime.Add(d)
+		serial := timeSerial(tm)
+		assert.NotContains(t, seen, serial, "%v and %v", seen[serial], tm)
+		seen[serial] = tm
 	}
 }
+
+func TestVolumeIDOptions(t *testing.T) {
+	fsys, err := CreateWith(Options{Time: testTime, Serial: 42, Label: "MY STICK"})
+	require.NoError(t, err)
+	defer fsys.Close()
+	require.NoError(t, fsys.LoadCD(CHRONIC_TOWN))
+	assert.Equal(t, "MY STICK", fsys.vol.label)
+	assert.Equal(t, uint32(42), fsys.vol.serial)
+}
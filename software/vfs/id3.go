@@ -0,0 +1,97 @@
+package vfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strconv"
+	"unicode/utf16"
+)
+
+// Tags is the metadata written to a track file, when available.
+type Tags struct {
+	Title  string
+	Artist string
+	Album  string
+	Track  int    // 1-based track number, 0 if unknown
+	Tracks int    // number of tracks on the album, 0 if unknown
+	Cover  []byte // front cover as a JPEG, nil if unknown
+}
+
+// IsEmpty reports whether there is no metadata to write.
+func (t Tags) IsEmpty() bool {
+	return t.Title == "" && t.Artist == "" && t.Album == "" && len(t.Cover) == 0
+}
+
+func (t Tags) trackNumber() string {
+	if t.Track == 0 {
+		return ""
+	}
+	if t.Tracks == 0 {
+		return strconv.Itoa(t.Track)
+	}
+	return strconv.Itoa(t.Track) + "/" + strconv.Itoa(t.Tracks)
+}
+
+// ID3v2 renders the tags as an ID3v2.3 tag, which is the most widely
+// supported version. Text that can't be represented in ISO-8859-1 is
+// encoded as UTF-16.
+//
+// See https://id3.org/id3v2.3.0
+func (t Tags) ID3v2() []byte {
+	var frames bytes.Buffer
+	frame := func(id string, body []byte) {
+		frames.WriteString(id)
+		binary.Write(&frames, binary.BigEndian, uint32(len(body)))
+		frames.Write([]byte{0, 0}) // flags
+		frames.Write(body)
+	}
+	textFrame := func(id, text string) {
+		if text != "" {
+			frame(id, id3Text(text))
+		}
+	}
+	textFrame("TIT2", t.Title)
+	textFrame("TPE1", t.Artist)
+	textFrame("TALB", t.Album)
+	textFrame("TRCK", t.trackNumber())
+	if len(t.Cover) > 0 {
+		// Latin-1 MIME type, picture type 3 (front cover), empty description
+		body := append([]byte("\x00image/jpeg\x00\x03\x00"), t.Cover...)
+		frame("APIC", body)
+	}
+
+	b := make([]byte, 10, 10+frames.Len())
+	copy(b, "ID3")
+	b[3], b[4] = 3, 0 // version 2.3.0
+	putSyncsafe(b[6:], uint32(frames.Len()))
+	return append(b, frames.Bytes()...)
+}
+
+// id3Text encodes a text frame body, including the encoding byte.
+func id3Text(s string) []byte {
+	latin1 := make([]byte, 0, len(s)+1)
+	latin1 = append(latin1, 0x00)
+	for _, r := range s {
+		if r > 0xFF {
+			// UTF-16 with byte order mark
+			u := utf16.Encode([]rune(s))
+			b := make([]byte, 0, 3+2*len(u))
+			b = append(b, 0x01, 0xFF, 0xFE)
+			for _, c := range u {
+				b = binary.LittleEndian.AppendUint16(b, c)
+			}
+			return b
+		}
+		latin1 = append(latin1, byte(r))
+	}
+	return latin1
+}
+
+// putSyncsafe writes a 28-bit integer in the ID3 synchsafe format,
+// 7 bits per byte.
+func putSyncsafe(b []byte, n uint32) {
+	b[0] = byte(n>>21) & 0x7F
+	b[1] = byte(n>>14) & 0x7F
+	b[2] = byte(n>>7) & 0x7F
+	b[3] = byte(n) & 0x7F
+}
@@ -0,0 +1,46 @@
+package vfs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestID3v2(t *testing.T) {
+	tag := Tags{Title: "Stumble", Track: 5}.ID3v2()
+	expected := []byte{
+		'I', 'D', '3', 3, 0, 0, 0, 0, 0, 30,
+		'T', 'I', 'T', '2', 0, 0, 0, 8, 0, 0, 0, 'S', 't', 'u', 'm', 'b', 'l', 'e',
+		'T', 'R', 'C', 'K', 0, 0, 0, 2, 0, 0, 0, '5',
+	}
+	assert.Equal(t, expected, tag)
+}
+
+func TestID3v2Cover(t *testing.T) {
+	tag := Tags{Cover: []byte{0xFF, 0xD8}}.ID3v2()
+	expected := []byte{
+		'I', 'D', '3', 3, 0, 0, 0, 0, 0, 26,
+		'A', 'P', 'I', 'C', 0, 0, 0, 16, 0, 0,
+		0, 'i', 'm', 'a', 'g', 'e', '/', 'j', 'p', 'e', 'g', 0, 3, 0, 0xFF, 0xD8,
+	}
+	assert.Equal(t, expected, tag)
+}
+
+func TestID3Text(t *testing.T) {
+	assert.Equal(t, []byte{0, 'B', 'j', 0xF6, 'r', 'k'}, id3Text("Björk"))
+	assert.Equal(t, []byte{1, 0xFF, 0xFE, 0x7D, 0x96, 0x34, 0x6C}, id3Text("陽水"))
+}
+
+func TestSyncsafe(t *testing.T) {
+	b := make([]byte, 4)
+	putSyncsafe(b, 257)
+	assert.Equal(t, []byte{0, 0, 2, 1}, b)
+	putSyncsafe(b, 0x0FFFFFFF)
+	assert.Equal(t, []byte{0x7F, 0x7F, 0x7F, 0x7F}, b)
+}
+
+func TestTagsEmpty(t *testing.T) {
+	assert.True(t, Tags{Track: 1, Tracks: 2}.IsEmpty())
+	assert.False(t, Tags{Album: "Murmur"}.IsEmpty())
+	assert.False(t, Tags{Cover: []byte{0xFF, 0xD8}}.IsEmpty())
+}
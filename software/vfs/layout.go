@@ -0,0 +1,334 @@
+package vfs
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// FATType is the type of filesystem the disk is formatted with.
+type FATType int
+
+const (
+	// FAT32 is understood by nearly every host, but limits files to 4 GiB
+	// and volumes to at least 65525 clusters (about 32 MiB).
+	FAT32 FATType = iota
+	// FAT16 is for hosts that can't mount FAT32, such as older car
+	// stereos. Volumes are limited to 65524 clusters, about 2 GiB.
+	FAT16
+	// FAT12 is for floppy-sized volumes of up to 4084 clusters.
+	FAT12
+	// ExFAT has no practical limit on file or volume sizes.
+	ExFAT
+)
+
+func (t FATType) String() string {
+	switch t {
+	case FAT32:
+		return "FAT32"
+	case FAT16:
+		return "FAT16"
+	case FAT12:
+		return "FAT12"
+	case ExFAT:
+		return "exFAT"
+	}
+	return fmt.Sprintf("FATType(%d)", int(t))
+}
+
+// Layout describes the disk the filesystem is presented as.
+type Layout struct {
+	Type FATType
+	// Superfloppy formats the whole disk as a single volume, without a
+	// partition table, as floppy disks and some flash drives are. Some
+	// hosts only mount one or the other.
+	Superfloppy bool
+	// Size of the disk in bytes.
+	Size int64
+	// ClusterSize in bytes, a power of 2 of at least 512. If 0, the
+	// cluster size Windows formats volumes of the type and size with is
+	// used.
+	ClusterSize int
+}
+
+// DefaultLayout is a FAT32 partition on a disk the size of a CD.
+var DefaultLayout = Layout{Type: FAT32, Size: DISK_SIZE}
+
+// Limits of the FAT types, from Microsoft's FAT (fatgen103) and exFAT
+// specifications.
+const (
+	maxFAT12Clusters = 4084
+	maxFAT16Clusters = 65524
+	maxFAT32Clusters = 0x0FFFFFF5 - firstCluster
+	maxExFATClusters = 0xFFFFFFF5 - firstCluster
+	maxFATFileSize   = math.MaxUint32
+
+	rootEntries       = 512 // size of the FAT12 and FAT16 root directory
+	maxFATClusterSize = 64 * 1024
+	maxExFATCluster   = 32 * 1024 * 1024
+	exfatFATOffset    = 2 * exfatBootSectors // after the main and backup boot regions
+)
+
+// geometry is the arrangement of a volume's sectors.
+type geometry struct {
+	fat               FATType
+	sectorsPerCluster uint32
+	reservedSectors   uint32 // sectors before the first FAT
+	fatCount          uint32 // number of copies of the FAT
+	fatSectors        uint32 // size of one copy of the FAT
+	rootSectors       uint32 // size of the fixed FAT12 and FAT16 root directory
+	clusterCount      uint32 // number of data clusters
+}
+
+// newGeometry computes the layout of a volume of the given number of
+// sectors. If sectorsPerCluster is 0, the conventional cluster size for
+// the type and size is used.
+func newGeometry(t FATType, sectors, sectorsPerCluster uint32) (geometry, error) {
+	g := geometry{fat: t, sectorsPerCluster: sectorsPerCluster}
+	if g.sectorsPerCluster == 0 {
+		g.sectorsPerCluster = defaultClusterSectors(t, sectors)
+	}
+	if bits.OnesCount32(g.sectorsPerCluster) != 1 || g.sectorsPerCluster > maxClusterSize(t)/SECTOR_SIZE {
+		return g, fmt.Errorf("invalid cluster size %v for %v", g.sectorsPerCluster*SECTOR_SIZE, t)
+	}
+	g.computeClusters(sectors)
+
+	minCount, maxCount := clusterLimits(t)
+	if maxCount == 0 {
+		return g, fmt.Errorf("unknown filesystem type %v", t)
+	}
+	overhead := g.reservedSectors + g.fatCount*g.fatSectors + g.rootSectors
+	if sectors <= overhead || g.clusterCount < minCount {
+		return g, fmt.Errorf("disk too small for %v", t)
+	}
+	if g.clusterCount > maxCount {
+		return g, fmt.Errorf("disk too large for %v with %v byte clusters", t, g.sectorsPerCluster*SECTOR_SIZE)
+	}
+	return g, nil
+}
+
+// clusterLimits returns the range of cluster counts a volume of the
+// given type may have. FAT types are told apart by their cluster count.
+func clusterLimits(t FATType) (lo, hi uint32) {
+	switch t {
+	case FAT12:
+		return 1, maxFAT12Clusters
+	case FAT16:
+		return maxFAT12Clusters + 1, maxFAT16Clusters
+	case FAT32:
+		return maxFAT16Clusters + 1, maxFAT32Clusters
+	case ExFAT:
+		return 1, maxExFATClusters
+	}
+	return 0, 0
+}
+
+// maxClusterSize returns the largest cluster size of the type, in bytes.
+func maxClusterSize(t FATType) uint32 {
+	if t == ExFAT {
+		return maxExFATCluster
+	}
+	return maxFATClusterSize
+}
+
+// computeClusters sizes the FAT to fit the clusters left after it, and
+// counts the clusters.
+func (g *geometry) computeClusters(sectors uint32) {
+	spc := g.sectorsPerCluster
+	switch g.fat {
+	case FAT12, FAT16:
+		g.reservedSectors, g.fatCount = 1, 2
+		g.rootSectors = rootEntries * dirEntrySize / SECTOR_SIZE
+	case FAT32:
+		g.reservedSectors, g.fatCount = 32, 2
+	case ExFAT:
+		g.reservedSectors, g.fatCount = exfatFATOffset, 1
+	}
+	tmp1 := int64(sectors) - int64(g.reservedSectors+g.rootSectors)
+	if tmp1 <= 0 {
+		g.fatSectors, g.clusterCount = 0, 0
+		return
+	}
+	switch g.fat {
+	case FAT16, FAT32:
+		// fatgen103, p. 21
+		tmp2 := int64(256*spc + g.fatCount)
+		if g.fat == FAT32 {
+			tmp2 /= 2
+		}
+		g.fatSectors = uint32((tmp1 + tmp2 - 1) / tmp2)
+	case FAT12:
+		// entries are 1.5 bytes
+		g.fatSectors = uint32(((tmp1/int64(spc)+firstCluster)*3/2 + SECTOR_SIZE - 1) / SECTOR_SIZE)
+	case ExFAT:
+		g.fatSectors = uint32(((tmp1/int64(spc)+firstCluster)*4 + SECTOR_SIZE - 1) / SECTOR_SIZE)
+	}
+	data := tmp1 - int64(g.fatCount*g.fatSectors)
+	g.clusterCount = uint32(max(0, data/int64(spc)))
+}
+
+// defaultClusterSectors returns the number of sectors per cluster Windows
+// formats a volume of the given type and number of sectors with.
+func defaultClusterSectors(t FATType, sectors uint32) uint32 {
+	switch t {
+	case FAT12:
+		// the smallest clusters that can address the volume
+		spc := uint32(1)
+		for spc < maxFATClusterSize/SECTOR_SIZE && sectors/spc > maxFAT12Clusters {
+			spc *= 2
+		}
+		return spc
+	case FAT16:
+		switch {
+		case sectors <= 32680:
+			return 2
+		case sectors <= 262144:
+			return 4
+		case sectors <= 524288:
+			return 8
+		case sectors <= 1048576:
+			return 16
+		case sectors <= 2097152:
+			return 32
+		}
+		return 64
+	case ExFAT:
+		switch {
+		case sectors <= 524288: // 256 MiB
+			return 8
+		case sectors <= 67108864: // 32 GiB
+			return 64
+		}
+		return 256
+	}
+	switch {
+	case sectors <= 532480: // 260 MiB
+		return 1
+	case sectors <= 16777216: // 8 GiB
+		return 8
+	case sectors <= 33554432:
+		return 16
+	case sectors <= 67108864:
+		return 32
+	}
+	return 64
+}
+
+// clusterSize returns the size of a cluster in bytes.
+func (g geometry) clusterSize() int64 {
+	return int64(g.sectorsPerCluster) * SECTOR_SIZE
+}
+
+// clustersFor returns the number of clusters needed to hold n bytes.
+func (g geometry) clustersFor(n int64) uint32 {
+	return uint32((n + g.clusterSize() - 1) / g.clusterSize())
+}
+
+// dataSector returns the first sector of the data clusters, relative to
+// the start of the volume.
+func (g geometry) dataSector() uint32 {
+	return g.reservedSectors + g.fatCount*g.fatSectors + g.rootSectors
+}
+
+// SetLayout changes the disk the filesystem is presented as. It can't
+// be changed while CDs are loaded.
+func (f *Filesystem) SetLayout(l Layout) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.albums) > 0 {
+		return fmt.Errorf("can't change disk layout while CDs are loaded")
+	}
+	v, err := newVolume(l, f.vol.label, f.vol.serial, f.vol.created)
+	if err != nil {
+		return err
+	}
+	v.shortOnly = f.vol.shortOnly
+	f.vol, f.layout = v, l
+	f.traceEvent(TraceEvent{Op: TraceDisk, Disk: f.traceDiskInfo()})
+	return f.switchOverlay()
+}
+
+// Layout returns the layout of the disk.
+func (f *Filesystem) Layout() Layout {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.layout
+}
+
+// MinSize returns the size of the smallest disk of the filesystem's
+// type that can hold the loaded CDs.
+func (f *Filesystem) MinSize() (int64, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	l, err := f.minLayout()
+	return l.Size, err
+}
+
+// Fit resizes the disk to the smallest that can hold the loaded CDs,
+// choosing the cluster size that makes it smallest. Every file is laid
+// out afresh, so the disk must not be presented to a host yet.
+func (f *Filesystem) Fit() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	l, err := f.minLayout()
+	if err != nil {
+		return err
+	}
+	v, err := f.vol.relayout(l)
+	if err != nil {
+		return err
+	}
+	f.vol, f.layout = v, l
+	f.traceEvent(TraceEvent{Op: TraceFit})
+	return f.switchOverlay()
+}
+
+// minLayout finds the smallest layout of the filesystem's type with
+// enough clusters for the entries of the volume.
+func (f *Filesystem) minLayout() (Layout, error) {
+	l := f.layout
+	start := uint32(partitionStart)
+	if l.Superfloppy {
+		start = 0
+	}
+	maxSectors := uint32(math.MaxUint32) - start
+	minCount, _ := clusterLimits(l.Type)
+
+	var best Layout
+	for spc := uint32(1); spc <= maxClusterSize(l.Type)/SECTOR_SIZE; spc *= 2 {
+		g := geometry{fat: l.Type, sectorsPerCluster: spc}
+		enough := func(sectors uint32) bool {
+			g.computeClusters(sectors)
+			return g.clusterCount >= max(minCount, f.vol.clustersNeeded(g))
+		}
+		if !enough(maxSectors) {
+			continue
+		}
+		lo, hi := uint32(1), maxSectors
+		for lo < hi {
+			mid := lo + (hi-lo)/2
+			if enough(mid) {
+				hi = mid
+			} else {
+				lo = mid + 1
+			}
+		}
+
+		// the number of clusters isn't strictly monotonic in the size of
+		// the volume, so step up until the geometry is really valid
+		for sectors := lo; sectors <= lo+8*spc && sectors <= maxSectors; sectors++ {
+			size := int64(start+sectors) * SECTOR_SIZE
+			if best.Size != 0 && size >= best.Size {
+				break
+			}
+			if _, err := newGeometry(l.Type, sectors, spc); err == nil && enough(sectors) {
+				best = Layout{Type: l.Type, Superfloppy: l.Superfloppy, Size: size, ClusterSize: int(spc * SECTOR_SIZE)}
+				break
+			}
+		}
+	}
+	if best.Size == 0 {
+		return l, fmt.Errorf("loaded CDs don't fit in a %v volume", l.Type)
+	}
+	return best, nil
+}
@@ -0,0 +1,221 @@
+package vfs
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testDisc returns a short CD with track data, for layouts of any size.
+func testDisc() CD {
+	cd := CD{Name: "Test Disc", Title: "Test Disc", Artist: "Tester"}
+	for i, sectors := range []int{75, 5 * 75, 1} {
+		data := make([]byte, sectors*2352)
+		for j := range data {
+			data[j] = byte(j*(i+1) + j>>8)
+		}
+		cd.Tracks = append(cd.Tracks, Track{
+			ReadSeeker:    bytes.NewReader(data),
+			Title:         "Track " + strconv.Itoa(i+1),
+			LengthSectors: sectors,
+		})
+	}
+	return cd
+}
+
+// checkImage verifies the image, reads every file of it back with the
+// verifier, and compares the tracks with the expected contents.
+func checkImage(t *testing.T, fsys *Filesystem, cd CD, fsType string) {
+	t.Helper()
+	cd = fsys.album(cd.Name).cd // with the scaled cover
+	violations, err := fsys.Verify()
+	require.NoError(t, err)
+	assert.Empty(t, violations)
+	tv, err := openTestVolume(fsys.vol)
+	require.NoError(t, err)
+	assert.Equal(t, fsType, tv.fsType)
+	assert.Equal(t, "TEST DISC", tv.label) // the title of the only CD
+
+	files := tv.walk()
+	assert.Empty(t, tv.problems)
+	assert.Len(t, files, len(cd.Tracks)+2) // and the album art
+	for i := range cd.Tracks {
+		path, _ := fsys.trackPath(cd, i)
+		b, err := tv.readFile(path)
+		require.NoError(t, err)
+		want := trackHeader(cd, i)
+		data := make([]byte, trackDataBytes(&cd.Tracks[i]))
+		cd.Tracks[i].Seek(0, 0)
+		_, err = cd.Tracks[i].Read(data)
+		require.NoError(t, err)
+		want = append(want, data...)
+		if !bytes.Equal(want, b) {
+			i := 0
+			for i < min(len(want), len(b)) && want[i] == b[i] {
+				i++
+			}
+			t.Errorf("contents of %v differ at %v (%v, %v bytes)", path, i, len(b), len(want))
+		}
+	}
+}
+
+// blkid identifies the filesystem of an image with blkid, if installed,
+// returning its TYPE and VERSION.
+func blkid(t *testing.T, fsys *Filesystem) (string, string, bool) {
+	bin, err := exec.LookPath("blkid")
+	if err != nil {
+		return "", "", false
+	}
+	path := filepath.Join(t.TempDir(), "disk.img")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	buf := make([]byte, 1024*1024)
+	for off := int64(0); off < fsys.vol.Size(); off += int64(len(buf)) {
+		n, err := fsys.vol.ReadAt(buf[:min(int64(len(buf)), fsys.vol.Size()-off)], off)
+		require.NoError(t, err)
+		_, err = f.Write(buf[:n])
+		require.NoError(t, err)
+	}
+	require.NoError(t, f.Close())
+
+	offset := int64(fsys.vol.start) * SECTOR_SIZE
+	out, err := exec.Command(bin, "-p", "-o", "export", "-O", strconv.FormatInt(offset, 10), path).Output()
+	require.NoError(t, err, "blkid found no filesystem")
+	fields := make(map[string]string)
+	for _, line := range strings.Split(string(out), "\n") {
+		if k, v, ok := strings.Cut(line, "="); ok {
+			fields[k] = v
+		}
+	}
+	return fields["TYPE"], fields["VERSION"], true
+}
+
+func TestLayouts(t *testing.T) {
+	cases := []struct {
+		layout  Layout
+		fsType  string
+		blkType string
+	}{
+		{Layout{Type: FAT12, Superfloppy: true, Size: 1440 * 1024}, "FAT12", "vfat"},
+		{Layout{Type: FAT12, Size: 4 * 1024 * 1024}, "FAT12", "vfat"},
+		{Layout{Type: FAT16, Size: 64 * 1024 * 1024}, "FAT16", "vfat"},
+		{Layout{Type: FAT16, Superfloppy: true, Size: 16 * 1024 * 1024}, "FAT16", "vfat"},
+		{Layout{Type: FAT16, Size: DISK_SIZE}, "FAT16", "vfat"},
+		{Layout{Type: FAT32, Superfloppy: true, Size: 64 * 1024 * 1024}, "FAT32", "vfat"},
+		{Layout{Type: FAT32, Size: DISK_SIZE, ClusterSize: 8 * 1024}, "FAT32", "vfat"},
+		{Layout{Type: ExFAT, Size: DISK_SIZE}, "exFAT", "exfat"},
+		{Layout{Type: ExFAT, Superfloppy: true, Size: 8 * 1024 * 1024}, "exFAT", "exfat"},
+	}
+	for _, c := range cases {
+		name := c.fsType + "/" + strconv.FormatInt(c.layout.Size, 10)
+		if c.layout.Superfloppy {
+			name += "/superfloppy"
+		}
+		t.Run(name, func(t *testing.T) {
+			fsys := createAt(t, testTime)
+			defer fsys.Close()
+			require.NoError(t, fsys.SetLayout(c.layout))
+			assert.Equal(t, c.layout, fsys.Layout())
+			cd := testDisc()
+			cd.Cover = testCover(t, 10, 10)
+			require.NoError(t, fsys.LoadCD(cd))
+			assert.Equal(t, c.layout.Size, fsys.vol.Size())
+
+			checkImage(t, fsys, cd, c.fsType)
+			if typ, version, ok := blkid(t, fsys); ok {
+				assert.Equal(t, c.blkType, typ)
+				if c.blkType == "vfat" {
+					assert.Equal(t, c.fsType, version)
+				}
+			}
+			if c.fsType == "FAT32" {
+				pfs := parseImage(t, fsys)
+				assert.Equal(t, "TEST DISC", pfs.Label())
+				readImageFile(t, pfs, "/Test Disc/02 - Track 2.wav")
+			}
+		})
+	}
+}
+
+func TestLayoutErrors(t *testing.T) {
+	fsys := createAt(t, testTime)
+	defer fsys.Close()
+
+	assert.ErrorContains(t, fsys.SetLayout(Layout{Type: FAT32, Size: 16 * 1024 * 1024}), "too small for FAT32")
+	assert.ErrorContains(t, fsys.SetLayout(Layout{Type: FAT16, Size: 4 * 1024 * 1024 * 1024}), "too large for FAT16")
+	assert.ErrorContains(t, fsys.SetLayout(Layout{Type: FAT12, Size: DISK_SIZE}), "too large for FAT12")
+	assert.ErrorContains(t, fsys.SetLayout(Layout{Type: FAT16, Superfloppy: true, Size: 1024 * 1024}), "too small for FAT16")
+	assert.Error(t, fsys.SetLayout(Layout{Type: FAT32, Size: DISK_SIZE, ClusterSize: 3000}))
+	assert.Error(t, fsys.SetLayout(Layout{Type: FAT32, Size: DISK_SIZE, ClusterSize: 128 * 1024}))
+	assert.Error(t, fsys.SetLayout(Layout{Type: 7, Size: DISK_SIZE}))
+	// the layout is unchanged
+	assert.Equal(t, DefaultLayout, fsys.Layout())
+
+	require.NoError(t, fsys.LoadCD(testDisc()))
+	assert.Error(t, fsys.SetLayout(Layout{Type: FAT16, Size: DISK_SIZE}))
+	require.NoError(t, fsys.EjectAll())
+
+	// a whole-disc track over 4 GiB only fits exFAT
+	long := CD{Name: "Long", Tracks: []Track{{LengthSectors: 2_000_000}}}
+	require.NoError(t, fsys.SetLayout(Layout{Type: FAT32, Size: 8 << 30}))
+	assert.ErrorContains(t, fsys.LoadCD(long), "too large for FAT32")
+	require.NoError(t, fsys.SetLayout(Layout{Type: ExFAT, Size: 8 << 30}))
+	require.NoError(t, fsys.LoadCD(long))
+
+	// the fixed root directory of FAT16 fills up
+	require.NoError(t, fsys.EjectAll())
+	require.NoError(t, fsys.SetLayout(Layout{Type: FAT16, Size: 64 * 1024 * 1024}))
+	var err error
+	for i := 0; err == nil && i < rootEntries; i++ {
+		err = fsys.LoadCD(CD{Name: "Album " + strconv.Itoa(i), Tracks: []Track{{LengthSectors: 1}}})
+	}
+	assert.ErrorContains(t, err, "root directory")
+}
+
+func TestFit(t *testing.T) {
+	for _, typ := range []FATType{FAT12, FAT16, FAT32, ExFAT} {
+		for _, superfloppy := range []bool{false, true} {
+			t.Run(typ.String()+"/"+strconv.FormatBool(superfloppy), func(t *testing.T) {
+				fsys := createAt(t, testTime)
+				defer fsys.Close()
+				size := int64(DISK_SIZE)
+				if typ == FAT12 {
+					size = 16 * 1024 * 1024
+				}
+				require.NoError(t, fsys.SetLayout(Layout{Type: typ, Superfloppy: superfloppy, Size: size}))
+				cd := testDisc()
+				cd.Cover = testCover(t, 10, 10)
+				require.NoError(t, fsys.LoadCD(cd))
+
+				min, err := fsys.MinSize()
+				require.NoError(t, err)
+				assert.Less(t, min, size)
+				require.NoError(t, fsys.Fit())
+				l := fsys.Layout()
+				assert.Equal(t, min, l.Size)
+				assert.Equal(t, min, fsys.vol.Size())
+				assert.Equal(t, typ, l.Type)
+				assert.Equal(t, superfloppy, l.Superfloppy)
+				checkImage(t, fsys, cd, typ.String())
+
+				// no smaller disk of the type holds the CD, whatever its
+				// cluster size
+				for cs := SECTOR_SIZE; cs <= int(maxClusterSize(typ)); cs *= 2 {
+					smaller := Layout{Type: typ, Superfloppy: superfloppy, Size: min - SECTOR_SIZE, ClusterSize: cs}
+					_, err := fsys.vol.relayout(smaller)
+					assert.Error(t, err, "%v byte clusters", cs)
+				}
+				// files can be added until the disk is full
+				assert.Error(t, fsys.LoadCD(CHRONIC_TOWN))
+				checkImage(t, fsys, cd, typ.String())
+			})
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package vfs
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rabidaudio/cdz-nuts/mp3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfileMP3(t *testing.T) {
+	fsys := createAt(t, testTime)
+	defer fsys.Close()
+
+	err := fsys.SetProfile(ProfileMP3)
+	require.NoError(t, err)
+	err = fsys.LoadCD(WAVECD)
+	require.NoError(t, err)
+
+	pfs := parseImage(t, fsys)
+	for i, tr := range WAVECD.Tracks {
+		name, _ := fsys.trackPath(WAVECD, i)
+		assert.True(t, strings.HasSuffix(name, ".mp3"), name)
+		tf, err := pfs.OpenFile(name, os.O_RDONLY)
+		require.NoError(t, err)
+		actual, err := io.ReadAll(tf)
+		require.NoError(t, err)
+
+		// the file is the tags followed by the encoded frames
+		tags := trackTags(WAVECD, i).ID3v2()
+		assert.Equal(t, tags, actual[:len(tags)])
+		frames := actual[len(tags):]
+		assert.Equal(t, []byte{0xFF, 0xFB}, frames[:2])
+
+		_, err = tr.Seek(0, io.SeekStart)
+		require.NoError(t, err)
+		r, err := mp3.NewReader(tr, trackDataBytes(&tr)/4, mp3.DefaultBitrate)
+		require.NoError(t, err)
+		expected, err := io.ReadAll(r)
+		require.NoError(t, err)
+		// go-diskfs may read past the end of the file to the end of the cluster
+		require.GreaterOrEqual(t, len(frames), len(expected))
+		assert.True(t, bytes.Equal(expected, frames[:len(expected)]), "track %v differs", name)
+	}
+}
+
+func TestProfileMP3Silent(t *testing.T) {
+	fsys := createAt(t, testTime)
+	defer fsys.Close()
+
+	err := fsys.SetProfile(Profile{Format: FormatMP3, Bitrate: 128})
+	require.NoError(t, err)
+	err = fsys.LoadCD(CHRONIC_TOWN)
+	require.NoError(t, err)
+
+	enc, _ := mp3.NewEncoder(128)
+	ranges, err := fsys.TrackRanges()
+	require.NoError(t, err)
+	for i, tr := range ranges {
+		track := CHRONIC_TOWN.Tracks[i]
+		tags := trackTags(CHRONIC_TOWN, i).ID3v2()
+		assert.Equal(t, int64(len(tags))+enc.Size(int64(track.LengthSectors)*588), tr.FileInfo.Size())
+
+		// tracks without a source are encoded as silence
+		frame := make([]byte, 4)
+		_, err := fsys.vol.ReadAt(frame, tr.Extent.Offset()+int64(len(tags)))
+		require.NoError(t, err)
+		assert.Equal(t, []byte{0xFF, 0xFB, 0x90, 0x04}, frame)
+	}
+}
+
+func TestProfileBitrate(t *testing.T) {
+	fsys := createAt(t, testTime)
+	defer fsys.Close()
+
+	err := fsys.SetProfile(Profile{Format: FormatMP3, Bitrate: 100})
+	assert.Error(t, err)
+	err = fsys.SetProfile(Profile{Format: FormatMP3, Bitrate: 320})
+	assert.NoError(t, err)
+}
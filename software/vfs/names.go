@@ -0,0 +1,282 @@
+package vfs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"text/template"
+	"unicode/utf16"
+)
+
+// DefaultTrackTemplate names track files like "03 - Carnival of Sorts (Box Cars)".
+//
+// Track name templates are [text/template]s executed with the track's
+// [Tags]. The file extension is added automatically.
+const DefaultTrackTemplate = `{{printf "%02d" .Track}}{{with .Title}} - {{.}}{{end}}`
+
+// maxLongName is the maximum length of a long file name, in UTF-16 code units.
+const maxLongName = 255
+
+// lfnCharsPerEntry is the number of UTF-16 code units stored in each
+// long file name directory entry.
+const lfnCharsPerEntry = 13
+
+const attrLongName = 0x0F
+
+// SetTrackTemplate sets the template used to name track files.
+// See [DefaultTrackTemplate].
+func (f *Filesystem) SetTrackTemplate(text string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	tmpl, err := template.New("track").Parse(text)
+	if err != nil {
+		return fmt.Errorf("invalid track template: %w", err)
+	}
+	f.trackTmpl = tmpl
+	f.traceEvent(TraceEvent{Op: TraceTemplate, Template: text})
+	return nil
+}
+
+// trackName renders the file name of track i, without extension.
+func (f *Filesystem) trackName(cd CD, i int) (string, error) {
+	var sb strings.Builder
+	if err := f.trackTmpl.Execute(&sb, trackTags(cd, i)); err != nil {
+		return "", err
+	}
+	name := f.profile.Names.longName(sb.String())
+	if name == "" {
+		// fall back to something unique
+		name = fmt.Sprintf("Track %02d", i+1)
+	}
+	return name, nil
+}
+
+// longName makes a name valid as a long file name, replacing characters
+// that aren't allowed and trimming leading and trailing spaces and
+// trailing periods, which Windows ignores.
+func longName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 {
+			return '_'
+		}
+		if rr, ok := fatReplacements[r]; ok {
+			return rr
+		}
+		return r
+	}, name)
+	name = strings.TrimLeft(name, " ")
+	name = strings.TrimRight(name, " .")
+
+	return truncateLong(name, maxLongName)
+}
+
+// withExt adds the extension to a long name, keeping the whole name
+// within the maximum length.
+func withExt(name, ext string) string {
+	return truncateLong(name, maxLongName-len(ext)) + ext
+}
+
+// truncateLong limits name to n UTF-16 code units, without splitting
+// surrogate pairs.
+func truncateLong(name string, n int) string {
+	for len(utf16.Encode([]rune(name))) > n {
+		r := []rune(name)
+		name = string(r[:len(r)-1])
+	}
+	return name
+}
+
+// isShortChar reports whether r can appear in an 8.3 name.
+func isShortChar(r rune) bool {
+	switch {
+	case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return true
+	case r > 0x7F:
+		return false
+	}
+	return strings.ContainsRune("$%'-_@~`!(){}^#&", r)
+}
+
+// volumeLabel returns a volume label for a title, which like an 8.3
+// name is at most 11 upper case ASCII characters, though it may contain
+// spaces.
+func volumeLabel(title string) string {
+	var sb strings.Builder
+	count := 0
+	for _, r := range strings.TrimSpace(strings.ToUpper(Transliterate(title))) {
+		if count == 11 {
+			break
+		}
+		if r != ' ' && !isShortChar(r) {
+			r = '_'
+		}
+		sb.WriteRune(r)
+		count++
+	}
+	label := strings.TrimRight(sb.String(), " ")
+	if strings.Trim(label, "_") == "" {
+		return DefaultLabel
+	}
+	return label
+}
+
+// basisName computes the basis of the 8.3 alias of a long name, following
+// the algorithm Windows uses, except that characters are transliterated
+// rather than replaced where possible, and directories have no extension.
+// lossy reports whether the long name can't be recovered from the basis, in
+// which case a numeric tail is required.
+func basisName(name string, dir bool) (base, ext string, lossy bool) {
+	upper := strings.ToUpper(Transliterate(name))
+	stripped := strings.TrimLeft(strings.ReplaceAll(upper, " ", ""), ".")
+	lossy = stripped != strings.ToUpper(name)
+
+	b, e := stripped, ""
+	if i := strings.LastIndex(stripped, "."); i >= 0 && !dir {
+		b, e = stripped[:i], stripped[i+1:]
+	}
+	convert := func(s string, n int) string {
+		var sb strings.Builder
+		count := 0
+		for _, r := range s {
+			if r == '.' {
+				lossy = true
+				continue
+			}
+			if count == n {
+				lossy = true
+				break
+			}
+			if !isShortChar(r) {
+				r = '_'
+				lossy = true
+			}
+			sb.WriteRune(r)
+			count++
+		}
+		return sb.String()
+	}
+	base = convert(b, 8)
+	ext = convert(e, 3)
+	return
+}
+
+// shortAliases assigns unique 8.3 aliases to the children of dir, in the
+// space padded 11 byte form used in directory entries. Children keep the
+// aliases they were given before, so that they don't change as other
+// entries come and go. If shortOnly, long names are replaced by their
+// aliases, so there's no long name to recover and the basis is used as it
+// is if it's unique.
+func shortAliases(dir *entry, shortOnly bool) {
+	used := make(map[string]bool, len(dir.children))
+	var fresh []*entry
+	for _, c := range dir.children {
+		if c.short != "" && !used[c.short] {
+			used[c.short] = true
+		} else {
+			fresh = append(fresh, c)
+		}
+	}
+	for _, c := range fresh {
+		base, ext, lossy := basisName(c.name, c.dir)
+		if base == "" {
+			base, lossy = "_", true
+		}
+		short := padName(base, 8) + padName(ext, 3)
+		if (!lossy || shortOnly) && !used[short] {
+			c.short = short
+			c.lfn = c.name != displayShort(short)
+			used[short] = true
+			continue
+		}
+		for n := 1; ; n++ {
+			tail := fmt.Sprintf("~%d", n)
+			short = padName(base[:min(len(base), 8-len(tail))]+tail, 8) + padName(ext, 3)
+			if !used[short] {
+				break
+			}
+		}
+		c.short = short
+		c.lfn = true
+		used[short] = true
+	}
+	if shortOnly {
+		for _, c := range fresh {
+			c.name = displayShort(c.short)
+			c.lfn = false
+		}
+	}
+}
+
+// displayShort converts a space padded 8.3 name to the form it's
+// displayed in, e.g. TRACK01.WAV.
+func displayShort(short string) string {
+	return strings.TrimRight(short[:8], " ") + dotExt(strings.TrimRight(short[8:], " "))
+}
+
+func dotExt(ext string) string {
+	if ext == "" {
+		return ""
+	}
+	return "." + ext
+}
+
+// lfnEntries returns the number of long file name entries needed for name.
+func lfnEntries(name string) int {
+	n := len(utf16.Encode([]rune(name)))
+	return (n + lfnCharsPerEntry - 1) / lfnCharsPerEntry
+}
+
+// shortChecksum computes the checksum of an 8.3 name that links long
+// file name entries to the short entry.
+func shortChecksum(short string) byte {
+	var sum byte
+	for i := range 11 {
+		sum = (sum&1)<<7 + sum>>1 + short[i]
+	}
+	return sum
+}
+
+// appendLFN renders the long file name entries for name, which precede
+// the short entry, in the order they appear on disk.
+func appendLFN(b []byte, name, short string) []byte {
+	u := utf16.Encode([]rune(name))
+	count := lfnEntries(name)
+	// the name is NUL terminated if there is room, then padded with 0xFFFF
+	padded := make([]uint16, count*lfnCharsPerEntry)
+	for i := range padded {
+		switch {
+		case i < len(u):
+			padded[i] = u[i]
+		case i == len(u):
+			padded[i] = 0
+		default:
+			padded[i] = 0xFFFF
+		}
+	}
+
+	sum := shortChecksum(short)
+	for seq := count; seq >= 1; seq-- {
+		ent := make([]byte, dirEntrySize)
+		ent[0] = byte(seq)
+		if seq == count {
+			ent[0] |= 0x40 // last logical entry
+		}
+		ent[11] = attrLongName
+		ent[13] = sum
+		chars := padded[(seq-1)*lfnCharsPerEntry : seq*lfnCharsPerEntry]
+		for i, c := range chars {
+			var off int
+			switch {
+			case i < 5:
+				off = 1 + i*2
+			case i < 11:
+				off = 14 + (i-5)*2
+			default:
+				off = 28 + (i-11)*2
+			}
+			binary.LittleEndian.PutUint16(ent[off:], c)
+		}
+		b = append(b, ent...)
+	}
+	return b
+}
@@ -0,0 +1,165 @@
+package vfs
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLongName(t *testing.T) {
+	assert.Equal(t, "AC-DC", longName("AC/DC"))
+	assert.Equal(t, "Say 'Hi'", longName(`Say "Hi"`))
+	assert.Equal(t, "What_", longName("What?"))
+	assert.Equal(t, "R.E.M", longName("  R.E.M. "))
+	assert.Equal(t, "", longName(""))
+	assert.Len(t, longName(strings.Repeat("a", 300)), maxLongName)
+	// surrogate pairs count twice and aren't split
+	assert.Equal(t, strings.Repeat("😀", 127), longName(strings.Repeat("😀", 200)))
+}
+
+func TestBasisName(t *testing.T) {
+	cases := []struct {
+		name, base, ext string
+		dir, lossy      bool
+	}{
+		{"TRACK01.WAV", "TRACK01", "WAV", false, false},
+		{"track01.wav", "TRACK01", "WAV", false, false},
+		{"03 - Carnival of Sorts (Box Cars).wav", "03-CARNI", "WAV", false, true},
+		{"1,000,000.wav", "1_000_00", "WAV", false, true},
+		{"R.E.M. - Chronic Town", "REM", "-CH", false, true},
+		{"R.E.M. - Chronic Town", "REM-CHRO", "", true, true},
+		{"Vol. 2", "VOL2", "", true, true},
+		{".hidden", "HIDDEN", "", false, true},
+		{"archive.tar.gz", "ARCHIVET", "GZ", false, true},
+		{"Björk.wav", "BJORK", "WAV", false, true},
+		{"日本.wav", "__", "WAV", false, true},
+	}
+	for _, c := range cases {
+		base, ext, lossy := basisName(c.name, c.dir)
+		assert.Equal(t, c.base, base, c.name)
+		assert.Equal(t, c.ext, ext, c.name)
+		assert.Equal(t, c.lossy, lossy, c.name)
+	}
+}
+
+func TestVolumeLabel(t *testing.T) {
+	assert.Equal(t, "CHRONIC TOW", volumeLabel("Chronic Town"))
+	assert.Equal(t, "MURMUR", volumeLabel("  Murmur "))
+	assert.Equal(t, "AC_DC_ LIVE", volumeLabel("AC/DC: Live"))
+	assert.Equal(t, "CA VA", volumeLabel("Ça va  "))
+	assert.Equal(t, "R_E_M", volumeLabel("R.E.M"))
+	assert.Equal(t, DefaultLabel, volumeLabel("日本"))
+	assert.Equal(t, DefaultLabel, volumeLabel(""))
+}
+
+func TestShortAliases(t *testing.T) {
+	dir := &entry{dir: true}
+	for _, name := range []string{
+		"TRACK01.WAV",
+		"track02.wav",
+		"03 - Carnival of Sorts (Box Cars).wav",
+		"03 - Carnival of Sorts (Live).wav",
+		"TRACK01.WAV",
+	} {
+		dir.children = append(dir.children, &entry{name: name})
+	}
+	shortAliases(dir, false)
+
+	expected := []struct {
+		short string
+		lfn   bool
+	}{
+		{"TRACK01 WAV", false},
+		{"TRACK02 WAV", true},
+		{"03-CAR~1WAV", true},
+		{"03-CAR~2WAV", true},
+		{"TRACK0~1WAV", true},
+	}
+	for i, e := range expected {
+		assert.Equal(t, e.short, dir.children[i].short)
+		assert.Equal(t, e.lfn, dir.children[i].lfn)
+	}
+}
+
+func TestShortAliasesShortOnly(t *testing.T) {
+	dir := &entry{dir: true}
+	for _, name := range []string{
+		"03 - Carnival of Sorts (Box Cars).wav",
+		"03 - Carnival of Sorts (Live).wav",
+		"R.E.M. - Chronic Town.m3u",
+	} {
+		dir.children = append(dir.children, &entry{name: name})
+	}
+	dir.children = append(dir.children, &entry{name: "R.E.M. - Chronic Town", dir: true})
+	shortAliases(dir, true)
+
+	// the basis is used as it is unless it's taken
+	var names []string
+	for _, c := range dir.children {
+		names = append(names, c.name)
+		assert.False(t, c.lfn)
+	}
+	assert.Equal(t, []string{"03-CARNI.WAV", "03-CAR~1.WAV", "REM-CHRO.M3U", "REM-CHRO"}, names)
+}
+
+func TestShortChecksum(t *testing.T) {
+	assert.Equal(t, byte(0x96), shortChecksum("TRACK01 WAV"))
+	assert.Equal(t, byte(0x00), shortChecksum("\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"))
+}
+
+func TestAppendLFN(t *testing.T) {
+	name := "03 - Carnival of Sorts (Box Cars).wav"
+	b := appendLFN(nil, name, "03-CAR~1WAV")
+	assert.Len(t, b, 3*dirEntrySize)
+	// entries are stored last first
+	assert.Equal(t, byte(0x43), b[0])
+	assert.Equal(t, byte(0x02), b[dirEntrySize])
+	assert.Equal(t, byte(0x01), b[2*dirEntrySize])
+	for i := range 3 {
+		assert.Equal(t, byte(attrLongName), b[i*dirEntrySize+11])
+		assert.Equal(t, shortChecksum("03-CAR~1WAV"), b[i*dirEntrySize+13])
+	}
+	// first entry has the first 13 characters
+	first := b[2*dirEntrySize:]
+	assert.Equal(t, []byte{'0', 0, '3', 0, ' ', 0, '-', 0, ' ', 0}, first[1:11])
+	// name is 37 chars, so the last entry has 11, a NUL and padding
+	last := b[:dirEntrySize]
+	assert.Equal(t, []byte{0, 0, 0xFF, 0xFF}, last[28:32])
+}
+
+func TestTrackTemplate(t *testing.T) {
+	fsys := createAt(t, testTime)
+	defer fsys.Close()
+
+	require.NoError(t, fsys.LoadCD(CHRONIC_TOWN))
+	path, _ := fsys.trackPath(CHRONIC_TOWN, 2)
+	assert.Equal(t, "/R.E.M. - Chronic Town/03 - Carnival of Sorts (Box Cars).wav", path)
+	path, _ = fsys.trackPath(CHRONIC_TOWN, 3)
+	assert.Equal(t, "/R.E.M. - Chronic Town/04 - 1,000,000.wav", path)
+	require.NoError(t, fsys.Eject(CHRONIC_TOWN.Name))
+
+	err := fsys.SetTrackTemplate("{{.Artist}} - {{.Title")
+	assert.Error(t, err)
+
+	err = fsys.SetTrackTemplate("{{.Artist}} - {{.Album}}")
+	assert.NoError(t, err)
+
+	err = fsys.LoadCD(CHRONIC_TOWN)
+	assert.NoError(t, err)
+	// duplicate names are made unique
+	path, _ = fsys.trackPath(CHRONIC_TOWN, 1)
+	assert.Equal(t, "/R.E.M. - Chronic Town/R.E.M. - Chronic Town (2).wav", path)
+
+	pfs := parseImage(t, fsys)
+	files, err := pfs.ReadDir("/R.E.M. - Chronic Town")
+	assert.NoError(t, err)
+	assert.Len(t, files, 2+len(CHRONIC_TOWN.Tracks))
+	assert.Equal(t, "R.E.M. - Chronic Town (5).wav", files[len(files)-1].Name())
+
+	f, err := pfs.OpenFile(path, os.O_RDONLY)
+	assert.NoError(t, err)
+	f.Close()
+}
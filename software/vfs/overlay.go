@@ -0,0 +1,269 @@
+package vfs
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// WritableBlockDevice is a [BlockDevice] the host may be able to
+// write to.
+type WritableBlockDevice interface {
+	BlockDevice
+	// WriteBlocks writes buf, whose length must be a multiple of the
+	// block size, to the blocks starting at lba.
+	WriteBlocks(ctx context.Context, lba int64, buf []byte) error
+	// Writable returns whether the host can write to the device.
+	Writable() bool
+}
+
+var _ WritableBlockDevice = (*Filesystem)(nil)
+
+// Writable implements [WritableBlockDevice]. Whether the host can write
+// to the disk depends on the profile.
+func (f *Filesystem) Writable() bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.profile.Writes != WriteProtected
+}
+
+// WriteBlocks implements [WritableBlockDevice]. Writes are kept in an
+// overlay in memory, which reads of the disk return in place of the
+// generated sectors. Track data can't be written: depending on the
+// profile, writes to it either fail, leaving the disk unchanged, or
+// are discarded.
+//
+// The overlay only applies to the disk as it was written, so it's
+// replaced whenever the disk changes, such as when a CD is loaded. See
+// [Filesystem.SetOverlayStore] to keep it.
+func (f *Filesystem) WriteBlocks(ctx context.Context, lba int64, buf []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.profile.Writes == WriteProtected {
+		return fmt.Errorf("disk is write protected")
+	}
+	if err := checkBlocks(lba, buf, SECTOR_SIZE, f.vol.Size()/SECTOR_SIZE); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	var c cursor
+	count := int64(len(buf) / SECTOR_SIZE)
+	for i := range count {
+		if f.readOnly(lba+i, &c) && f.profile.Writes != WriteOverlayDiscard {
+			err := fmt.Errorf("can't write to track data at sector %v", lba+i)
+			f.traceWrite(start, lba, len(buf), err)
+			return err
+		}
+	}
+	if f.overlay == nil {
+		f.overlay = make(map[int64][]byte)
+	}
+	for i := range count {
+		if f.readOnly(lba+i, &c) {
+			continue
+		}
+		f.overlay[lba+i] = append([]byte(nil), buf[i*SECTOR_SIZE:(i+1)*SECTOR_SIZE]...)
+	}
+	f.traceWrite(start, lba, len(buf), nil)
+	return nil
+}
+
+// readOnly returns whether the sector holds track data.
+func (f *Filesystem) readOnly(lba int64, c *cursor) bool {
+	i, ok := f.vol.extents.find(lba, c)
+	return ok && f.vol.extents[i].e.track
+}
+
+// readRegion reads like [volume.readRegion], with the sectors the host
+// wrote in place of those generated.
+func (f *Filesystem) readRegion(p []byte, off int64, c *cursor) (int, error) {
+	n, err := f.vol.readRegion(p, off, c)
+	if len(f.overlay) == 0 {
+		return n, err
+	}
+	for pos := off; pos < off+int64(n); {
+		lba := pos / SECTOR_SIZE
+		next := (lba + 1) * SECTOR_SIZE
+		if s, ok := f.overlay[lba]; ok {
+			copy(p[pos-off:min(next, off+int64(n))-off], s[pos%SECTOR_SIZE:])
+		}
+		pos = next
+	}
+	return n, err
+}
+
+// readAt reads like [volume.ReadAt], including the overlay.
+func (f *Filesystem) readAt(p []byte, off int64) (n int, err error) {
+	var c cursor
+	for n < len(p) {
+		nn, err := f.readRegion(p[n:], off+int64(n), &c)
+		n += nn
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// OverlayStore keeps the write overlays of disks, so that what the host
+// wrote to a disk is still there when the same CDs are loaded again.
+// Overlays map sectors to their contents.
+type OverlayStore interface {
+	// Load returns the overlay saved with the given ID, which is empty
+	// if there is none.
+	Load(id string) (map[int64][]byte, error)
+	// Save saves an overlay with the given ID, replacing any saved
+	// before. An empty overlay may be deleted.
+	Save(id string, overlay map[int64][]byte) error
+}
+
+// SetOverlayStore loads and saves the write overlay with s, keyed by the
+// layout of the disk and the files on it, saving it whenever the disk
+// changes. The current overlay is replaced by the one loaded from s. If
+// s is nil, the overlay is only kept until the disk changes.
+func (f *Filesystem) SetOverlayStore(s OverlayStore) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.saveOverlay(); err != nil {
+		return err
+	}
+	f.overlayStore = s
+	f.overlayID = ""
+	return f.switchOverlay()
+}
+
+// SaveOverlay saves the write overlay to the store, if there is one.
+func (f *Filesystem) SaveOverlay() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.saveOverlay()
+}
+
+func (f *Filesystem) saveOverlay() error {
+	if f.overlayStore == nil || f.overlayID == "" {
+		return nil
+	}
+	if err := f.overlayStore.Save(f.overlayID, f.overlay); err != nil {
+		return fmt.Errorf("saving write overlay: %w", err)
+	}
+	return nil
+}
+
+// switchOverlay replaces the overlay with the one for the disk as it is
+// now, if the disk changed. The overlay of the disk as it was is saved
+// first.
+func (f *Filesystem) switchOverlay() error {
+	id := f.diskID()
+	if id == f.overlayID {
+		return nil
+	}
+	if err := f.saveOverlay(); err != nil {
+		return err
+	}
+	f.overlay, f.overlayID = nil, id
+	if f.overlayStore == nil {
+		return nil
+	}
+	overlay, err := f.overlayStore.Load(id)
+	if err != nil {
+		return fmt.Errorf("loading write overlay: %w", err)
+	}
+	f.overlay = overlay
+	return nil
+}
+
+// diskID identifies the contents of the disk, from the layout and the
+// name, size and place of each file.
+func (f *Filesystem) diskID() string {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%+v", f.layout)
+	var walk func(e *entry)
+	walk = func(e *entry) {
+		fmt.Fprintf(h, " %q %v %v %v", e.name, e.size, e.cluster, e.clusters)
+		for _, c := range e.children {
+			walk(c)
+		}
+	}
+	walk(f.vol.root)
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// DirOverlayStore is an [OverlayStore] keeping each overlay in a file
+// in a directory.
+type DirOverlayStore string
+
+// path returns the file of the overlay with the given ID.
+func (d DirOverlayStore) path(id string) string {
+	return filepath.Join(string(d), id+".overlay")
+}
+
+// Load implements [OverlayStore].
+func (d DirOverlayStore) Load(id string) (map[int64][]byte, error) {
+	file, err := os.Open(d.path(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// the file is a sequence of sector numbers and contents
+	overlay := make(map[int64][]byte)
+	r := bufio.NewReader(file)
+	for {
+		var lba uint64
+		if err := binary.Read(r, binary.LittleEndian, &lba); err == io.EOF {
+			return overlay, nil
+		} else if err != nil {
+			return nil, err
+		}
+		s := make([]byte, SECTOR_SIZE)
+		if _, err := io.ReadFull(r, s); err != nil {
+			return nil, fmt.Errorf("%v is truncated", file.Name())
+		}
+		overlay[int64(lba)] = s
+	}
+}
+
+// Save implements [OverlayStore].
+func (d DirOverlayStore) Save(id string, overlay map[int64][]byte) error {
+	if len(overlay) == 0 {
+		err := os.Remove(d.path(id))
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	// write a new file and move it into place, so the overlay is never
+	// left half written
+	tmp, err := os.CreateTemp(string(d), id+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	w := bufio.NewWriter(tmp)
+	for lba, s := range overlay {
+		binary.Write(w, binary.LittleEndian, uint64(lba))
+		w.Write(s)
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), d.path(id))
+}
@@ -0,0 +1,209 @@
+package vfs
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	diskfs "github.com/diskfs/go-diskfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writableDisk returns a small writable filesystem with a CD loaded.
+func writableDisk(t *testing.T, mode WriteMode) *Filesystem {
+	fsys := createAt(t, testTime)
+	require.NoError(t, fsys.SetProfile(Profile{Name: "writable", Writes: mode}))
+	require.NoError(t, fsys.SetLayout(Layout{Type: FAT32, Superfloppy: true, Size: 64 * 1024 * 1024}))
+	require.NoError(t, fsys.LoadCD(testDisc()))
+	return fsys
+}
+
+// otherDisc returns a disc which differs from testDisc.
+func otherDisc() CD {
+	cd := testDisc()
+	cd.Name, cd.Title = "Other Disc", "Other Disc"
+	cd.Tracks = cd.Tracks[:2]
+	return cd
+}
+
+func readSector(t *testing.T, fsys *Filesystem, lba int64) []byte {
+	b := make([]byte, SECTOR_SIZE)
+	require.NoError(t, fsys.ReadBlocks(context.Background(), lba, b))
+	return b
+}
+
+func TestWriteProtected(t *testing.T) {
+	fsys := createAt(t, testTime)
+	defer fsys.Close()
+	assert.False(t, fsys.Writable())
+	err := fsys.WriteBlocks(context.Background(), 0, make([]byte, SECTOR_SIZE))
+	assert.ErrorContains(t, err, "write protected")
+
+	require.NoError(t, fsys.SetProfile(ProfileMP3))
+	assert.True(t, fsys.Writable())
+}
+
+func TestWriteOverlay(t *testing.T) {
+	fsys := writableDisk(t, WriteOverlay)
+	defer fsys.Close()
+	ctx := context.Background()
+	track := fsys.vol.clusterOffset(fsys.album("Test Disc").tracks[0].cluster) / SECTOR_SIZE
+	free := fsys.vol.extents[len(fsys.vol.extents)-1].end() + 10
+	fat := int64(fsys.vol.reservedSectors)
+
+	data := bytes.Repeat([]byte{0xA5}, 2*SECTOR_SIZE)
+	require.NoError(t, fsys.WriteBlocks(ctx, free, data))
+	require.NoError(t, fsys.WriteBlocks(ctx, fat, data[:SECTOR_SIZE]))
+	assert.Equal(t, data[:SECTOR_SIZE], readSector(t, fsys, free+1))
+	assert.Equal(t, data[:SECTOR_SIZE], readSector(t, fsys, fat))
+	assert.Equal(t, make([]byte, SECTOR_SIZE), readSector(t, fsys, free+2))
+
+	// reads which don't line up with the written sectors
+	r, err := fsys.Reader()
+	require.NoError(t, err)
+	b := make([]byte, 300)
+	_, err = r.(io.ReaderAt).ReadAt(b, (free+2)*SECTOR_SIZE-100)
+	require.NoError(t, err)
+	assert.Equal(t, data[:100], b[:100])
+	assert.Equal(t, make([]byte, 200), b[100:])
+
+	// writes to track data fail, leaving the disk unchanged
+	before := readSector(t, fsys, track-1)
+	trackData := readSector(t, fsys, track)
+	err = fsys.WriteBlocks(ctx, track-1, data)
+	assert.ErrorContains(t, err, "track data")
+	assert.Equal(t, before, readSector(t, fsys, track-1))
+	assert.Equal(t, trackData, readSector(t, fsys, track))
+
+	// the overlay doesn't survive the disk changing
+	require.NoError(t, fsys.LoadCD(otherDisc()))
+	assert.NotEqual(t, data[:SECTOR_SIZE], readSector(t, fsys, fat))
+}
+
+func TestWriteOverlayDiscard(t *testing.T) {
+	fsys := writableDisk(t, WriteOverlayDiscard)
+	defer fsys.Close()
+	track := fsys.vol.clusterOffset(fsys.album("Test Disc").tracks[0].cluster) / SECTOR_SIZE
+	trackData := readSector(t, fsys, track)
+
+	data := bytes.Repeat([]byte{0xA5}, 2*SECTOR_SIZE)
+	require.NoError(t, fsys.WriteBlocks(context.Background(), track-1, data))
+	assert.Equal(t, data[:SECTOR_SIZE], readSector(t, fsys, track-1))
+	assert.Equal(t, trackData, readSector(t, fsys, track))
+}
+
+// TestHostWrites has go-diskfs write a file to a copy of the image, as a
+// host would, and writes the sectors it changed to the filesystem.
+func TestHostWrites(t *testing.T) {
+	fsys := writableDisk(t, WriteOverlay)
+	defer fsys.Close()
+
+	image := make([]byte, fsys.vol.Size())
+	_, err := fsys.vol.ReadAt(image, 0)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "disk.img")
+	require.NoError(t, os.WriteFile(path, image, 0644))
+	dsk, err := diskfs.Open(path)
+	require.NoError(t, err)
+	hfs, err := dsk.GetFilesystem(0)
+	require.NoError(t, err)
+	require.NoError(t, hfs.Mkdir("/INDEX"))
+	hf, err := hfs.OpenFile("/INDEX/TRACKS.DB", os.O_CREATE|os.O_RDWR)
+	require.NoError(t, err)
+	content := bytes.Repeat([]byte("index "), 1000)
+	_, err = hf.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, hf.Close())
+	require.NoError(t, dsk.Close())
+
+	written, err := os.ReadFile(path)
+	require.NoError(t, err)
+	changed := 0
+	for lba := int64(0); lba < fsys.vol.Size()/SECTOR_SIZE; lba++ {
+		s := written[lba*SECTOR_SIZE : (lba+1)*SECTOR_SIZE]
+		if !bytes.Equal(image[lba*SECTOR_SIZE:(lba+1)*SECTOR_SIZE], s) {
+			require.NoError(t, fsys.WriteBlocks(context.Background(), lba, s))
+			changed++
+		}
+	}
+	assert.Positive(t, changed)
+	// go-diskfs leaves the free cluster count of FSInfo as it was, which
+	// is allowed since it's only a hint
+	violations, err := fsys.Verify()
+	require.NoError(t, err)
+	for _, v := range violations {
+		assert.Equal(t, CheckFSInfo, v.Check, v.String())
+	}
+
+	pfs := parseImage(t, fsys)
+	f, err := pfs.OpenFile("/INDEX/TRACKS.DB", os.O_RDONLY)
+	require.NoError(t, err)
+	got, err := io.ReadAll(f)
+	require.NoError(t, err)
+	assert.Equal(t, content, got[:len(content)])
+	readImageFile(t, pfs, "/Test Disc/02 - Track 2.wav")
+}
+
+func TestOverlayStore(t *testing.T) {
+	store := DirOverlayStore(t.TempDir())
+	data := bytes.Repeat([]byte{0x5A}, SECTOR_SIZE)
+
+	fsys := writableDisk(t, WriteOverlay)
+	require.NoError(t, fsys.SetOverlayStore(store))
+	fat := int64(fsys.vol.reservedSectors)
+	require.NoError(t, fsys.WriteBlocks(context.Background(), fat, data))
+	// saved on ejecting
+	require.NoError(t, fsys.Close())
+	files, err := filepath.Glob(filepath.Join(string(store), "*.overlay"))
+	require.NoError(t, err)
+	assert.Len(t, files, 1)
+
+	// the same CD on the same disk gets the overlay back
+	fsys = createAt(t, testTime)
+	require.NoError(t, fsys.SetOverlayStore(store))
+	require.NoError(t, fsys.SetProfile(Profile{Name: "writable", Writes: WriteOverlay}))
+	require.NoError(t, fsys.SetLayout(Layout{Type: FAT32, Superfloppy: true, Size: 64 * 1024 * 1024}))
+	assert.NotEqual(t, data, readSector(t, fsys, fat))
+	require.NoError(t, fsys.LoadCD(testDisc()))
+	assert.Equal(t, data, readSector(t, fsys, fat))
+
+	// but not another
+	require.NoError(t, fsys.EjectAll())
+	require.NoError(t, fsys.LoadCD(otherDisc()))
+	assert.NotEqual(t, data, readSector(t, fsys, fat))
+	require.NoError(t, fsys.Close())
+
+	// an empty overlay removes the file
+	fsys = writableDisk(t, WriteOverlay)
+	require.NoError(t, fsys.SetOverlayStore(store))
+	assert.Equal(t, data, readSector(t, fsys, fat))
+	fsys.overlay = nil
+	require.NoError(t, fsys.SaveOverlay())
+	files, err = filepath.Glob(filepath.Join(string(store), "*.overlay"))
+	require.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestOverlayStoreFile(t *testing.T) {
+	store := DirOverlayStore(t.TempDir())
+	overlay, err := store.Load("missing")
+	require.NoError(t, err)
+	assert.Empty(t, overlay)
+
+	want := map[int64][]byte{
+		0:         bytes.Repeat([]byte{1}, SECTOR_SIZE),
+		123456789: bytes.Repeat([]byte{2}, SECTOR_SIZE),
+	}
+	require.NoError(t, store.Save("disk", want))
+	overlay, err = store.Load("disk")
+	require.NoError(t, err)
+	assert.Equal(t, want, overlay)
+
+	require.NoError(t, os.Truncate(store.path("disk"), 100))
+	_, err = store.Load("disk")
+	assert.ErrorContains(t, err, "truncated")
+}
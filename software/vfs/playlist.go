@@ -0,0 +1,337 @@
+package vfs
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/rabidaudio/cdz-nuts/audiocd/redbook"
+)
+
+// PlaylistFormats is a set of playlist file formats.
+type PlaylistFormats int
+
+const (
+	// PlaylistM3U writes extended M3U playlists in Latin-1. Tracks whose
+	// names can't be written in Latin-1 are referenced by their 8.3 names,
+	// except on exFAT, which has none.
+	PlaylistM3U PlaylistFormats = 1 << iota
+	// PlaylistM3U8 writes extended M3U playlists in UTF-8.
+	PlaylistM3U8
+	// PlaylistPLS writes PLS playlists in UTF-8.
+	PlaylistPLS
+)
+
+// Playlist is a user defined playlist, which may include tracks from
+// any loaded CD. It's written to the root directory in each of the
+// profile's playlist formats, or as M3U8 if the profile has none.
+type Playlist struct {
+	Name   string
+	Tracks []PlaylistTrack
+}
+
+// PlaylistTrack refers to a track of a CD. Tracks of CDs that aren't
+// loaded, or are loaded as a whole disc, are left out of the playlist.
+type PlaylistTrack struct {
+	Album string // the Name of the CD
+	Track int    // the track number, starting at 1
+}
+
+// AddPlaylist adds a virtual playlist to the filesystem, replacing any
+// with the same name.
+func (f *Filesystem) AddPlaylist(p Playlist) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.profile.Names.longName(p.Name) == "" {
+		return fmt.Errorf("invalid playlist name %q", p.Name)
+	}
+	for i, pp := range f.playlists {
+		if pp.Name == p.Name {
+			f.playlists = append(f.playlists[:i], f.playlists[i+1:]...)
+			break
+		}
+	}
+	f.playlists = append(f.playlists, p)
+	f.traceEvent(TraceEvent{Op: TracePlaylists, Playlists: f.playlists})
+	if err := f.relayout(); err != nil {
+		return err
+	}
+	return f.switchOverlay()
+}
+
+// RemovePlaylist removes the virtual playlist with the given name.
+func (f *Filesystem) RemovePlaylist(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, p := range f.playlists {
+		if p.Name == name {
+			f.playlists = append(f.playlists[:i], f.playlists[i+1:]...)
+			f.traceEvent(TraceEvent{Op: TracePlaylists, Playlists: f.playlists})
+			if err := f.relayout(); err != nil {
+				return err
+			}
+			return f.switchOverlay()
+		}
+	}
+	return fmt.Errorf("no playlist named %q", name)
+}
+
+// playlistItem is a track in a playlist.
+type playlistItem struct {
+	file    *entry
+	title   string
+	seconds int
+}
+
+// albumItems returns the items of a playlist of a whole CD.
+func (f *Filesystem) albumItems(a *album) []playlistItem {
+	if a.disc != nil {
+		return []playlistItem{f.discItem(a.cd, a.disc)}
+	}
+	items := make([]playlistItem, len(a.tracks))
+	for i, e := range a.tracks {
+		items[i] = f.playlistItem(a.cd, i, e)
+	}
+	return items
+}
+
+func (f *Filesystem) playlistItem(cd CD, i int, e *entry) playlistItem {
+	tags := trackTags(cd, i)
+	title := tags.Title
+	if title == "" {
+		title = fmt.Sprintf("Track %d", i+1)
+	}
+	if tags.Artist != "" {
+		title = tags.Artist + " - " + title
+	}
+	return playlistItem{
+		file: e,
+		// each entry must be on one line
+		title:   oneLine(title),
+		seconds: (cd.Tracks[i].LengthSectors + redbook.SectorsPerSecond/2) / redbook.SectorsPerSecond,
+	}
+}
+
+// discItem returns the playlist item of the file of a CD loaded as a
+// whole disc.
+func (f *Filesystem) discItem(cd CD, e *entry) playlistItem {
+	title := cd.Title
+	if title == "" {
+		title = cd.Name
+	}
+	if cd.Artist != "" {
+		title = cd.Artist + " - " + title
+	}
+	sectors := 0
+	for _, t := range cd.Tracks {
+		sectors += t.LengthSectors
+	}
+	return playlistItem{
+		file:    e,
+		title:   oneLine(title),
+		seconds: (sectors + redbook.SectorsPerSecond/2) / redbook.SectorsPerSecond,
+	}
+}
+
+// oneLine replaces control characters, so that a title fits on one line.
+func oneLine(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 {
+			return ' '
+		}
+		return r
+	}, s)
+}
+
+// albumPlaylists adds the playlists of a CD to its directory. Track
+// names must be final.
+func (f *Filesystem) albumPlaylists(a *album) {
+	formats := f.profile.Playlists
+	if formats == 0 {
+		return
+	}
+	files := f.playlistFiles(f.dirName(a.cd), formats, a.dir, f.albumItems(a))
+	a.dir.children = append(a.dir.children, files...)
+}
+
+// updatePlaylists regenerates the virtual playlists in the root
+// directory from the playlists and the loaded CDs.
+func (f *Filesystem) updatePlaylists() {
+	root := f.vol.root
+	root.children = slices.DeleteFunc(root.children, func(e *entry) bool {
+		return slices.Contains(f.virtualFiles, e)
+	})
+	f.virtualFiles = nil
+	// names must be final before they're referenced
+	f.vol.assignShortNames()
+
+	formats := f.profile.Playlists
+	if formats == 0 {
+		formats = PlaylistM3U8
+	}
+	used := make(map[string]bool, len(root.children))
+	for _, c := range root.children {
+		used[strings.ToUpper(c.name)] = true
+	}
+	for _, p := range f.playlists {
+		var items []playlistItem
+		for _, t := range p.Tracks {
+			a := f.album(t.Album)
+			if a == nil || t.Track < 1 || t.Track > len(a.tracks) {
+				continue
+			}
+			items = append(items, f.playlistItem(a.cd, t.Track-1, a.tracks[t.Track-1]))
+		}
+		if len(items) == 0 {
+			continue
+		}
+		name := uniquePlaylistName(f.profile.Names.longName(p.Name), formats, used)
+		files := f.playlistFiles(name, formats, root, items)
+		f.virtualFiles = append(f.virtualFiles, files...)
+		root.children = append(root.children, files...)
+	}
+}
+
+// exts returns the file extensions of the formats.
+func (p PlaylistFormats) exts() []string {
+	var exts []string
+	if p&PlaylistM3U != 0 {
+		exts = append(exts, ".m3u")
+	}
+	if p&PlaylistM3U8 != 0 {
+		exts = append(exts, ".m3u8")
+	}
+	if p&PlaylistPLS != 0 {
+		exts = append(exts, ".pls")
+	}
+	return exts
+}
+
+// playlistFiles renders a playlist in dir in each of the formats.
+func (f *Filesystem) playlistFiles(name string, formats PlaylistFormats, dir *entry, items []playlistItem) []*entry {
+	var files []*entry
+	for _, ext := range formats.exts() {
+		var data []byte
+		switch ext {
+		case ".m3u":
+			data = renderM3U(dir, items, true)
+		case ".m3u8":
+			data = renderM3U(dir, items, false)
+		case ".pls":
+			data = renderPLS(dir, items)
+		}
+		files = append(files, &entry{
+			name:    withExt(name, ext),
+			size:    int64(len(data)),
+			header:  data,
+			parent:  dir,
+			modTime: f.now(),
+		})
+	}
+	return files
+}
+
+// uniquePlaylistName returns a variation of name that doesn't clash with
+// the names in used in any of the formats, and marks it used.
+func uniquePlaylistName(name string, formats PlaylistFormats, used map[string]bool) string {
+	clashes := func(name string) bool {
+		for _, ext := range formats.exts() {
+			if used[strings.ToUpper(withExt(name, ext))] {
+				return true
+			}
+		}
+		return false
+	}
+	unique := name
+	for n := 2; clashes(unique); n++ {
+		unique = fmt.Sprintf("%v (%d)", name, n)
+	}
+	for _, ext := range formats.exts() {
+		used[strings.ToUpper(withExt(unique, ext))] = true
+	}
+	return unique
+}
+
+// renderM3U renders an extended M3U playlist. If latin1, the playlist is
+// encoded in Latin-1 rather than UTF-8.
+func renderM3U(dir *entry, items []playlistItem, latin1 bool) []byte {
+	var sb strings.Builder
+	sb.WriteString("#EXTM3U\r\n")
+	for _, it := range items {
+		title, path := it.title, relativePath(dir, it.file, latin1)
+		if latin1 && !isLatin1(title) {
+			title = Transliterate(title)
+		}
+		fmt.Fprintf(&sb, "#EXTINF:%d,%s\r\n%s\r\n", it.seconds, title, path)
+	}
+	if latin1 {
+		return toLatin1(sb.String())
+	}
+	return []byte(sb.String())
+}
+
+// renderPLS renders a PLS playlist.
+func renderPLS(dir *entry, items []playlistItem) []byte {
+	var sb strings.Builder
+	sb.WriteString("[playlist]\r\n")
+	for i, it := range items {
+		fmt.Fprintf(&sb, "File%d=%s\r\n", i+1, relativePath(dir, it.file, false))
+		fmt.Fprintf(&sb, "Title%d=%s\r\n", i+1, it.title)
+		fmt.Fprintf(&sb, "Length%d=%d\r\n", i+1, it.seconds)
+	}
+	fmt.Fprintf(&sb, "NumberOfEntries=%d\r\nVersion=2\r\n", len(items))
+	return []byte(sb.String())
+}
+
+// relativePath returns the path of file relative to dir. If latin1,
+// names that can't be written in Latin-1 are replaced by 8.3 names,
+// where the volume has them.
+func relativePath(dir, file *entry, latin1 bool) string {
+	ancestors := func(e *entry) []*entry {
+		var path []*entry
+		for ; e != nil; e = e.parent {
+			path = append([]*entry{e}, path...)
+		}
+		return path
+	}
+	from, to := ancestors(dir), ancestors(file)
+	common := 0
+	for common < len(from) && common < len(to) && from[common] == to[common] {
+		common++
+	}
+
+	var parts []string
+	for range from[common:] {
+		parts = append(parts, "..")
+	}
+	for _, e := range to[common:] {
+		name := e.name
+		if latin1 && !isLatin1(name) && e.short != "" {
+			name = displayShort(e.short)
+		}
+		parts = append(parts, name)
+	}
+	return strings.Join(parts, "/")
+}
+
+func isLatin1(s string) bool {
+	for _, r := range s {
+		if r > 0xFF {
+			return false
+		}
+	}
+	return true
+}
+
+// toLatin1 encodes s in Latin-1, replacing other characters with '?'.
+func toLatin1(s string) []byte {
+	b := make([]byte, 0, utf8.RuneCountInString(s))
+	for _, r := range s {
+		if r > 0xFF {
+			r = '?'
+		}
+		b = append(b, byte(r))
+	}
+	return b
+}
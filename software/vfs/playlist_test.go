@@ -0,0 +1,160 @@
+package vfs
+
+import (
+	"io"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/diskfs/go-diskfs/filesystem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readImageFile reads a file from a parsed image.
+func readImageFile(t *testing.T, pfs filesystem.FileSystem, name string) string {
+	files, err := pfs.ReadDir(path.Dir(name))
+	require.NoError(t, err)
+	size := int64(-1)
+	for _, fi := range files {
+		if fi.Name() == path.Base(name) {
+			size = fi.Size()
+		}
+	}
+	require.NotEqual(t, int64(-1), size, "%v not found", name)
+
+	f, err := pfs.OpenFile(name, os.O_RDONLY)
+	require.NoError(t, err)
+	b, err := io.ReadAll(f)
+	require.NoError(t, err)
+	// go-diskfs may read past the end of the file to the end of the cluster
+	return string(b[:size])
+}
+
+func TestAlbumPlaylists(t *testing.T) {
+	fsys := createAt(t, testTime)
+	defer fsys.Close()
+
+	p := ProfileDefault
+	p.Playlists = PlaylistM3U | PlaylistM3U8 | PlaylistPLS
+	require.NoError(t, fsys.SetProfile(p))
+	require.NoError(t, fsys.LoadCD(CHRONIC_TOWN))
+
+	pfs := parseImage(t, fsys)
+	m3u := "#EXTM3U\r\n" +
+		"#EXTINF:255,R.E.M. - Wolves, Lower\r\n01 - Wolves, Lower.wav\r\n" +
+		"#EXTINF:210,R.E.M. - Gardening at Night\r\n02 - Gardening at Night.wav\r\n" +
+		"#EXTINF:232,R.E.M. - Carnival of Sorts (Box Cars)\r\n03 - Carnival of Sorts (Box Cars).wav\r\n" +
+		"#EXTINF:186,R.E.M. - 1,000,000\r\n04 - 1,000,000.wav\r\n" +
+		"#EXTINF:340,R.E.M. - Stumble\r\n05 - Stumble.wav\r\n"
+	assert.Equal(t, m3u, readImageFile(t, pfs, "/R.E.M. - Chronic Town/R.E.M. - Chronic Town.m3u"))
+	assert.Equal(t, m3u, readImageFile(t, pfs, "/R.E.M. - Chronic Town/R.E.M. - Chronic Town.m3u8"))
+
+	pls := readImageFile(t, pfs, "/R.E.M. - Chronic Town/R.E.M. - Chronic Town.pls")
+	assert.Contains(t, pls, "[playlist]\r\nFile1=01 - Wolves, Lower.wav\r\nTitle1=R.E.M. - Wolves, Lower\r\nLength1=255\r\n")
+	assert.Contains(t, pls, "File5=05 - Stumble.wav\r\n")
+	assert.Contains(t, pls, "NumberOfEntries=5\r\nVersion=2\r\n")
+}
+
+func TestPlaylistShortNames(t *testing.T) {
+	fsys := createAt(t, testTime)
+	defer fsys.Close()
+
+	p := ProfileShortNames
+	p.Playlists = PlaylistM3U
+	require.NoError(t, fsys.SetProfile(p))
+	require.NoError(t, fsys.LoadCD(CHRONIC_TOWN))
+
+	pfs := parseImage(t, fsys)
+	files, err := pfs.ReadDir("/REM-CHRO")
+	require.NoError(t, err)
+	assert.Equal(t, "REM-CHRO.M3U", files[len(files)-1].Name())
+	m3u := readImageFile(t, pfs, "/REM-CHRO/REM-CHRO.M3U")
+	assert.Contains(t, m3u, "#EXTINF:255,R.E.M. - Wolves, Lower\r\n01-WOLVE.WAV\r\n")
+	assert.Contains(t, m3u, "#EXTINF:340,R.E.M. - Stumble\r\n05-STUMB.WAV\r\n")
+}
+
+func TestPlaylistEncoding(t *testing.T) {
+	cd := CD{
+		Name: "Ça Ira",
+		Tracks: []Track{
+			{Title: "Élégie", LengthSectors: 75},
+			{Title: "夜明け", LengthSectors: 150},
+		},
+	}
+	fsys := createAt(t, testTime)
+	defer fsys.Close()
+
+	p := ProfileDefault
+	p.Playlists = PlaylistM3U | PlaylistM3U8
+	require.NoError(t, fsys.SetProfile(p))
+	require.NoError(t, fsys.LoadCD(cd))
+
+	pfs := parseImage(t, fsys)
+	// names outside Latin-1 fall back to 8.3 names in M3U playlists
+	assert.Equal(t, "#EXTM3U\r\n"+
+		"#EXTINF:1,\xc9l\xe9gie\r\n01 - \xc9l\xe9gie.wav\r\n"+
+		"#EXTINF:2,___\r\n02-___~1.WAV\r\n",
+		readImageFile(t, pfs, "/Ça Ira/Ça Ira.m3u"))
+	assert.Equal(t, "#EXTM3U\r\n"+
+		"#EXTINF:1,Élégie\r\n01 - Élégie.wav\r\n"+
+		"#EXTINF:2,夜明け\r\n02 - 夜明け.wav\r\n",
+		readImageFile(t, pfs, "/Ça Ira/Ça Ira.m3u8"))
+}
+
+func TestVirtualPlaylist(t *testing.T) {
+	fsys := createAt(t, testTime)
+	defer fsys.Close()
+
+	err := fsys.AddPlaylist(Playlist{
+		Name: "Favorites",
+		Tracks: []PlaylistTrack{
+			{Album: "R.E.M. - Chronic Town", Track: 5},
+			{Album: "Murmur", Track: 1}, // not loaded
+			{Album: "R.E.M. - Chronic Town", Track: 2},
+		},
+	})
+	require.NoError(t, err)
+	// nothing to play yet
+	assert.Len(t, fsys.vol.root.children, 0)
+
+	require.NoError(t, fsys.LoadCD(CHRONIC_TOWN))
+	pfs := parseImage(t, fsys)
+	assert.Equal(t, "#EXTM3U\r\n"+
+		"#EXTINF:340,R.E.M. - Stumble\r\nR.E.M. - Chronic Town/05 - Stumble.wav\r\n"+
+		"#EXTINF:210,R.E.M. - Gardening at Night\r\nR.E.M. - Chronic Town/02 - Gardening at Night.wav\r\n",
+		readImageFile(t, pfs, "/Favorites.m3u8"))
+
+	// playlists can be changed while a CD is loaded
+	err = fsys.AddPlaylist(Playlist{Name: "Favorites", Tracks: []PlaylistTrack{{Album: "R.E.M. - Chronic Town", Track: 1}}})
+	require.NoError(t, err)
+	pfs = parseImage(t, fsys)
+	assert.Equal(t, "#EXTM3U\r\n"+
+		"#EXTINF:255,R.E.M. - Wolves, Lower\r\nR.E.M. - Chronic Town/01 - Wolves, Lower.wav\r\n",
+		readImageFile(t, pfs, "/Favorites.m3u8"))
+
+	require.NoError(t, fsys.RemovePlaylist("Favorites"))
+	assert.Len(t, fsys.vol.root.children, 1)
+	assert.Error(t, fsys.RemovePlaylist("Favorites"))
+	assert.Error(t, fsys.AddPlaylist(Playlist{Name: " "}))
+
+	require.NoError(t, fsys.AddPlaylist(Playlist{Name: "Favorites", Tracks: []PlaylistTrack{{Album: "R.E.M. - Chronic Town", Track: 1}}}))
+	require.NoError(t, fsys.Eject(CHRONIC_TOWN.Name))
+	assert.Len(t, fsys.vol.root.children, 0)
+}
+
+func TestVirtualPlaylistNameClash(t *testing.T) {
+	cd := CD{Name: "Mix.m3u8", Tracks: []Track{{Title: "One", LengthSectors: 75}}}
+	fsys := createAt(t, testTime)
+	defer fsys.Close()
+
+	require.NoError(t, fsys.LoadCD(cd))
+	require.NoError(t, fsys.AddPlaylist(Playlist{Name: "mix", Tracks: []PlaylistTrack{{Album: cd.Name, Track: 1}}}))
+
+	var names []string
+	for _, c := range fsys.vol.root.children {
+		names = append(names, c.name)
+	}
+	// the album directory has the name the playlist would have had
+	assert.Equal(t, []string{"Mix.m3u8", "mix (2).m3u8"}, names)
+}
@@ -0,0 +1,102 @@
+package vfs
+
+import "github.com/rabidaudio/cdz-nuts/mp3"
+
+// NamePolicy determines which characters are used in file names.
+type NamePolicy int
+
+const (
+	// NamesUCS2 writes long file names in UCS-2, which is what most
+	// hosts support. Characters outside the Basic Multilingual Plane,
+	// such as most emoji, are transliterated.
+	NamesUCS2 NamePolicy = 0
+	// NamesASCII writes long file names transliterated to ASCII, for
+	// hosts with limited fonts.
+	NamesASCII NamePolicy = 1
+	// NamesShort writes only 8.3 names, for hosts that don't support
+	// long file names.
+	NamesShort NamePolicy = 2
+)
+
+// Format is the file format of the tracks.
+type Format int
+
+const (
+	// FormatWAV serves tracks as uncompressed WAV files.
+	FormatWAV Format = 0
+	// FormatMP3 serves tracks as constant bitrate MP3 files, encoded as
+	// they're read.
+	FormatMP3 Format = 1
+)
+
+// ext returns the file extension of the format.
+func (fm Format) ext() string {
+	if fm == FormatMP3 {
+		return ".mp3"
+	}
+	return ".wav"
+}
+
+// WriteMode determines whether the host can write to the disk.
+type WriteMode int
+
+const (
+	// WriteProtected presents the disk as read-only.
+	WriteProtected WriteMode = 0
+	// WriteOverlay accepts writes into an overlay kept in memory, for
+	// hosts that misbehave on read-only media. The disk itself is never
+	// changed. Writes to track data fail.
+	WriteOverlay WriteMode = 1
+	// WriteOverlayDiscard is like WriteOverlay, except that writes to
+	// track data are silently discarded.
+	WriteOverlayDiscard WriteMode = 2
+)
+
+// Profile describes the capabilities of the host the disk is presented to.
+type Profile struct {
+	Name   string
+	Names  NamePolicy
+	Format Format
+	// Bitrate of MP3 files in kbps, one of [mp3.Bitrates]. If zero,
+	// [mp3.DefaultBitrate] is used.
+	Bitrate int
+	// Playlists of each CD to write alongside its tracks, for hosts that
+	// only play tracks in order from a playlist.
+	Playlists PlaylistFormats
+	// CoverSize is the largest width and height of album art in pixels.
+	// If zero, album art is left out.
+	CoverSize int
+	// Writes determines whether the host can write to the disk.
+	Writes WriteMode
+}
+
+var (
+	// ProfileDefault suits computers and most modern devices.
+	ProfileDefault = Profile{Name: "default", Names: NamesUCS2, CoverSize: DefaultCoverSize}
+	// ProfileASCII suits devices that support long file names but
+	// can't display characters outside of ASCII.
+	ProfileASCII = Profile{Name: "ascii", Names: NamesASCII, CoverSize: DefaultCoverSize}
+	// ProfileShortNames suits older devices which only read 8.3 names,
+	// and are unlikely to display album art.
+	ProfileShortNames = Profile{Name: "8.3", Names: NamesShort}
+	// ProfileMP3 suits players, such as many car stereos, which read
+	// USB drives but only play MP3 files. Some write their own index
+	// files to the drive.
+	ProfileMP3 = Profile{
+		Name:      "mp3",
+		Names:     NamesASCII,
+		Format:    FormatMP3,
+		Bitrate:   mp3.DefaultBitrate,
+		Playlists: PlaylistM3U,
+		CoverSize: DefaultCoverSize,
+		Writes:    WriteOverlay,
+	}
+)
+
+// bitrate returns the MP3 bitrate in kbps.
+func (p Profile) bitrate() int {
+	if p.Bitrate == 0 {
+		return mp3.DefaultBitrate
+	}
+	return p.Bitrate
+}
@@ -1,124 +1,95 @@
 package vfs
 
 import (
+	"fmt"
 	"io"
-	"log"
-	"math"
-	"os"
-
-	"github.com/diskfs/go-diskfs/filesystem/fat32"
+	"time"
 )
 
 type vfsReader struct {
-	f           *Filesystem
-	imgFile     *os.File
-	offset      int64
-	trackRanges []TrackRange
+	f      *Filesystem
+	offset int64
+	cur    cursor
 }
 
-// Create an io.Reader that reads from the image for filesystem data
-// and from track wav data when in a track boundary
+// Create an io.Reader that reads the virtual disk image, with
+// filesystem data computed from the CD and track wav data read
+// from the tracks when in a track boundary
 func (f *Filesystem) Reader() (io.ReadSeeker, error) {
-	trackRanges, err := f.TrackRanges()
-	if err != nil {
-		return nil, err
-	}
-	imgf, err := os.Open(f.Path)
-	if err != nil {
-		return nil, err
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if len(f.albums) == 0 {
+		return nil, fmt.Errorf("no CD loaded")
 	}
-	return &vfsReader{f: f, imgFile: imgf, trackRanges: trackRanges, offset: 0}, nil
+	return &vfsReader{f: f, offset: 0}, nil
 }
 
 func (r *vfsReader) Read(p []byte) (int, error) {
-	// if we are within a track, we should read from there instead
-	// otherwise we read from the file
 	// since Read is allowed to read less than requested, we always stop
-	// reading at a track block boundary
-	withinTrack := -1
-	var trackRange fat32.DiskRange
-	var nextTrackBounds uint64 = math.MaxInt64
-	// ...[======]...[=====].[=========]..
-	// ^^          ^--^   ^--------^
-	end := uint64(r.offset) + uint64(len(p))
-	for i, tr := range r.trackRanges {
-		for _, dr := range tr.DiskRanges {
-			if r.offset >= int64(dr.Offset) && r.offset < int64(dr.Offset+dr.Length) {
-				withinTrack = i
-				trackRange = dr
-			}
-			if dr.Offset > uint64(r.offset) && dr.Offset < end {
-				nextTrackBounds = dr.Offset
-			}
-		}
-	}
-
-	size := len(p)
-	if withinTrack == -1 {
-		// read directly from file, up to len(p) or nextTrackBounds, whichever is smaller
-		distanceToNextTrack := int(nextTrackBounds - uint64(r.offset))
-		if size > distanceToNextTrack {
-			size = distanceToNextTrack
-		}
+	// reading at a track boundary
+	r.f.mu.RLock()
+	defer r.f.mu.RUnlock()
+	start := time.Now()
+	n, err := r.f.readRegion(p, r.offset, &r.cur)
+	r.f.traceRead(start, r.offset, len(p), n, err)
+	r.offset += int64(n)
+	return n, err
+}
 
-		n, err := r.imgFile.Read(p[:size])
-		log.Printf("%08d\t%05d\tflash\t%v\n", r.offset, n, err)
-		r.offset += int64(n)
-		return n, err
-	} else {
-		// read from the specified track up to len(p) or trackRange, whichever is smaller
+// ReadAt reads from the image at the given offset, without
+// affecting the read position.
+func (r *vfsReader) ReadAt(p []byte, off int64) (int, error) {
+	r.f.mu.RLock()
+	defer r.f.mu.RUnlock()
+	start := time.Now()
+	n, err := r.f.readAt(p, off)
+	r.f.traceRead(start, off, len(p), n, err)
+	return n, err
+}
 
-		distanceToEndOfRange := int(trackRange.Offset+trackRange.Length) - int(r.offset)
-		if size > distanceToEndOfRange {
-			size = distanceToEndOfRange
-		}
+func (r *vfsReader) Seek(offset int64, whence int) (int64, error) {
+	var newOffset int64
+	switch whence {
+	case io.SeekCurrent:
+		newOffset = r.offset + offset
+	case io.SeekEnd:
+		r.f.mu.RLock()
+		newOffset = r.f.vol.Size() + offset
+		r.f.mu.RUnlock()
+	default:
+		newOffset = offset
+	}
+	if newOffset < 0 {
+		return r.offset, fmt.Errorf("seek before start of disk")
+	}
+	r.offset = newOffset
+	return newOffset, nil
+}
 
-		track := r.f.cd.Tracks[withinTrack]
+// exportChunk is the size of the reads of an export.
+const exportChunk = 1024 * 1024
 
-		// figure out where in the track we are
-		var tOffset int64 = 0
-		for _, dr := range r.trackRanges[withinTrack].DiskRanges {
-			if dr.Offset == trackRange.Offset {
-				break
-			}
-			tOffset += int64(dr.Length)
+// Export writes the whole disk image to w, including the track data and
+// anything the host wrote, such as for writing to a real disk. The
+// filesystem can't be changed until the export is done, so the image is
+// consistent.
+func (f *Filesystem) Export(w io.Writer) error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	size := f.vol.Size()
+	buf := make([]byte, min(exportChunk, size))
+	for off := int64(0); off < size; off += int64(len(buf)) {
+		p := buf[:min(int64(len(buf)), size-off)]
+		if _, err := f.readAt(p, off); err != nil {
+			return fmt.Errorf("reading image at %v: %w", off, err)
 		}
-		tOffset += r.offset - int64(trackRange.Offset)
-		_, err := track.Seek(int64(tOffset), io.SeekStart)
-		if err != nil {
-			return 0, err
-		}
-		// size should also not go beyond the actual track size
-		trackLength := r.trackRanges[withinTrack].FileInfo.Size()
-		distanceToEndOfTrack := int(trackLength - int64(tOffset))
-		if size > distanceToEndOfTrack {
-			// if it does, read to end of track and then read from filesystem
-			n, err := track.Read(p[:distanceToEndOfTrack])
-			log.Printf("%08d\t%05d\twav %v:end\t%v\n", r.offset, n, withinTrack, err)
-			r.offset += int64(n)
-			if err != nil {
-				return n, err
-			}
-
-			n2, err := r.imgFile.Read(p[distanceToEndOfTrack:size])
-			log.Printf("%08d\t%05d\tflash wavend\t%v\n", r.offset, n2, err)
-			r.offset += int64(n2)
-			return n + n2, err
+		if _, err := w.Write(p); err != nil {
+			return err
 		}
-
-		n, err := track.Read(p[:size])
-		log.Printf("%08d\t%05d\twav %v\t%v\n", r.offset, n, withinTrack, err)
-		r.offset += int64(n)
-		return n, err
 	}
-}
-
-func (r *vfsReader) Seek(offset int64, whence int) (int64, error) {
-	// seek position should match file
-	newOffset, err := r.imgFile.Seek(offset, whence)
-	r.offset = newOffset
-	return newOffset, err
+	return nil
 }
 
 // ensure interface conformation
 var _ io.ReadSeeker = (*vfsReader)(nil)
+var _ io.ReaderAt = (*vfsReader)(nil)
@@ -2,14 +2,17 @@ package vfs
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
 	"encoding/binary"
 	"io"
-	"log"
 	"os"
 	"strings"
 	"testing"
 
+	"github.com/rabidaudio/cdz-nuts/audiocd/redbook"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var WAVECD = CD{
@@ -33,25 +36,19 @@ func init() {
 		file := must(os.Open("testdata/" + entry.Name()))
 		sizeBytesRaw := make([]byte, 4)
 		must(file.ReadAt(sizeBytesRaw, 40))
-		must(file.Seek(0, io.SeekStart))
 		sizeBytes := binary.LittleEndian.Uint32(sizeBytesRaw)
+		// serve the PCM data, without the file's header
 		WAVECD.Tracks = append(WAVECD.Tracks, Track{
-			ReadSeeker:   file,
-			Filename:     entry.Name(),
-			LengthFrames: uint(sizeBytes) / 2 / 6,
+			ReadSeeker:    io.NewSectionReader(file, WavHeaderSize, int64(sizeBytes)),
+			Filename:      entry.Name(),
+			LengthSectors: int(sizeBytes) / redbook.BytesPerSector,
 		})
 	}
 }
 
 func TestReader(t *testing.T) {
-	var buf bytes.Buffer
-	log.SetOutput(&buf)
-	defer func() {
-		log.SetOutput(os.Stderr)
-		t.Log(buf.String())
-	}()
-
-	fsys, err := Create()
+	// a fixed time, so that images from different runs can be diffed
+	fsys, err := CreateWith(Options{Time: testTime})
 	assert.NoError(t, err)
 	defer fsys.Close()
 
@@ -68,7 +65,68 @@ func TestReader(t *testing.T) {
 
 	n, err := io.Copy(out, reader)
 	assert.NoError(t, err)
-	assert.GreaterOrEqual(t, n, DISK_SIZE)
+	assert.Equal(t, int64(DISK_SIZE), n)
+}
+
+// exportImage creates a small disk with the given options and a CD
+// loaded, and exports it.
+func exportImage(t *testing.T, opts Options) (*Filesystem, []byte) {
+	fsys, err := CreateWith(opts)
+	require.NoError(t, err)
+	require.NoError(t, fsys.SetLayout(Layout{Type: FAT32, Superfloppy: true, Size: 64 * 1024 * 1024}))
+	require.NoError(t, fsys.LoadCD(testDisc()))
+	var buf bytes.Buffer
+	require.NoError(t, fsys.Export(&buf))
+	return fsys, buf.Bytes()
+}
+
+func TestExport(t *testing.T) {
+	opts := Options{Time: testTime, Serial: 0x12345678, Label: "GOLDEN"}
+	fsys, image := exportImage(t, opts)
+	defer fsys.Close()
+	assert.Equal(t, fsys.BlockCount()*SECTOR_SIZE, int64(len(image)))
+
+	// the image is what the host reads
+	want := make([]byte, len(image))
+	require.NoError(t, fsys.ReadBlocks(context.Background(), 0, want))
+	assert.True(t, bytes.Equal(want, image))
+
+	assert.Equal(t, uint32(0x12345678), binary.LittleEndian.Uint32(image[67:]))
+	tv, err := openTestVolume(bytes.NewReader(image))
+	require.NoError(t, err)
+	assert.Equal(t, "GOLDEN", tv.label)
+
+	// and is the same every time
+	other, again := exportImage(t, opts)
+	defer other.Close()
+	assert.Equal(t, sha256.Sum256(image), sha256.Sum256(again))
+
+	// except with different options
+	opts.Serial++
+	other, changed := exportImage(t, opts)
+	defer other.Close()
+	assert.NotEqual(t, sha256.Sum256(image), sha256.Sum256(changed))
+}
+
+func TestExportOverlay(t *testing.T) {
+	fsys := writableDisk(t, WriteOverlay)
+	defer fsys.Close()
+	data := bytes.Repeat([]byte{0xA5}, SECTOR_SIZE)
+	require.NoError(t, fsys.WriteBlocks(context.Background(), 2, data))
+
+	var buf bytes.Buffer
+	require.NoError(t, fsys.Export(&buf))
+	assert.Equal(t, data, buf.Bytes()[2*SECTOR_SIZE:3*SECTOR_SIZE])
+}
+
+func TestCreateWithLabel(t *testing.T) {
+	_, err := CreateWith(Options{Label: "MUCH TOO LONG"})
+	assert.ErrorContains(t, err, "longer than 11")
+
+	fsys, err := CreateWith(Options{})
+	require.NoError(t, err)
+	defer fsys.Close()
+	assert.Equal(t, DefaultLabel, fsys.vol.label)
 }
 
 func TestReaderCompare(t *testing.T) {
@@ -79,20 +137,22 @@ func TestReaderCompare(t *testing.T) {
 	err = fsys.LoadCD(WAVECD)
 	assert.NoError(t, err)
 
+	// read the tracks back with an independent FAT implementation
+	pfs := parseImage(t, fsys)
 	for i, tr := range WAVECD.Tracks {
-		name, _ := trackPath(WAVECD, i)
-		tf, err := fsys.fs.OpenFile(name, os.O_RDWR)
+		name, _ := fsys.trackPath(WAVECD, i)
+		tf, err := pfs.OpenFile(name, os.O_RDONLY)
+		assert.NoError(t, err)
+		actual, err := io.ReadAll(tf)
 		assert.NoError(t, err)
 
-		tf.Seek(0, io.SeekStart)
-		_, err = io.Copy(tf, tr)
+		_, err = tr.Seek(0, io.SeekStart)
+		assert.NoError(t, err)
+		expected, err := io.ReadAll(tr)
 		assert.NoError(t, err)
+		assert.Equal(t, trackSizeBytes(WAVECD, i), int64(len(actual)))
+		assert.Equal(t, trackHeader(WAVECD, i), actual[:WavHeaderSize])
+		pcm := actual[WavHeaderSize:]
+		assert.True(t, bytes.Equal(expected[:len(pcm)], pcm), "track %v differs", name)
 	}
-
-	out, err := os.Create("testdata/compare.img")
-	assert.NoError(t, err)
-	in, err := os.Open(fsys.Path)
-	assert.NoError(t, err)
-	_, err = io.Copy(out, in)
-	assert.NoError(t, err)
 }
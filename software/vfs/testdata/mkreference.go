@@ -0,0 +1,156 @@
+//go:build ignore
+
+// mkreference builds chronic_town.img.gz, the reference image for
+// TestReferenceImage, with go-diskfs instead of the vfs package, from a
+// description of what the image of CHRONIC_TOWN should hold. The track
+// headers are written out by hand here too. Run it from the vfs
+// directory with
+//
+//	go run testdata/mkreference.go
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/diskfs/go-diskfs/backend/file"
+	"github.com/diskfs/go-diskfs/filesystem/fat32"
+)
+
+const (
+	out        = "testdata/chronic_town.img.gz"
+	imageSize  = 300 * 1024 * 1024
+	sectorSize = 512
+
+	label  = "CHRONIC TOW"
+	dir    = "/R.E.M. - Chronic Town"
+	artist = "R.E.M."
+	album  = "Chronic Town"
+
+	bytesPerCDSector = 2352
+	cdSectorsPerSec  = 75
+)
+
+var tracks = []struct {
+	title    string
+	min, sec int
+}{
+	{"Wolves, Lower", 4, 15},
+	{"Gardening at Night", 3, 30},
+	{"Carnival of Sorts (Box Cars)", 3, 52},
+	{"1,000,000", 3, 6},
+	{"Stumble", 5, 40},
+}
+
+func main() {
+	img, err := os.CreateTemp("", "chronic_town*.img")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.Remove(img.Name())
+	if err := img.Truncate(imageSize); err != nil {
+		log.Fatal(err)
+	}
+
+	fs, err := fat32.Create(file.New(img, false), imageSize, 0, sectorSize, label)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := fs.Mkdir(dir); err != nil {
+		log.Fatal(err)
+	}
+	for i, t := range tracks {
+		name := fmt.Sprintf("%s/%02d - %s.wav", dir, i+1, t.title)
+		f, err := fs.OpenFile(name, os.O_CREATE|os.O_RDWR)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if _, err := f.Write(wavFile(i+1, t.title, t.min, t.sec)); err != nil {
+			log.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	w, err := os.Create(out)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := writeSparse(w, img); err != nil {
+		log.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// wavFile returns a silent track: a WAV file with INFO and ID3 tags.
+func wavFile(n int, title string, min, sec int) []byte {
+	trk := fmt.Sprintf("%d/%d", n, len(tracks))
+
+	var fmtChunk bytes.Buffer
+	for _, v := range []any{uint16(1), uint16(2), uint32(44100), uint32(44100 * 4), uint16(4), uint16(16)} {
+		binary.Write(&fmtChunk, binary.LittleEndian, v)
+	}
+	info := []byte("INFO")
+	info = append(info, chunk("INAM", []byte(title+"\x00"))...)
+	info = append(info, chunk("IART", []byte(artist+"\x00"))...)
+	info = append(info, chunk("IPRD", []byte(album+"\x00"))...)
+	info = append(info, chunk("ITRK", []byte(trk+"\x00"))...)
+
+	var frames []byte
+	for _, f := range [][2]string{{"TIT2", title}, {"TPE1", artist}, {"TALB", album}, {"TRCK", trk}} {
+		frames = append(frames, f[0]...)
+		frames = binary.BigEndian.AppendUint32(frames, uint32(1+len(f[1])))
+		frames = append(frames, 0, 0, 0) // flags, ISO-8859-1
+		frames = append(frames, f[1]...)
+	}
+	// ID3v2.3, with a syncsafe size
+	id3 := []byte{'I', 'D', '3', 3, 0, 0}
+	size := len(frames)
+	id3 = append(id3, byte(size>>21&0x7F), byte(size>>14&0x7F), byte(size>>7&0x7F), byte(size&0x7F))
+	id3 = append(id3, frames...)
+
+	data := make([]byte, (min*60+sec)*cdSectorsPerSec*bytesPerCDSector)
+	wave := []byte("WAVE")
+	wave = append(wave, chunk("fmt ", fmtChunk.Bytes())...)
+	wave = append(wave, chunk("LIST", info)...)
+	wave = append(wave, chunk("id3 ", id3)...)
+	wave = append(wave, chunk("data", data)...)
+	return chunk("RIFF", wave)
+}
+
+// chunk returns a RIFF chunk, padded to an even size.
+func chunk(id string, data []byte) []byte {
+	b := append([]byte(id), binary.LittleEndian.AppendUint32(nil, uint32(len(data)))...)
+	b = append(b, data...)
+	if len(data)%2 == 1 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// writeSparse writes the image in the format readSparse in fat_test.go
+// reads: the LBA and contents of every sector that isn't all zeros.
+func writeSparse(w io.Writer, img io.ReaderAt) error {
+	zw := gzip.NewWriter(w)
+	zero := make([]byte, sectorSize)
+	s := make([]byte, sectorSize)
+	for lba := range uint32(imageSize / sectorSize) {
+		if _, err := img.ReadAt(s, int64(lba)*sectorSize); err != nil {
+			return err
+		}
+		if bytes.Equal(s, zero) {
+			continue
+		}
+		binary.Write(zw, binary.LittleEndian, lba)
+		zw.Write(s)
+	}
+	return zw.Close()
+}
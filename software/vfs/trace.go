@@ -0,0 +1,393 @@
+package vfs
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Trace operations. A trace starts with a snapshot of the disk, and
+// records every change to it, so that the host's reads can be replayed
+// against the same files.
+const (
+	TraceDisk      = "disk"      // the configuration and contents of the disk
+	TraceLoad      = "load"      // a CD was loaded
+	TraceEject     = "eject"     // a CD was ejected, or every CD if Name is empty
+	TracePlaylists = "playlists" // the virtual playlists changed
+	TraceTemplate  = "template"  // the track template changed
+	TraceFit       = "fit"       // the disk was resized to fit
+	TraceRead      = "read"      // the host read from the disk
+	TraceWrite     = "write"     // the host wrote to the disk
+)
+
+// TraceEvent is a line of a trace, in JSON.
+type TraceEvent struct {
+	Op   string    `json:"op"`
+	Time time.Time `json:"time"`
+
+	// for reads and writes, the sectors requested, how many bytes were
+	// read and the region of the disk holding the first sector: "mbr", "boot",
+	// "fat", "root" (the fixed root directory of FAT12 and FAT16),
+	// "free", "unused" (before the partition), or the path of a file or
+	// directory
+	LBA     int64         `json:"lba,omitempty"`
+	Count   int           `json:"count,omitempty"`
+	Bytes   int           `json:"bytes,omitempty"`
+	Region  string        `json:"region,omitempty"`
+	Latency time.Duration `json:"latency,omitempty"`
+	Err     string        `json:"err,omitempty"`
+
+	Disk      *TraceDiskInfo `json:"disk,omitempty"`
+	Album     *TraceAlbum    `json:"album,omitempty"`
+	Name      string         `json:"name,omitempty"`
+	Template  string         `json:"template,omitempty"`
+	Playlists []Playlist     `json:"playlists,omitempty"`
+}
+
+// TraceDiskInfo is a snapshot of a filesystem. CDs are recorded in the
+// order they were loaded, so if CDs were ejected before the trace began,
+// the files of a replayed disk may be placed differently.
+type TraceDiskInfo struct {
+	Created    time.Time    `json:"created"`
+	Serial     uint32       `json:"serial,omitempty"` // as given in the options
+	Label      string       `json:"label,omitempty"`
+	Layout     Layout       `json:"layout"`
+	Profile    Profile      `json:"profile"`
+	ArtistDirs bool         `json:"artistDirs,omitempty"`
+	Template   string       `json:"template"`
+	Albums     []TraceAlbum `json:"albums,omitempty"`
+	Playlists  []Playlist   `json:"playlists,omitempty"`
+}
+
+// TraceAlbum is a loaded CD, without its audio. The cover is recorded
+// as it was scaled for the profile.
+type TraceAlbum struct {
+	Name       string       `json:"name"`
+	Title      string       `json:"title,omitempty"`
+	Artist     string       `json:"artist,omitempty"`
+	Cover      []byte       `json:"cover,omitempty"`
+	WholeDisc  bool         `json:"wholeDisc,omitempty"`
+	Tracks     []TraceTrack `json:"tracks"`
+	DataTracks []TraceTrack `json:"dataTracks,omitempty"`
+}
+
+// TraceTrack is a track of a CD, without its audio.
+type TraceTrack struct {
+	Filename string `json:"filename,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Artist   string `json:"artist,omitempty"`
+	Sectors  int    `json:"sectors"`
+	Start    int    `json:"start,omitempty"`
+}
+
+func traceAlbum(cd CD) *TraceAlbum {
+	ta := &TraceAlbum{Name: cd.Name, Title: cd.Title, Artist: cd.Artist, Cover: cd.Cover, WholeDisc: cd.WholeDisc}
+	for _, t := range cd.Tracks {
+		ta.Tracks = append(ta.Tracks, TraceTrack{
+			Filename: t.Filename,
+			Title:    t.Title,
+			Artist:   t.Artist,
+			Sectors:  t.LengthSectors,
+			Start:    t.StartSector,
+		})
+	}
+	for _, t := range cd.DataTracks {
+		ta.DataTracks = append(ta.DataTracks, TraceTrack{Sectors: t.LengthSectors, Start: t.StartSector})
+	}
+	return ta
+}
+
+// cd returns the CD of the album, with silent tracks.
+func (ta *TraceAlbum) cd() CD {
+	cd := CD{Name: ta.Name, Title: ta.Title, Artist: ta.Artist, Cover: ta.Cover, WholeDisc: ta.WholeDisc}
+	for _, t := range ta.Tracks {
+		cd.Tracks = append(cd.Tracks, Track{
+			Filename:      t.Filename,
+			Title:         t.Title,
+			Artist:        t.Artist,
+			LengthSectors: t.Sectors,
+			StartSector:   t.Start,
+		})
+	}
+	for _, t := range ta.DataTracks {
+		cd.DataTracks = append(cd.DataTracks, Track{LengthSectors: t.Sectors, StartSector: t.Start})
+	}
+	return cd
+}
+
+// tracer writes trace events as JSON lines. It's safe for concurrent use.
+type tracer struct {
+	mu  sync.Mutex
+	w   *bufio.Writer
+	enc *json.Encoder
+	err error
+}
+
+func (t *tracer) write(ev TraceEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.err != nil {
+		return
+	}
+	t.err = t.enc.Encode(ev)
+	// reads and writes are frequent, so only changes to the disk are
+	// flushed straight away
+	if t.err == nil && ev.Op != TraceRead && ev.Op != TraceWrite {
+		t.err = t.w.Flush()
+	}
+}
+
+// StartTrace records the host's reads from the disk, and changes to
+// the disk, to w as JSON lines, replacing any trace in progress. The
+// trace can be replayed with [Replay].
+func (f *Filesystem) StartTrace(w io.Writer) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.stopTrace(); err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	t := &tracer{w: bw, enc: json.NewEncoder(bw)}
+	t.write(TraceEvent{Op: TraceDisk, Time: time.Now(), Disk: f.traceDiskInfo()})
+	if t.err != nil {
+		return t.err
+	}
+	f.trace = t
+	return nil
+}
+
+// StopTrace stops tracing, returning the first error writing the
+// trace, if any.
+func (f *Filesystem) StopTrace() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.stopTrace()
+}
+
+func (f *Filesystem) stopTrace() error {
+	t := f.trace
+	if t == nil {
+		return nil
+	}
+	f.trace = nil
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.err == nil {
+		t.err = t.w.Flush()
+	}
+	return t.err
+}
+
+// traceDiskInfo takes a snapshot of the filesystem.
+func (f *Filesystem) traceDiskInfo() *TraceDiskInfo {
+	d := &TraceDiskInfo{
+		Created:    f.vol.created,
+		Serial:     f.opts.Serial,
+		Label:      f.opts.Label,
+		Layout:     f.layout,
+		Profile:    f.profile,
+		ArtistDirs: f.artistDirs,
+		Template:   f.trackTmpl.Root.String(),
+		Playlists:  f.playlists,
+	}
+	for _, a := range f.albums {
+		d.Albums = append(d.Albums, *traceAlbum(a.cd))
+	}
+	return d
+}
+
+// traceEvent records an event, if tracing.
+func (f *Filesystem) traceEvent(ev TraceEvent) {
+	if t := f.trace; t != nil {
+		ev.Time = time.Now()
+		t.write(ev)
+	}
+}
+
+// traceRead records a read of n bytes of the size requested at off,
+// which started at start.
+func (f *Filesystem) traceRead(start time.Time, off int64, size, n int, err error) {
+	t := f.trace
+	if t == nil {
+		return
+	}
+	ev := TraceEvent{
+		Op:      TraceRead,
+		Time:    start,
+		Latency: time.Since(start),
+		LBA:     off / SECTOR_SIZE,
+		Count:   int((off+int64(size)+SECTOR_SIZE-1)/SECTOR_SIZE - off/SECTOR_SIZE),
+		Bytes:   n,
+		Region:  f.vol.region(off / SECTOR_SIZE),
+	}
+	if err != nil {
+		ev.Err = err.Error()
+	}
+	t.write(ev)
+}
+
+// traceWrite records a write of size bytes at lba, which started at
+// start.
+func (f *Filesystem) traceWrite(start time.Time, lba int64, size int, err error) {
+	t := f.trace
+	if t == nil {
+		return
+	}
+	ev := TraceEvent{
+		Op:      TraceWrite,
+		Time:    start,
+		Latency: time.Since(start),
+		LBA:     lba,
+		Count:   size / SECTOR_SIZE,
+		Region:  f.vol.region(lba),
+	}
+	if err != nil {
+		ev.Err = err.Error()
+	}
+	t.write(ev)
+}
+
+// ReplayStats summarizes a replayed trace.
+type ReplayStats struct {
+	Reads int
+	Bytes int64
+	// Mismatches counts reads of a different region of the disk than
+	// was recorded.
+	Mismatches int
+	// Latency is the total time taken by the reads, and Recorded the
+	// total recorded.
+	Latency, Recorded time.Duration
+	MaxLatency        time.Duration
+}
+
+// Replay reads a trace recorded with [Filesystem.StartTrace] and
+// repeats it against a filesystem with the same CDs, whose tracks are
+// silent. Writes aren't recorded, so they're replayed with zeros. If
+// realtime, events are replayed with the recorded delays between them,
+// otherwise as fast as possible.
+func Replay(r io.Reader, realtime bool) (ReplayStats, error) {
+	var stats ReplayStats
+	var f *Filesystem
+	var rd *vfsReader
+	var buf []byte
+	var last time.Time
+	defer func() {
+		if f != nil {
+			_ = f.Close()
+		}
+	}()
+	dec := json.NewDecoder(r)
+	for line := 1; ; line++ {
+		var ev TraceEvent
+		if err := dec.Decode(&ev); err == io.EOF {
+			return stats, nil
+		} else if err != nil {
+			return stats, fmt.Errorf("invalid trace: %w", err)
+		}
+		if realtime && !last.IsZero() {
+			time.Sleep(ev.Time.Sub(last))
+		}
+		last = ev.Time
+		if f == nil && ev.Op != TraceDisk {
+			return stats, fmt.Errorf("trace doesn't start with the disk")
+		}
+
+		var err error
+		switch ev.Op {
+		case TraceDisk:
+			if ev.Disk == nil {
+				return stats, fmt.Errorf("line %d: missing disk", line)
+			}
+			if f != nil {
+				_ = f.Close()
+			}
+			f, err = ev.Disk.filesystem()
+			rd = &vfsReader{f: f}
+		case TraceLoad:
+			if ev.Album == nil {
+				return stats, fmt.Errorf("line %d: missing album", line)
+			}
+			err = f.loadCD(ev.Album.cd())
+		case TraceEject:
+			if ev.Name == "" {
+				err = f.EjectAll()
+			} else {
+				err = f.Eject(ev.Name)
+			}
+		case TracePlaylists:
+			f.playlists = ev.Playlists
+			err = f.relayout()
+		case TraceTemplate:
+			err = f.SetTrackTemplate(ev.Template)
+		case TraceFit:
+			err = f.Fit()
+		case TraceRead:
+			if n := ev.Count * SECTOR_SIZE; n > len(buf) {
+				buf = make([]byte, n)
+			}
+			rd.offset = ev.LBA * SECTOR_SIZE
+			start := time.Now()
+			n, _ := rd.Read(buf[:ev.Count*SECTOR_SIZE])
+			latency := time.Since(start)
+
+			stats.Reads++
+			stats.Bytes += int64(n)
+			stats.Latency += latency
+			stats.Recorded += ev.Latency
+			stats.MaxLatency = max(stats.MaxLatency, latency)
+			if f.vol.region(ev.LBA) != ev.Region {
+				stats.Mismatches++
+			}
+		case TraceWrite:
+			// writes that failed when recorded should fail again
+			werr := f.WriteBlocks(context.Background(), ev.LBA, make([]byte, ev.Count*SECTOR_SIZE))
+			if (werr != nil) != (ev.Err != "") || f.vol.region(ev.LBA) != ev.Region {
+				stats.Mismatches++
+			}
+		default:
+			return stats, fmt.Errorf("line %d: unknown operation %q", line, ev.Op)
+		}
+		if err != nil {
+			return stats, fmt.Errorf("line %d: %v: %w", line, ev.Op, err)
+		}
+	}
+}
+
+// filesystem creates a filesystem from the snapshot.
+func (d *TraceDiskInfo) filesystem() (_ *Filesystem, err error) {
+	f, err := create(Options{Time: d.Created, Serial: d.Serial, Label: d.Label})
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			_ = f.Close()
+		}
+	}()
+	if err := f.SetLayout(d.Layout); err != nil {
+		return nil, err
+	}
+	if err := f.SetProfile(d.Profile); err != nil {
+		return nil, err
+	}
+	if err := f.SetArtistDirs(d.ArtistDirs); err != nil {
+		return nil, err
+	}
+	if err := f.SetTrackTemplate(d.Template); err != nil {
+		return nil, err
+	}
+	for _, a := range d.Albums {
+		if err := f.loadCD(a.cd()); err != nil {
+			return nil, err
+		}
+	}
+	f.playlists = d.Playlists
+	if err := f.relayout(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,170 @@
+package vfs
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readTrace parses the events of a trace.
+func readTrace(t *testing.T, trace []byte) []TraceEvent {
+	var events []TraceEvent
+	dec := json.NewDecoder(bytes.NewReader(trace))
+	for {
+		var ev TraceEvent
+		if err := dec.Decode(&ev); err == io.EOF {
+			return events
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, ev)
+	}
+}
+
+func TestTrace(t *testing.T) {
+	fsys := createAt(t, testTime)
+	defer fsys.Close()
+	cd := testDisc()
+	cd.Cover = testCover(t, 10, 10)
+	require.NoError(t, fsys.LoadCD(cd))
+	require.NoError(t, fsys.LoadCD(MURMUR))
+
+	var buf bytes.Buffer
+	require.NoError(t, fsys.StartTrace(&buf))
+	r, err := fsys.Reader()
+	require.NoError(t, err)
+	read := func(lba int64, sectors int) {
+		_, err := r.Seek(lba*SECTOR_SIZE, io.SeekStart)
+		require.NoError(t, err)
+		_, err = r.Read(make([]byte, sectors*SECTOR_SIZE))
+		require.NoError(t, err)
+	}
+	track := func(cd CD, i int) int64 {
+		return fsys.vol.clusterOffset(fsys.album(cd.Name).tracks[i].cluster) / SECTOR_SIZE
+	}
+
+	read(0, 1)
+	read(int64(fsys.vol.start+fsys.vol.reservedSectors), 8)
+	read(track(MURMUR, 1), 64)
+	require.NoError(t, fsys.Eject(cd.Name))
+	require.NoError(t, fsys.SetTrackTemplate("{{.Title}}"))
+	require.NoError(t, fsys.LoadCD(CHRONIC_TOWN))
+	require.NoError(t, fsys.AddPlaylist(Playlist{Name: "Mix", Tracks: []PlaylistTrack{{CHRONIC_TOWN.Name, 2}}}))
+	read(track(CHRONIC_TOWN, 1), 16)
+	_, err = r.(io.ReaderAt).ReadAt(make([]byte, 100), track(MURMUR, 0)*SECTOR_SIZE+10)
+	require.NoError(t, err)
+	require.NoError(t, fsys.StopTrace())
+	// no longer traced
+	read(0, 1)
+
+	events := readTrace(t, buf.Bytes())
+	var ops []string
+	for _, ev := range events {
+		ops = append(ops, ev.Op)
+	}
+	assert.Equal(t, []string{
+		TraceDisk, TraceRead, TraceRead, TraceRead, TraceEject, TraceTemplate,
+		TraceLoad, TracePlaylists, TraceRead, TraceRead,
+	}, ops)
+
+	disk := events[0].Disk
+	require.NotNil(t, disk)
+	assert.Equal(t, DefaultLayout, disk.Layout)
+	assert.Equal(t, ProfileDefault, disk.Profile)
+	assert.Equal(t, testTime, disk.Created)
+	require.Len(t, disk.Albums, 2)
+	assert.Equal(t, cd.Name, disk.Albums[0].Name)
+	assert.Equal(t, fsys.album(MURMUR.Name).cd.Tracks[2].LengthSectors, disk.Albums[1].Tracks[2].Sectors)
+	assert.NotEmpty(t, disk.Albums[0].Cover)
+
+	reads := []TraceEvent{events[1], events[2], events[3], events[8], events[9]}
+	assert.Equal(t, "mbr", reads[0].Region)
+	assert.Equal(t, "fat", reads[1].Region)
+	assert.Equal(t, int64(fsys.vol.start+fsys.vol.reservedSectors), reads[1].LBA)
+	assert.Equal(t, 8, reads[1].Count)
+	assert.Equal(t, 8*SECTOR_SIZE, reads[1].Bytes)
+	assert.Equal(t, "/R.E.M. - Murmur/02 - Pilgrimage.wav", reads[2].Region)
+	assert.Equal(t, "/R.E.M. - Chronic Town/Gardening at Night.wav", reads[3].Region)
+	assert.Equal(t, track(MURMUR, 0), reads[4].LBA)
+	assert.Equal(t, 1, reads[4].Count)
+	assert.Equal(t, 100, reads[4].Bytes)
+	for _, ev := range reads {
+		assert.Positive(t, ev.Latency)
+		assert.Empty(t, ev.Err)
+	}
+	assert.Equal(t, CHRONIC_TOWN.Name, events[6].Album.Name)
+	assert.Equal(t, cd.Name, events[4].Name)
+
+	// the replayed reads hit the same files, though the CD that was
+	// ejected left a gap
+	stats, err := Replay(bytes.NewReader(buf.Bytes()), false)
+	require.NoError(t, err)
+	assert.Equal(t, 5, stats.Reads)
+	assert.Equal(t, int64(SECTOR_SIZE+8*SECTOR_SIZE+64*SECTOR_SIZE+16*SECTOR_SIZE+SECTOR_SIZE), stats.Bytes)
+	assert.Zero(t, stats.Mismatches)
+	assert.Positive(t, stats.Latency)
+	assert.Positive(t, stats.Recorded)
+}
+
+func TestTraceLayoutChanges(t *testing.T) {
+	fsys := createAt(t, testTime)
+	defer fsys.Close()
+	var buf bytes.Buffer
+	require.NoError(t, fsys.StartTrace(&buf))
+
+	require.NoError(t, fsys.SetProfile(ProfileMP3))
+	require.NoError(t, fsys.SetLayout(Layout{Type: FAT16, Size: 64 * 1024 * 1024}))
+	require.NoError(t, fsys.SetArtistDirs(true))
+	require.NoError(t, fsys.LoadCD(MURMUR))
+	require.NoError(t, fsys.Fit())
+	r, err := fsys.Reader()
+	require.NoError(t, err)
+	rootLBA := int64(fsys.vol.start + fsys.vol.reservedSectors + fsys.vol.fatCount*fsys.vol.fatSectors)
+	for lba := int64(0); lba < fsys.vol.Size()/SECTOR_SIZE; lba += 61 {
+		r.Seek(lba*SECTOR_SIZE, io.SeekStart)
+		_, err := r.Read(make([]byte, SECTOR_SIZE))
+		require.NoError(t, err)
+	}
+	r.Seek(rootLBA*SECTOR_SIZE, io.SeekStart)
+	_, err = r.Read(make([]byte, SECTOR_SIZE))
+	require.NoError(t, err)
+	require.NoError(t, fsys.EjectAll())
+	require.NoError(t, fsys.StopTrace())
+
+	events := readTrace(t, buf.Bytes())
+	regions := make(map[string]bool)
+	for _, ev := range events {
+		regions[ev.Region] = true
+	}
+	assert.True(t, regions["root"])
+	assert.True(t, regions["/R.E.M/Murmur/01 - Radio Free Europe.mp3"])
+	last := events[len(events)-1]
+	assert.Equal(t, TraceEject, last.Op)
+	assert.Empty(t, last.Name)
+
+	stats, err := Replay(bytes.NewReader(buf.Bytes()), false)
+	require.NoError(t, err)
+	assert.Zero(t, stats.Mismatches)
+	assert.Equal(t, len(events)-7, stats.Reads) // all but the changes to the disk
+}
+
+func TestReplayErrors(t *testing.T) {
+	_, err := Replay(strings.NewReader(`{"op":"read","lba":0,"count":1}`), false)
+	assert.ErrorContains(t, err, "doesn't start with the disk")
+	_, err = Replay(strings.NewReader(`{"op":"disk"`), false)
+	assert.ErrorContains(t, err, "invalid trace")
+
+	fsys := createAt(t, testTime)
+	defer fsys.Close()
+	var buf bytes.Buffer
+	require.NoError(t, fsys.StartTrace(&buf))
+	require.NoError(t, fsys.StopTrace())
+	buf.WriteString(`{"op":"eject","name":"Missing"}` + "\n")
+	_, err = Replay(&buf, false)
+	assert.ErrorContains(t, err, "line 2: eject")
+}
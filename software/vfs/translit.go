@@ -0,0 +1,79 @@
+package vfs
+
+import (
+	"strings"
+	"unicode"
+)
+
+// translitSymbols maps common punctuation and symbols to ASCII.
+var translitSymbols = map[rune]string{
+	'‘': "'", '’': "'", '‚': "'", '‛': "'", '′': "'", '´': "'", '`': "'",
+	'“': `"`, '”': `"`, '„': `"`, '‟': `"`, '″': `"`, '«': `"`, '»': `"`,
+	'‹': "'", '›': "'",
+	'‐': "-", '‑': "-", '‒': "-", '–': "-", '—': "-", '―': "-", '−': "-",
+	'…': "...", '·': ".", '•': "-", '¡': "!", '¿': "?",
+	'×': "x", '÷': "-", '±': "+-", '°': "deg", 'µ': "u",
+	'¼': "1/4", '½': "1/2", '¾': "3/4",
+	'¹': "1", '²': "2", '³': "3",
+	'©': "(c)", '®': "(R)", '™': "TM", '℗': "(P)", '§': "S", '¶': "P",
+	'€': "EUR", '£': "GBP", '¥': "JPY", '¢': "c",
+	'♯': "#", '♭': "b", '♮': "", '№': "No",
+}
+
+// Transliterate replaces characters that aren't ASCII with ASCII
+// approximations, for hosts that can't display them. Letters without
+// an approximation are replaced by '_', while other symbols, such as
+// emoji, are removed.
+func Transliterate(s string) string {
+	var sb strings.Builder
+	sb.Grow(len(s))
+	for _, r := range s {
+		switch {
+		case r < 0x80:
+			sb.WriteRune(r)
+		case unicode.IsSpace(r):
+			sb.WriteByte(' ')
+		case translitLetters[r] != "":
+			sb.WriteString(translitLetters[r])
+		default:
+			if t, ok := translitSymbols[r]; ok {
+				sb.WriteString(t)
+			} else if unicode.IsLetter(r) || unicode.IsNumber(r) {
+				sb.WriteByte('_')
+			}
+			// combining marks, variation selectors, and other
+			// symbols are dropped
+		}
+	}
+	return sb.String()
+}
+
+// longName makes a name valid as a long file name under the policy.
+func (p NamePolicy) longName(name string) string {
+	if p == NamesUCS2 {
+		return longName(transliterateSupplementary(name))
+	}
+	return longName(Transliterate(name))
+}
+
+// transliterateSupplementary transliterates only the characters that
+// can't be represented in UCS-2.
+func transliterateSupplementary(s string) string {
+	var sb strings.Builder
+	sb.Grow(len(s))
+	for _, r := range s {
+		if r > 0xFFFF {
+			sb.WriteString(Transliterate(string(r)))
+		} else {
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// fatReplacements maps characters that aren't allowed in FAT long file
+// names to similar allowed ones.
+var fatReplacements = map[rune]rune{
+	'"': '\'', '/': '-', '\\': '-', ':': '-', '|': '-',
+	'*': '_', '?': '_', '<': '_', '>': '_',
+}
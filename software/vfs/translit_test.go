@@ -0,0 +1,131 @@
+package vfs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransliterate(t *testing.T) {
+	cases := []struct {
+		in, out string
+	}{
+		{"", ""},
+		{"plain ascii", "plain ascii"},
+		{"I luv ĀḞÍ♥︎✨ :3", "I luv AFI :3"},
+		{"Björk", "Bjork"},
+		{"Sigur Rós - Ágætis byrjun", "Sigur Ros - Agaetis byrjun"},
+		{"Motörhead", "Motorhead"},
+		{"Mötley Crüe", "Motley Crue"},
+		{"Beyoncé", "Beyonce"},
+		{"Straße", "Strasse"},
+		{"Œuvre", "OEuvre"},
+		{"Łódź", "Lodz"},
+		{"Dvořák", "Dvorak"},
+		{"Ærøskøbing", "AEroskobing"},
+		{"Þórr", "Thorr"},
+		{"Nguyễn", "Nguyen"},
+		{"Чайковский", "Chaykovskiy"},
+		{"Щедрин", "Shchedrin"},
+		{"Юрий Ёлкин", "Yuriy Yolkin"},
+		{"Євген", "Yevgen"},
+		{"Μίκης Θεοδωράκης", "Mikis Theodorakis"},
+		{"Ψυχή", "Psychi"},
+		{"“Quoted” ‘words’", `"Quoted" 'words'`},
+		{"Rock – Roll — Live…", "Rock - Roll - Live..."},
+		{"Symphony № 5 in C♯", "Symphony No 5 in C#"},
+		{"50¢ © 1999 ™", "50c (c) 1999 TM"},
+		{"½ Life", "1/2 Life"},
+		{"non breaking", "non breaking"},
+		{"é", "e"}, // decomposed accent
+		{"🎸 Guitar 🎸", " Guitar "},
+		{"日本", "__"},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.out, Transliterate(c.in), c.in)
+	}
+}
+
+func TestNamePolicy(t *testing.T) {
+	cases := []struct {
+		policy  NamePolicy
+		in, out string
+	}{
+		{NamesUCS2, "Björk", "Björk"},
+		{NamesUCS2, "Чайковский", "Чайковский"},
+		{NamesUCS2, "I ♥ 🎸", "I ♥"},
+		{NamesUCS2, "AC/DC", "AC-DC"},
+		{NamesUCS2, "日本", "日本"},
+		{NamesASCII, "Björk", "Bjork"},
+		{NamesASCII, "Чайковский", "Chaykovskiy"},
+		{NamesASCII, "I ♥ 🎸", "I"},
+		{NamesASCII, "What?: “Live”", "What_- 'Live'"},
+		{NamesShort, "Sigur Rós", "Sigur Ros"},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.out, c.policy.longName(c.in), c.in)
+	}
+}
+
+// TestShortBasis covers transliteration in short names, see also
+// TestSanitizeName
+func TestShortBasis(t *testing.T) {
+	cases := []struct {
+		in, out string
+	}{
+		{"Ünïcödé", "UNICODE"},
+		{"Борис", "BORIS"},
+		{"a+b=c", "A_B_C"},
+	}
+	for _, c := range cases {
+		base, _, _ := basisName(c.in, false)
+		assert.Equal(t, c.out, base, c.in)
+	}
+}
+
+func TestProfileShortNames(t *testing.T) {
+	fsys := createAt(t, testTime)
+	defer fsys.Close()
+
+	err := fsys.SetProfile(ProfileShortNames)
+	assert.NoError(t, err)
+	err = fsys.LoadCD(CHRONIC_TOWN)
+	assert.NoError(t, err)
+	err = fsys.SetProfile(ProfileDefault)
+	assert.Error(t, err)
+
+	pfs := parseImage(t, fsys)
+	root, err := pfs.ReadDir("/")
+	assert.NoError(t, err)
+	// unique names don't need a numeric tail, and directories have no
+	// extension
+	assert.Equal(t, "REM-CHRO", root[0].Name())
+	files, err := pfs.ReadDir("/REM-CHRO")
+	assert.NoError(t, err)
+	var names []string
+	for _, fi := range files[2:] {
+		names = append(names, fi.Name())
+	}
+	assert.Equal(t, []string{"01-WOLVE.WAV", "02-GARDE.WAV", "03-CARNI.WAV", "04-1_000.WAV", "05-STUMB.WAV"}, names)
+}
+
+func TestProfileASCII(t *testing.T) {
+	cd := CD{
+		Name:   "Сборник",
+		Tracks: []Track{{Title: "Ängel", LengthSectors: 75}},
+	}
+	fsys := createAt(t, testTime)
+	defer fsys.Close()
+
+	err := fsys.SetProfile(ProfileASCII)
+	assert.NoError(t, err)
+	err = fsys.LoadCD(cd)
+	assert.NoError(t, err)
+
+	path, _ := fsys.trackPath(cd, 0)
+	assert.Equal(t, "/Sbornik/01 - Angel.wav", path)
+	pfs := parseImage(t, fsys)
+	files, err := pfs.ReadDir("/Sbornik")
+	assert.NoError(t, err)
+	assert.Equal(t, "01 - Angel.wav", files[2].Name())
+}
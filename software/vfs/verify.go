@@ -0,0 +1,726 @@
+package vfs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+// The verifier reads FAT volumes following Microsoft's specifications
+// (fatgen103, and the exFAT file system specification) directly, without
+// sharing code with the rest of the package, so that it catches mistakes
+// in how images are generated.
+
+// Check identifies the structure a [Violation] was found in.
+type Check int
+
+const (
+	// CheckPartition is the MBR partition table.
+	CheckPartition Check = iota
+	// CheckBootSector is the boot sector and its backup.
+	CheckBootSector
+	// CheckFSInfo is the FAT32 FSInfo sector.
+	CheckFSInfo
+	// CheckFAT is the reserved FAT entries and the copies of the FAT.
+	CheckFAT
+	// CheckDirectory is the entries of a directory.
+	CheckDirectory
+	// CheckLongName is the long file name entries of a directory, or
+	// the file name entries and name hash of an exFAT entry set.
+	CheckLongName
+	// CheckChain is the cluster chain of a file or directory, and
+	// whether it matches the file's size.
+	CheckChain
+	// CheckCrossLink is a cluster in the chains of two files.
+	CheckCrossLink
+	// CheckLostCluster is an allocated cluster in no file's chain.
+	CheckLostCluster
+	// CheckBitmap is the exFAT allocation bitmap, and whether it marks
+	// the clusters of every file.
+	CheckBitmap
+	// CheckUpcaseTable is the exFAT up-case table.
+	CheckUpcaseTable
+)
+
+func (c Check) String() string {
+	switch c {
+	case CheckPartition:
+		return "partition"
+	case CheckBootSector:
+		return "boot sector"
+	case CheckFSInfo:
+		return "FSInfo"
+	case CheckFAT:
+		return "FAT"
+	case CheckDirectory:
+		return "directory"
+	case CheckLongName:
+		return "long name"
+	case CheckChain:
+		return "cluster chain"
+	case CheckCrossLink:
+		return "cross-link"
+	case CheckLostCluster:
+		return "lost cluster"
+	case CheckBitmap:
+		return "allocation bitmap"
+	case CheckUpcaseTable:
+		return "up-case table"
+	}
+	return fmt.Sprintf("Check(%d)", int(c))
+}
+
+// Violation is an inconsistency in a FAT volume, found by [Verify].
+type Violation struct {
+	Check   Check
+	Path    string // the file or directory concerned, if any
+	Cluster uint32 // the cluster concerned, if any
+	Message string
+}
+
+func (v Violation) String() string {
+	if v.Path != "" {
+		return fmt.Sprintf("%v: %v: %v", v.Check, v.Path, v.Message)
+	}
+	return fmt.Sprintf("%v: %v", v.Check, v.Message)
+}
+
+// Verify checks the FAT12, FAT16, FAT32 or exFAT volume on a disk image
+// of the given size, which is either the first partition of an MBR or,
+// for a superfloppy, the whole disk. It checks the boot sector, the
+// FSInfo sector or exFAT boot region checksums, that the copies of the
+// FAT match, every directory entry and long name, and that the cluster
+// chains match the sizes of the files, aren't cross-linked and account
+// for every allocated cluster. On exFAT, allocated clusters are those
+// marked in the allocation bitmap, and the up-case table and the
+// checksums and name hashes of the entry sets are checked too.
+//
+// The image is only read. An error is returned if it can't be read or
+// holds no volume Verify understands; the problems with a volume that
+// can be read are returned as violations.
+func Verify(r io.ReaderAt, size int64) ([]Violation, error) {
+	v := &verifier{r: r, diskSectors: size / 512}
+	if err := v.verify(); err != nil {
+		return nil, err
+	}
+	return v.violations, v.err
+}
+
+// Verify checks the disk as the host sees it, including anything the
+// host wrote, with [Verify].
+func (f *Filesystem) Verify() ([]Violation, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return Verify(imageReader{f}, f.vol.Size())
+}
+
+// imageReader reads the disk of a filesystem whose lock is held.
+type imageReader struct {
+	f *Filesystem
+}
+
+func (r imageReader) ReadAt(p []byte, off int64) (int, error) {
+	return r.f.readAt(p, off)
+}
+
+type verifier struct {
+	r           io.ReaderAt
+	diskSectors int64
+	violations  []Violation
+	err         error // the first read error
+
+	start          int64 // first sector of the volume
+	partSectors    int64 // size of the partition, if any
+	bytesPerSector int64
+	clusterSize    int64
+	fatType        FATType
+	clusterCount   uint32
+	fats           int64
+	fatSectors     int64
+	fatStart       int64 // sector of the first FAT
+	rootStart      int64 // sector of the FAT12/16 root directory
+	rootSectors    int64
+	rootCluster    uint32
+	dataStart      int64 // sector of cluster 2
+	label          string
+
+	fat    []uint32          // the first FAT, decoded
+	owner  []string          // the path of the file using each cluster
+	files  []verifiedFile    // every file and directory, in the order found
+	bitmap []byte            // the exFAT allocation bitmap
+	upcase map[uint16]uint16 // the exFAT up-case table
+}
+
+// verifiedFile is a file or directory found by the verifier, and the
+// clusters holding it.
+type verifiedFile struct {
+	path     string
+	dir      bool
+	size     int64
+	clusters []uint32
+}
+
+func (v *verifier) violation(c Check, path string, cluster uint32, format string, args ...any) {
+	v.violations = append(v.violations, Violation{Check: c, Path: path, Cluster: cluster, Message: fmt.Sprintf(format, args...)})
+}
+
+// read reads n bytes at the given sector.
+func (v *verifier) read(sector, n int64) []byte {
+	b := make([]byte, n)
+	if _, err := v.r.ReadAt(b, sector*512); err != nil && v.err == nil {
+		v.err = fmt.Errorf("reading sector %v: %w", sector, err)
+	}
+	return b
+}
+
+func (v *verifier) verify() error {
+	if v.diskSectors == 0 {
+		return fmt.Errorf("empty disk")
+	}
+	s0 := v.read(0, 512)
+	if v.err != nil {
+		return v.err
+	}
+	if s0[510] != 0x55 || s0[511] != 0xAA {
+		return fmt.Errorf("no boot signature in sector 0")
+	}
+	if !isBootSector(s0) && !isExFATBootSector(s0) {
+		v.checkPartition(s0)
+		if v.start == 0 {
+			return fmt.Errorf("no partition")
+		}
+	}
+	bs := v.read(v.start, 512)
+	if isExFATBootSector(bs) {
+		return v.verifyExFAT(bs)
+	}
+	if err := v.checkBootSector(bs); err != nil {
+		return err
+	}
+	v.checkFATs(bs[21])
+	if len(v.fat) < 2 {
+		return v.err
+	}
+	v.owner = make([]string, len(v.fat))
+	if v.fatType == FAT32 {
+		clusters, _ := v.chain(v.rootCluster, "/")
+		v.checkDir("/", v.readClusters(clusters), 0, 0)
+	} else {
+		v.checkDir("/", v.read(v.rootStart, v.rootSectors*v.bytesPerSector), 0, 0)
+	}
+	v.checkLost()
+	if v.fatType == FAT32 {
+		v.checkFSInfo(bs)
+	}
+	return v.err
+}
+
+// isBootSector reports whether the sector looks like a FAT boot sector
+// rather than an MBR.
+func isBootSector(b []byte) bool {
+	jump := b[0] == 0xEB && b[2] == 0x90 || b[0] == 0xE9
+	bps := binary.LittleEndian.Uint16(b[11:])
+	return jump && bps >= 512 && bps <= 4096 && bps&(bps-1) == 0
+}
+
+func (v *verifier) checkPartition(mbr []byte) {
+	p := mbr[446:]
+	if p[0] != 0x00 && p[0] != 0x80 {
+		v.violation(CheckPartition, "", 0, "invalid status %#x of the first partition", p[0])
+	}
+	switch p[4] {
+	case 0x01, 0x04, 0x06, 0x07, 0x0B, 0x0C, 0x0E:
+	default:
+		v.violation(CheckPartition, "", 0, "first partition has type %#x, not FAT", p[4])
+	}
+	v.start = int64(binary.LittleEndian.Uint32(p[8:]))
+	v.partSectors = int64(binary.LittleEndian.Uint32(p[12:]))
+	if v.start+v.partSectors > v.diskSectors {
+		v.violation(CheckPartition, "", 0, "partition of %v sectors at %v extends past the end of the disk of %v sectors",
+			v.partSectors, v.start, v.diskSectors)
+	}
+}
+
+func (v *verifier) checkBootSector(bs []byte) error {
+	le16 := func(i int) int64 { return int64(binary.LittleEndian.Uint16(bs[i:])) }
+	le32 := func(i int) int64 { return int64(binary.LittleEndian.Uint32(bs[i:])) }
+	bad := func(format string, args ...any) {
+		v.violation(CheckBootSector, "", 0, format, args...)
+	}
+
+	if !isBootSector(bs) {
+		return fmt.Errorf("no FAT volume at sector %v", v.start)
+	}
+	if bs[510] != 0x55 || bs[511] != 0xAA {
+		bad("no boot signature")
+	}
+	v.bytesPerSector = le16(11)
+	if v.bytesPerSector != 512 {
+		return fmt.Errorf("unsupported sector size %v", v.bytesPerSector)
+	}
+	spc := int64(bs[13])
+	if spc == 0 || spc&(spc-1) != 0 {
+		return fmt.Errorf("invalid sectors per cluster %v", spc)
+	}
+	v.clusterSize = spc * v.bytesPerSector
+	reserved, fats, rootEntries := le16(14), int64(bs[16]), le16(17)
+	if reserved == 0 || fats == 0 {
+		return fmt.Errorf("invalid BPB: %v reserved sectors, %v FATs", reserved, fats)
+	}
+	if media := bs[21]; media != 0xF0 && media < 0xF8 {
+		bad("invalid media type %#x", media)
+	}
+	totSec16, totSec32 := le16(19), le32(32)
+	totSec := totSec16
+	if totSec == 0 {
+		totSec = totSec32
+	} else if totSec32 != 0 && totSec32 != totSec16 {
+		bad("16 and 32 bit sector counts differ: %v and %v", totSec16, totSec32)
+	}
+	fatSz16 := le16(22)
+	fatSz := fatSz16
+	if fatSz == 0 {
+		fatSz = le32(36)
+	}
+	if totSec == 0 || fatSz == 0 {
+		return fmt.Errorf("invalid BPB: %v sectors, FATs of %v sectors", totSec, fatSz)
+	}
+
+	// the type is determined by the count of clusters alone (fatgen103, p. 14)
+	v.rootSectors = (rootEntries*32 + v.bytesPerSector - 1) / v.bytesPerSector
+	v.fats, v.fatSectors = fats, fatSz
+	v.fatStart = v.start + reserved
+	v.rootStart = v.fatStart + fats*fatSz
+	v.dataStart = v.rootStart + v.rootSectors
+	if v.dataStart >= v.start+totSec {
+		return fmt.Errorf("no data region in a volume of %v sectors", totSec)
+	}
+	count := (v.start + totSec - v.dataStart) / spc
+	v.clusterCount = uint32(count)
+	ext := bs[36:]
+	switch {
+	case count < 4085:
+		v.fatType = FAT12
+	case count < 65525:
+		v.fatType = FAT16
+	default:
+		v.fatType = FAT32
+		ext = bs[64:]
+	}
+
+	if v.fatType == FAT32 {
+		if rootEntries != 0 || totSec16 != 0 || fatSz16 != 0 {
+			bad("FAT32 volume with FAT12/16 fields set")
+		}
+		if version := le16(42); version != 0 {
+			bad("unknown version %#x", version)
+		}
+		v.rootCluster = uint32(le32(44))
+		if v.rootCluster < 2 || v.rootCluster >= v.clusterCount+2 {
+			bad("invalid root cluster %v", v.rootCluster)
+		}
+		if bk := le16(50); bk != 0 && bk != 0xFFFF {
+			if bk >= reserved {
+				bad("backup boot sector %v isn't reserved", bk)
+			} else if string(v.read(v.start+bk, 512)) != string(bs) {
+				bad("backup boot sector %v differs", bk)
+			}
+		}
+	} else {
+		if rootEntries == 0 {
+			bad("%v volume without a root directory", v.fatType)
+		} else if rootEntries*32%v.bytesPerSector != 0 {
+			bad("root directory of %v entries doesn't fill its sectors", rootEntries)
+		}
+	}
+	if v.start+totSec > v.diskSectors {
+		bad("volume of %v sectors extends past the end of the disk", totSec)
+	}
+	if v.partSectors > 0 && totSec > v.partSectors {
+		bad("volume of %v sectors is larger than its partition of %v", totSec, v.partSectors)
+	}
+	entryBits := map[FATType]int64{FAT12: 12, FAT16: 16, FAT32: 32}[v.fatType]
+	if need := ((count+2)*entryBits + 7) / 8; need > fatSz*v.bytesPerSector {
+		bad("FAT of %v sectors can't hold %v clusters", fatSz, count)
+	}
+	if ext[2] == 0x29 {
+		v.label = strings.TrimRight(string(ext[7:18]), " ")
+		if got := strings.TrimRight(string(ext[18:26]), " "); got != v.fatType.String() {
+			bad("file system type %q in the boot sector of a %v volume", got, v.fatType)
+		}
+	}
+	return nil
+}
+
+// checkFATs compares the copies of the FAT, decodes the first and checks
+// its reserved entries.
+func (v *verifier) checkFATs(media byte) {
+	size := v.fatSectors * v.bytesPerSector
+	first := v.read(v.fatStart, size)
+	for i := int64(1); i < v.fats; i++ {
+		other := v.read(v.fatStart+i*v.fatSectors, size)
+		for s := int64(0); s < v.fatSectors; s++ {
+			b := s * v.bytesPerSector
+			if string(first[b:b+v.bytesPerSector]) != string(other[b:b+v.bytesPerSector]) {
+				v.violation(CheckFAT, "", 0, "sector %v of FAT %v differs from the first FAT", s, i+1)
+				break
+			}
+		}
+	}
+
+	bits := map[FATType]int64{FAT12: 12, FAT16: 16, FAT32: 32, ExFAT: 32}[v.fatType]
+	v.fat = make([]uint32, min(int64(v.clusterCount)+2, size*8/bits))
+	for c := range v.fat {
+		switch v.fatType {
+		case FAT12:
+			e := uint32(binary.LittleEndian.Uint16(first[c*3/2:]))
+			if c%2 == 1 {
+				e >>= 4
+			}
+			v.fat[c] = e & 0xFFF
+		case FAT16:
+			v.fat[c] = uint32(binary.LittleEndian.Uint16(first[c*2:]))
+		case ExFAT:
+			v.fat[c] = binary.LittleEndian.Uint32(first[c*4:])
+		default:
+			v.fat[c] = binary.LittleEndian.Uint32(first[c*4:]) & 0x0FFFFFFF
+		}
+	}
+	if len(v.fat) < 2 {
+		v.violation(CheckFAT, "", 0, "FAT without reserved entries")
+		return
+	}
+	eoc := v.eoc()
+	if v.fat[0] != eoc&^0xFF|uint32(media) {
+		v.violation(CheckFAT, "", 0, "FAT[0] %#x doesn't match the media type %#x", v.fat[0], media)
+	}
+	// FAT16 and FAT32 keep clean shutdown and error flags in FAT[1]
+	flags := map[FATType]uint32{FAT16: 0xC000, FAT32: 0x0C000000}[v.fatType]
+	if v.fat[1]|flags != eoc {
+		v.violation(CheckFAT, "", 0, "invalid FAT[1] %#x", v.fat[1])
+	}
+}
+
+// checkLost reports the runs of allocated clusters no chain reached and,
+// on exFAT, of clusters in a chain that aren't marked allocated.
+func (v *verifier) checkLost() {
+	allocated := func(c uint32) bool {
+		return v.fat[c] != 0 && v.fat[c] != v.eoc()-8
+	}
+	if v.fatType == ExFAT {
+		allocated = v.inBitmap
+	}
+	v.runs(func(c uint32) bool { return allocated(c) && v.owner[c] == "" }, func(c, end uint32) {
+		if end == c {
+			v.violation(CheckLostCluster, "", c, "cluster %v is allocated but in no file", c)
+		} else {
+			v.violation(CheckLostCluster, "", c, "clusters %v-%v are allocated but in no file", c, end)
+		}
+	})
+	if v.fatType != ExFAT {
+		return
+	}
+	v.runs(func(c uint32) bool { return !allocated(c) && v.owner[c] != "" }, func(c, end uint32) {
+		if end == c {
+			v.violation(CheckBitmap, v.owner[c], c, "cluster %v isn't marked allocated", c)
+		} else {
+			v.violation(CheckBitmap, v.owner[c], c, "clusters %v-%v aren't marked allocated", c, end)
+		}
+	})
+}
+
+// runs calls report with the first and last cluster of each run of
+// clusters for which match returns true.
+func (v *verifier) runs(match func(c uint32) bool, report func(c, end uint32)) {
+	for c := uint32(2); c < uint32(len(v.fat)); c++ {
+		if !match(c) {
+			continue
+		}
+		end := c
+		for end+1 < uint32(len(v.fat)) && match(end+1) {
+			end++
+		}
+		report(c, end)
+		c = end
+	}
+}
+
+// eoc returns the largest end of chain marker. Those from eoc-7 on end
+// a chain, except on exFAT which only has the one, while eoc-8 marks a
+// bad cluster.
+func (v *verifier) eoc() uint32 {
+	return map[FATType]uint32{FAT12: 0xFFF, FAT16: 0xFFFF, FAT32: 0x0FFFFFFF, ExFAT: 0xFFFFFFFF}[v.fatType]
+}
+
+// chain follows the cluster chain starting at first, recording the
+// clusters as owned by path. ok is false if the chain is broken or
+// cross-linked, in which case the clusters up to the problem are
+// returned.
+func (v *verifier) chain(first uint32, path string) (clusters []uint32, ok bool) {
+	eoc := v.eoc()
+	for c := first; ; {
+		if c < 2 || c >= uint32(len(v.fat)) {
+			v.violation(CheckChain, path, c, "invalid cluster %v in chain", c)
+			return clusters, false
+		}
+		if !v.own(c, path) {
+			return clusters, false
+		}
+		clusters = append(clusters, c)
+
+		next := v.fat[c]
+		switch {
+		case next == eoc, next >= eoc-7 && v.fatType != ExFAT:
+			return clusters, true
+		case next == eoc-8:
+			v.violation(CheckChain, path, c, "bad cluster %v in chain", c)
+			return clusters, false
+		case next == 0:
+			v.violation(CheckChain, path, c, "free cluster %v in chain", c)
+			return clusters, false
+		}
+		c = next
+	}
+}
+
+// own records cluster c as owned by path, reporting whether it's free to
+// be.
+func (v *verifier) own(c uint32, path string) bool {
+	if other := v.owner[c]; other == path {
+		v.violation(CheckChain, path, c, "chain loops at cluster %v", c)
+		return false
+	} else if other != "" {
+		v.violation(CheckCrossLink, path, c, "cluster %v is also in the chain of %v", c, other)
+		return false
+	}
+	v.owner[c] = path
+	return true
+}
+
+func (v *verifier) readClusters(clusters []uint32) []byte {
+	b := make([]byte, 0, int64(len(clusters))*v.clusterSize)
+	for _, c := range clusters {
+		sector := v.dataStart + int64(c-2)*v.clusterSize/v.bytesPerSector
+		b = append(b, v.read(sector, v.clusterSize)...)
+	}
+	return b
+}
+
+// shortNameChars are the characters other than upper case letters and
+// digits allowed in short names.
+const shortNameChars = " !#$%&'()-@^_`{}~"
+
+// checkDir checks the entries of the directory at path, and the files
+// and directories in it. cluster is the first cluster of the directory
+// and parent that of its parent, which are 0 for the root.
+func (v *verifier) checkDir(path string, data []byte, cluster, parent uint32) {
+	join := func(name string) string {
+		return strings.TrimSuffix(path, "/") + "/" + name
+	}
+	var (
+		lfn      []uint16 // the long name being read
+		lfnSeq   byte     // the sequence number of the last entry read
+		lfnSum   byte
+		labels   int
+		shorts   = make(map[string]bool)
+		longs    = make(map[string]bool)
+		position = 0 // index of the entry among the used entries
+	)
+	orphan := func() {
+		if lfn != nil {
+			v.violation(CheckLongName, path, 0, "long name entries without a short name entry")
+			lfn = nil
+		}
+	}
+
+	for i := 0; i+32 <= len(data) && data[i] != 0; i += 32 {
+		ent := data[i : i+32]
+		attr := ent[11]
+		if ent[0] == 0xE5 {
+			orphan()
+			continue
+		}
+		if attr&0x3F == 0x0F {
+			seq := ent[0] & 0x1F
+			if ent[12] != 0 || ent[26] != 0 || ent[27] != 0 {
+				v.violation(CheckLongName, path, 0, "long name entry with type or cluster set")
+			}
+			if ent[0]&0x40 != 0 {
+				orphan()
+				if seq == 0 || seq > 20 {
+					v.violation(CheckLongName, path, 0, "invalid long name sequence number %v", seq)
+					continue
+				}
+				lfn, lfnSum = make([]uint16, int(seq)*13), ent[13]
+			} else if lfn == nil || seq != lfnSeq-1 || ent[13] != lfnSum {
+				v.violation(CheckLongName, path, 0, "long name entry out of sequence")
+				lfn = nil
+				continue
+			}
+			lfnSeq = seq
+			for j, off := range []int{1, 3, 5, 7, 9, 14, 16, 18, 20, 22, 24, 28, 30} {
+				lfn[(int(seq)-1)*13+j] = binary.LittleEndian.Uint16(ent[off:])
+			}
+			continue
+		}
+
+		short := string(ent[:11])
+		if attr&0x08 != 0 {
+			orphan()
+			labels++
+			if cluster != 0 || path != "/" {
+				v.violation(CheckDirectory, path, 0, "volume label outside the root directory")
+			} else if labels > 1 {
+				v.violation(CheckDirectory, path, 0, "more than one volume label")
+			}
+			continue
+		}
+
+		// the first two entries of a subdirectory are "." and ".."
+		first := uint32(binary.LittleEndian.Uint16(ent[20:]))<<16 | uint32(binary.LittleEndian.Uint16(ent[26:]))
+		if v.fatType != FAT32 {
+			first &= 0xFFFF
+		}
+		dot := short == ".          " || short == "..         "
+		if path != "/" && position < 2 {
+			want, target := ".          ", cluster
+			if position == 1 {
+				want, target = "..         ", parent
+			}
+			if short != want || attr&0x10 == 0 {
+				v.violation(CheckDirectory, path, 0, "entry %v is %q, not %q", position, strings.TrimSpace(short), strings.TrimSpace(want))
+			} else if first != target {
+				v.violation(CheckDirectory, path, 0, "%q points to cluster %v, not %v", strings.TrimSpace(short), first, target)
+			}
+			position++
+			orphan()
+			continue
+		}
+		position++
+		if dot {
+			v.violation(CheckDirectory, path, 0, "misplaced %q entry", strings.TrimSpace(short))
+			orphan()
+			continue
+		}
+
+		name, ok := shortName(ent[:11])
+		if !ok {
+			v.violation(CheckDirectory, path, 0, "invalid short name %q", short)
+		}
+		if shorts[short] {
+			v.violation(CheckDirectory, path, 0, "duplicate short name %q", short)
+		}
+		shorts[short] = true
+		if lfn != nil {
+			var sum byte
+			for _, c := range ent[:11] {
+				sum = (sum&1)<<7 + sum>>1 + c
+			}
+			switch {
+			case lfnSeq != 1:
+				v.violation(CheckLongName, path, 0, "incomplete long name for %q", name)
+			case sum != lfnSum:
+				v.violation(CheckLongName, path, 0, "long name checksum %#x doesn't match %#x of %q", lfnSum, sum, name)
+			default:
+				n := 0
+				for n < len(lfn) && lfn[n] != 0 {
+					n++
+				}
+				name = string(utf16.Decode(lfn[:n]))
+				if upper := strings.ToUpper(name); longs[upper] {
+					v.violation(CheckDirectory, path, 0, "duplicate long name %q", name)
+				} else {
+					longs[upper] = true
+				}
+			}
+			lfn = nil
+		}
+
+		size := int64(binary.LittleEndian.Uint32(ent[28:]))
+		p := join(name)
+		if attr&0x10 != 0 {
+			if size != 0 {
+				v.violation(CheckDirectory, p, 0, "directory with size %v", size)
+			}
+			if first == 0 {
+				v.violation(CheckChain, p, 0, "directory without clusters")
+				continue
+			}
+			clusters, ok := v.chain(first, p)
+			v.files = append(v.files, verifiedFile{path: p, dir: true, clusters: clusters})
+			if ok {
+				v.checkDir(p, v.readClusters(clusters), first, cluster)
+			}
+			continue
+		}
+
+		want := (size + v.clusterSize - 1) / v.clusterSize
+		if first == 0 {
+			if size > 0 {
+				v.violation(CheckChain, p, 0, "file of %v bytes without clusters", size)
+			}
+			v.files = append(v.files, verifiedFile{path: p, size: size})
+			continue
+		}
+		clusters, ok := v.chain(first, p)
+		v.files = append(v.files, verifiedFile{path: p, size: size, clusters: clusters})
+		if ok && int64(len(clusters)) != want {
+			v.violation(CheckChain, p, first, "%v clusters for %v bytes", len(clusters), size)
+		}
+	}
+	orphan()
+}
+
+// shortName returns the display form of an 11 byte short name, and
+// whether it's valid.
+func shortName(b []byte) (string, bool) {
+	ok := b[0] != ' '
+	for i, c := range b {
+		switch {
+		case i == 0 && c == 0x05: // an initial 0xE5
+		case c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c >= 0x80:
+		case strings.IndexByte(shortNameChars, c) >= 0:
+		default:
+			ok = false
+		}
+	}
+	name := strings.TrimRight(string(b[:8]), " ")
+	if ext := strings.TrimRight(string(b[8:]), " "); ext != "" {
+		name += "." + ext
+	}
+	return name, ok
+}
+
+func (v *verifier) checkFSInfo(bs []byte) {
+	sector := int64(binary.LittleEndian.Uint16(bs[48:]))
+	reserved := int64(binary.LittleEndian.Uint16(bs[14:]))
+	if sector == 0 || sector == 0xFFFF {
+		return // no FSInfo sector
+	}
+	if sector >= reserved {
+		v.violation(CheckFSInfo, "", 0, "FSInfo sector %v isn't reserved", sector)
+		return
+	}
+	b := v.read(v.start+sector, 512)
+	if binary.LittleEndian.Uint32(b[0:]) != 0x41615252 ||
+		binary.LittleEndian.Uint32(b[484:]) != 0x61417272 ||
+		binary.LittleEndian.Uint32(b[508:]) != 0xAA550000 {
+		v.violation(CheckFSInfo, "", 0, "missing signatures")
+		return
+	}
+
+	free := uint32(0)
+	for c := 2; c < len(v.fat); c++ {
+		if v.fat[c] == 0 {
+			free++
+		}
+	}
+	if got := binary.LittleEndian.Uint32(b[488:]); got != 0xFFFFFFFF && got != free {
+		v.violation(CheckFSInfo, "", 0, "free cluster count %v, but %v are free", got, free)
+	}
+	if next := binary.LittleEndian.Uint32(b[492:]); next != 0xFFFFFFFF && (next < 2 || next >= v.clusterCount+2) {
+		v.violation(CheckFSInfo, "", next, "invalid next free cluster %v", next)
+	}
+}
@@ -0,0 +1,363 @@
+package vfs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// isExFATBootSector reports whether the sector is an exFAT boot sector.
+func isExFATBootSector(b []byte) bool {
+	return string(b[3:11]) == "EXFAT   "
+}
+
+// verifyExFAT checks the exFAT volume whose boot sector is bs.
+func (v *verifier) verifyExFAT(bs []byte) error {
+	le32 := func(i int) int64 { return int64(binary.LittleEndian.Uint32(bs[i:])) }
+	bad := func(format string, args ...any) {
+		v.violation(CheckBootSector, "", 0, format, args...)
+	}
+
+	v.fatType = ExFAT
+	if bs[108] != 9 {
+		return fmt.Errorf("unsupported sector size shift %v", bs[108])
+	}
+	v.bytesPerSector = 512
+	// clusters are at most 32MiB
+	if bs[109] > 25-9 {
+		return fmt.Errorf("invalid sectors per cluster shift %v", bs[109])
+	}
+	v.clusterSize = v.bytesPerSector << bs[109]
+	v.fats = int64(bs[110])
+	v.fatStart = v.start + le32(80)
+	v.fatSectors = le32(84)
+	v.dataStart = v.start + le32(88)
+	v.clusterCount = uint32(le32(92))
+	v.rootCluster = uint32(le32(96))
+	if v.fats != 1 && v.fats != 2 || v.fatSectors == 0 || v.clusterCount == 0 {
+		return fmt.Errorf("invalid boot sector: %v FATs of %v sectors, %v clusters", v.fats, v.fatSectors, v.clusterCount)
+	}
+
+	// the BPB of FAT volumes is zeroed, so they aren't mistaken for one
+	for i := 11; i < 64; i++ {
+		if bs[i] != 0 {
+			bad("byte %v of the legacy BPB isn't zero", i)
+			break
+		}
+	}
+	// a partition offset of 0 is to be ignored
+	if off := int64(binary.LittleEndian.Uint64(bs[64:])); off != 0 && off != v.start {
+		bad("partition offset %v, but the volume is at sector %v", off, v.start)
+	}
+	if bs[105] != 1 {
+		bad("unknown version %v.%02d", bs[105], bs[104])
+	}
+	volSectors := int64(binary.LittleEndian.Uint64(bs[72:]))
+	if v.start+volSectors > v.diskSectors {
+		bad("volume of %v sectors extends past the end of the disk", volSectors)
+	}
+	if v.partSectors > 0 && volSectors > v.partSectors {
+		bad("volume of %v sectors is larger than its partition of %v", volSectors, v.partSectors)
+	}
+	// after the main and backup boot regions of 12 sectors
+	if le32(80) < 24 {
+		bad("FAT at sector %v overlaps the boot regions", le32(80))
+	}
+	if v.fatStart+v.fats*v.fatSectors > v.dataStart {
+		bad("FAT overlaps the cluster heap")
+	}
+	if (int64(v.clusterCount)+2)*4 > v.fatSectors*v.bytesPerSector {
+		bad("FAT of %v sectors can't hold %v clusters", v.fatSectors, v.clusterCount)
+	}
+	if v.dataStart+int64(v.clusterCount)*v.clusterSize/v.bytesPerSector > v.start+volSectors {
+		bad("cluster heap extends past the end of the volume")
+	}
+	if v.rootCluster < 2 || v.rootCluster >= v.clusterCount+2 {
+		bad("invalid root cluster %v", v.rootCluster)
+	}
+	v.checkBootRegions()
+
+	v.checkFATs(0xF8)
+	if len(v.fat) < 2 {
+		return v.err
+	}
+	v.owner = make([]string, len(v.fat))
+	clusters, _ := v.chain(v.rootCluster, "/")
+	root := v.readClusters(clusters)
+	if err := v.readSystemFiles(root); err != nil {
+		return err
+	}
+	v.checkExFATDir("/", root)
+	v.checkLost()
+	return v.err
+}
+
+// checkBootRegions checks the signatures and checksums of the main and
+// backup boot regions, and that the backup matches.
+func (v *verifier) checkBootRegions() {
+	var sums [2]string
+	for i, name := range []string{"main", "backup"} {
+		b := v.read(v.start+int64(i)*12, 12*512)
+		if b[510] != 0x55 || b[511] != 0xAA {
+			v.violation(CheckBootSector, "", 0, "no boot signature in the %v boot region", name)
+		}
+		for s := 1; s <= 8; s++ {
+			if binary.LittleEndian.Uint32(b[(s+1)*512-4:]) != 0xAA550000 {
+				v.violation(CheckBootSector, "", 0, "extended boot sector %v of the %v boot region isn't signed", s, name)
+			}
+		}
+		// the volume flags and percent in use change without the
+		// checksum being updated
+		var sum uint32
+		for j, c := range b[:11*512] {
+			if j == 106 || j == 107 || j == 112 {
+				continue
+			}
+			sum = (sum&1)<<31 + sum>>1 + uint32(c)
+		}
+		for j := 11 * 512; j < len(b); j += 4 {
+			if binary.LittleEndian.Uint32(b[j:]) != sum {
+				v.violation(CheckBootSector, "", 0, "checksum of the %v boot region is %#x, not %#x",
+					name, binary.LittleEndian.Uint32(b[j:]), sum)
+				break
+			}
+		}
+		sums[i] = string(b[11*512:])
+	}
+	if sums[0] != sums[1] {
+		v.violation(CheckBootSector, "", 0, "backup boot region differs")
+	}
+}
+
+// readSystemFiles reads the label, allocation bitmap and up-case table
+// from the entries of the root directory.
+func (v *verifier) readSystemFiles(root []byte) error {
+	labels := 0
+	for i := 0; i+32 <= len(root) && root[i] != 0; i += 32 {
+		ent := root[i : i+32]
+		first, size := binary.LittleEndian.Uint32(ent[20:]), int64(binary.LittleEndian.Uint64(ent[24:]))
+		switch ent[0] {
+		case 0x83:
+			labels++
+			if labels > 1 {
+				v.violation(CheckDirectory, "/", 0, "more than one volume label")
+			} else if n := int(ent[1]); n > 11 {
+				v.violation(CheckDirectory, "/", 0, "volume label of %v characters", n)
+			} else {
+				v.label = decodeUTF16(ent[2 : 2+2*n])
+			}
+		case 0x81:
+			// with two FATs there are two bitmaps, and the first is
+			// that of the first FAT
+			if v.bitmap != nil {
+				continue
+			}
+			v.bitmap = v.systemFile("allocation bitmap", first, size)
+			if size*8 < int64(v.clusterCount) {
+				v.violation(CheckBitmap, "", 0, "bitmap of %v bytes can't hold %v clusters", size, v.clusterCount)
+			}
+		case 0x82:
+			if v.upcase != nil {
+				v.violation(CheckUpcaseTable, "", 0, "more than one up-case table")
+				continue
+			}
+			table := v.systemFile("up-case table", first, size)
+			var sum uint32
+			for _, c := range table {
+				sum = (sum&1)<<31 + sum>>1 + uint32(c)
+			}
+			if want := binary.LittleEndian.Uint32(ent[4:]); sum != want {
+				v.violation(CheckUpcaseTable, "", 0, "checksum is %#x, not %#x", want, sum)
+			}
+			// runs of characters that are their own upper case are
+			// compressed to 0xFFFF and the length of the run
+			v.upcase = make(map[uint16]uint16)
+			c := uint16(0)
+			for j := 0; j+1 < len(table); j += 2 {
+				u := binary.LittleEndian.Uint16(table[j:])
+				if u == 0xFFFF && j+3 < len(table) {
+					c += binary.LittleEndian.Uint16(table[j+2:])
+					j += 2
+					continue
+				}
+				v.upcase[c] = u
+				c++
+			}
+		}
+	}
+	if v.bitmap == nil {
+		return fmt.Errorf("no allocation bitmap in the root directory")
+	}
+	if v.upcase == nil {
+		return fmt.Errorf("no up-case table in the root directory")
+	}
+	return nil
+}
+
+// systemFile reads the allocation bitmap or up-case table.
+func (v *verifier) systemFile(name string, first uint32, size int64) []byte {
+	clusters, _ := v.exfatClusters(first, size, false, name)
+	b := v.readClusters(clusters)
+	return b[:min(int64(len(b)), size)]
+}
+
+// exfatClusters returns the clusters of a file of size bytes starting at
+// first, following the FAT or, if contiguous, those after it, recording
+// them as owned by path. ok is false if the chain is broken or
+// cross-linked, in which case the clusters up to the problem are
+// returned.
+func (v *verifier) exfatClusters(first uint32, size int64, contiguous bool, path string) (clusters []uint32, ok bool) {
+	want := (size + v.clusterSize - 1) / v.clusterSize
+	if first == 0 {
+		if size > 0 {
+			v.violation(CheckChain, path, 0, "file of %v bytes without clusters", size)
+			return nil, false
+		}
+		return nil, true
+	}
+	if !contiguous {
+		clusters, ok = v.chain(first, path)
+		if ok && int64(len(clusters)) != want {
+			v.violation(CheckChain, path, first, "%v clusters for %v bytes", len(clusters), size)
+		}
+		return clusters, ok
+	}
+	for c := first; int64(len(clusters)) < want; c++ {
+		if c < 2 || c >= uint32(len(v.fat)) {
+			v.violation(CheckChain, path, c, "invalid cluster %v in contiguous file", c)
+			return clusters, false
+		}
+		if !v.own(c, path) {
+			return clusters, false
+		}
+		clusters = append(clusters, c)
+	}
+	return clusters, true
+}
+
+// inBitmap reports whether cluster c is marked allocated in the
+// allocation bitmap.
+func (v *verifier) inBitmap(c uint32) bool {
+	i := c - 2
+	return int(i/8) < len(v.bitmap) && v.bitmap[i/8]&(1<<(i%8)) != 0
+}
+
+// checkExFATDir checks the entry sets of the directory at path, and the
+// files and directories in it.
+func (v *verifier) checkExFATDir(path string, data []byte) {
+	join := func(name string) string {
+		return strings.TrimSuffix(path, "/") + "/" + name
+	}
+	names := make(map[string]bool)
+	for i := 0; i+32 <= len(data) && data[i] != 0; i += 32 {
+		switch typ := data[i]; {
+		case typ < 0x80:
+			continue // unused
+		case typ == 0x81, typ == 0x82, typ == 0x83:
+			if path != "/" {
+				v.violation(CheckDirectory, path, 0, "entry of type %#x outside the root directory", typ)
+			}
+			continue
+		case typ >= 0xA0 && typ < 0xC0:
+			continue // benign primary entries, such as the volume GUID
+		case typ >= 0xC0:
+			v.violation(CheckDirectory, path, 0, "secondary entry of type %#x outside an entry set", typ)
+			continue
+		case typ != 0x85:
+			v.violation(CheckDirectory, path, 0, "unknown entry of type %#x", typ)
+			continue
+		}
+
+		secondary := int(data[i+1])
+		if secondary < 2 || secondary > 18 {
+			v.violation(CheckDirectory, path, 0, "entry set of %v secondary entries", secondary)
+			continue
+		}
+		if i+(secondary+1)*32 > len(data) {
+			v.violation(CheckDirectory, path, 0, "entry set runs past the end of the directory")
+			break
+		}
+		set := data[i : i+(secondary+1)*32]
+		i += secondary * 32
+
+		var sum uint16
+		for j, c := range set {
+			if j == 2 || j == 3 {
+				continue
+			}
+			sum = (sum&1)<<15 + sum>>1 + uint16(c)
+		}
+		if want := binary.LittleEndian.Uint16(set[2:]); sum != want {
+			v.violation(CheckDirectory, path, 0, "entry set checksum is %#x, not %#x", want, sum)
+		}
+		stream := set[32:64]
+		if stream[0] != 0xC0 {
+			v.violation(CheckDirectory, path, 0, "entry set without a stream extension")
+			continue
+		}
+
+		nameLen := int(stream[3])
+		var name []uint16
+		for j := 2; j <= secondary && len(name) < nameLen; j++ {
+			ent := set[j*32 : (j+1)*32]
+			if ent[0] != 0xC1 {
+				break
+			}
+			for k := 2; k < 32 && len(name) < nameLen; k += 2 {
+				name = append(name, binary.LittleEndian.Uint16(ent[k:]))
+			}
+		}
+		if nameLen == 0 || len(name) < nameLen {
+			v.violation(CheckLongName, path, 0, "name of %v characters in %v entries", nameLen, secondary-1)
+			continue
+		}
+		var hash uint16
+		var upper []uint16
+		for _, c := range name {
+			u, ok := v.upcase[c]
+			if !ok {
+				u = c
+			}
+			upper = append(upper, u)
+			hash = (hash&1)<<15 + hash>>1 + u&0xFF
+			hash = (hash&1)<<15 + hash>>1 + u>>8
+		}
+		display := string(utf16.Decode(name))
+		p := join(display)
+		if want := binary.LittleEndian.Uint16(stream[4:]); hash != want {
+			v.violation(CheckLongName, p, 0, "name hash is %#x, not %#x", want, hash)
+		}
+		if key := string(utf16.Decode(upper)); names[key] {
+			v.violation(CheckDirectory, path, 0, "duplicate name %q", display)
+		} else {
+			names[key] = true
+		}
+
+		size := int64(binary.LittleEndian.Uint64(stream[24:]))
+		if valid := int64(binary.LittleEndian.Uint64(stream[8:])); valid > size {
+			v.violation(CheckDirectory, p, 0, "valid data length %v of %v bytes", valid, size)
+		}
+		first := binary.LittleEndian.Uint32(stream[20:])
+		clusters, ok := v.exfatClusters(first, size, stream[1]&0x02 != 0, p)
+		if binary.LittleEndian.Uint16(set[4:])&0x10 != 0 {
+			v.files = append(v.files, verifiedFile{path: p, dir: true, clusters: clusters})
+			if size == 0 || size%v.clusterSize != 0 {
+				v.violation(CheckDirectory, p, 0, "directory of %v bytes isn't whole clusters", size)
+			}
+			if ok {
+				v.checkExFATDir(p, v.readClusters(clusters))
+			}
+			continue
+		}
+		v.files = append(v.files, verifiedFile{path: p, size: size, clusters: clusters})
+	}
+}
+
+func decodeUTF16(b []byte) string {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(b[i*2:])
+	}
+	return string(utf16.Decode(u))
+}
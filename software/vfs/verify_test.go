@@ -0,0 +1,242 @@
+package vfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testVolume is a volume read back by the verifier, so that tests can
+// read the files of the layouts go-diskfs can't parse.
+type testVolume struct {
+	v        *verifier
+	fsType   string
+	label    string
+	problems []string // the violations found
+}
+
+// openTestVolume verifies the volume on a disk, which is either the first
+// partition of an MBR or, for a superfloppy, the whole disk.
+func openTestVolume(r interface {
+	io.ReaderAt
+	Size() int64
+}) (*testVolume, error) {
+	v := &verifier{r: r, diskSectors: r.Size() / SECTOR_SIZE}
+	if err := v.verify(); err != nil {
+		return nil, err
+	}
+	tv := &testVolume{v: v, fsType: v.fatType.String(), label: v.label}
+	for _, violation := range v.violations {
+		tv.problems = append(tv.problems, violation.String())
+	}
+	return tv, nil
+}
+
+// walk returns the paths of the files, in the order they were found.
+func (tv *testVolume) walk() []string {
+	var files []string
+	for _, f := range tv.v.files {
+		if !f.dir {
+			files = append(files, f.path)
+		}
+	}
+	return files
+}
+
+// readFile reads the file at path, comparing names case insensitively.
+func (tv *testVolume) readFile(path string) ([]byte, error) {
+	for _, f := range tv.v.files {
+		if !strings.EqualFold(f.path, path) {
+			continue
+		}
+		if f.dir {
+			return nil, fmt.Errorf("%v is a directory", path)
+		}
+		b := tv.v.readClusters(f.clusters)
+		if tv.v.err != nil {
+			return nil, tv.v.err
+		}
+		return b[:min(int64(len(b)), f.size)], nil
+	}
+	return nil, fmt.Errorf("%v not found", path)
+}
+
+// corruptible is an exported image and where its structures are.
+type corruptible struct {
+	img         []byte
+	start       int      // offset of the volume
+	fats        []int    // offsets of the FATs
+	entries     [2]int   // offsets of the short name entries, or exFAT file entries, of tracks 1 and 2
+	clusters    [2]int64 // first clusters of tracks 1 and 2
+	fatEntry    int      // size of a FAT entry in bytes
+	lastCluster int64
+	bitmap      int // offset of the exFAT allocation bitmap
+}
+
+func newCorruptible(t *testing.T, l Layout) *corruptible {
+	fsys := createAt(t, testTime)
+	defer fsys.Close()
+	require.NoError(t, fsys.SetLayout(l))
+	require.NoError(t, fsys.LoadCD(testDisc()))
+	var buf bytes.Buffer
+	require.NoError(t, fsys.Export(&buf))
+
+	v := fsys.vol
+	c := &corruptible{img: buf.Bytes(), fatEntry: 4, lastCluster: int64(v.clusterCount) + 1}
+	if l.Type == FAT16 {
+		c.fatEntry = 2
+	}
+	c.start = int(v.start) * SECTOR_SIZE
+	for i := range int(v.fatCount) {
+		c.fats = append(c.fats, c.start+int(v.reservedSectors+uint32(i)*v.fatSectors)*SECTOR_SIZE)
+	}
+	a := fsys.album("Test Disc")
+	dir := c.img[v.clusterOffset(a.dir.cluster):][:v.clusterSize()]
+	for i := range 2 {
+		c.entries[i] = int(v.clusterOffset(a.dir.cluster))
+		if l.Type == ExFAT {
+			// the file entry is two before the first file name entry
+			name := []byte{0xC1, 0}
+			for _, u := range utf16.Encode([]rune(a.tracks[i].name))[:8] {
+				name = binary.LittleEndian.AppendUint16(name, u)
+			}
+			c.entries[i] += bytes.Index(dir, name) - 64
+		} else {
+			c.entries[i] += bytes.Index(dir, []byte(a.tracks[i].short))
+		}
+		c.clusters[i] = int64(a.tracks[i].cluster)
+	}
+	if l.Type == ExFAT {
+		c.bitmap = int(v.clusterOffset(v.system[0].cluster))
+	}
+	return c
+}
+
+// setFAT sets the entry of a cluster in both FATs.
+func (c *corruptible) setFAT(cluster int64, value uint32) {
+	for _, off := range c.fats {
+		b := c.img[off+int(cluster)*c.fatEntry:]
+		if c.fatEntry == 2 {
+			binary.LittleEndian.PutUint16(b, uint16(value))
+		} else {
+			binary.LittleEndian.PutUint32(b, value)
+		}
+	}
+}
+
+func (c *corruptible) verify(t *testing.T) []Check {
+	violations, err := Verify(bytes.NewReader(c.img), int64(len(c.img)))
+	require.NoError(t, err)
+	var checks []Check
+	for _, v := range violations {
+		t.Log(v)
+		checks = append(checks, v.Check)
+	}
+	return checks
+}
+
+func TestVerify(t *testing.T) {
+	fat32 := Layout{Type: FAT32, Superfloppy: true, Size: 64 * 1024 * 1024}
+	fat16 := Layout{Type: FAT16, Size: 32 * 1024 * 1024}
+	exfat := Layout{Type: ExFAT, Size: 16 * 1024 * 1024}
+	// the bit of a cluster in the allocation bitmap
+	bit := func(c *corruptible, cluster int64) (*byte, byte) {
+		return &c.img[c.bitmap+int(cluster-2)/8], 1 << ((cluster - 2) % 8)
+	}
+	cases := []struct {
+		name    string
+		layout  Layout
+		corrupt func(c *corruptible)
+		want    []Check
+	}{
+		{"FAT32", fat32, func(c *corruptible) {}, nil},
+		{"FAT16", fat16, func(c *corruptible) {}, nil},
+		{"exFAT", exfat, func(c *corruptible) {}, nil},
+		{"FAT copies differ", fat32, func(c *corruptible) {
+			c.img[c.fats[1]+100] ^= 0xFF
+		}, []Check{CheckFAT}},
+		{"media type", fat16, func(c *corruptible) {
+			c.img[partitionStart*SECTOR_SIZE+21] = 0xF0
+		}, []Check{CheckFAT}},
+		{"backup boot sector", fat32, func(c *corruptible) {
+			c.img[backupBootSector*SECTOR_SIZE+3] = 'X'
+		}, []Check{CheckBootSector}},
+		{"partition past the end", fat16, func(c *corruptible) {
+			binary.LittleEndian.PutUint32(c.img[446+12:], uint32(len(c.img)/SECTOR_SIZE))
+		}, []Check{CheckPartition}},
+		{"long name entry checksum", fat32, func(c *corruptible) {
+			c.img[c.entries[0]-32+13] ^= 1
+		}, []Check{CheckLongName}},
+		{"long name checksum", fat16, func(c *corruptible) {
+			c.img[c.entries[0]+7] = 'X'
+		}, []Check{CheckLongName}},
+		{"orphaned long name", fat16, func(c *corruptible) {
+			c.img[c.entries[0]] = 0xE5
+		}, []Check{CheckLongName, CheckLostCluster}},
+		{"invalid short name", fat32, func(c *corruptible) {
+			c.img[c.entries[0]+1] = 'a'
+		}, []Check{CheckDirectory, CheckLongName}},
+		{"size", fat32, func(c *corruptible) {
+			b := c.img[c.entries[0]+28:]
+			binary.LittleEndian.PutUint32(b, binary.LittleEndian.Uint32(b)+64*1024)
+		}, []Check{CheckChain}},
+		{"cross-link", fat16, func(c *corruptible) {
+			binary.LittleEndian.PutUint16(c.img[c.entries[1]+26:], uint16(c.clusters[0]))
+		}, []Check{CheckCrossLink, CheckLostCluster}},
+		{"free cluster in chain", fat32, func(c *corruptible) {
+			c.setFAT(c.clusters[0], 0)
+		}, []Check{CheckChain, CheckLostCluster, CheckFSInfo}},
+		{"lost cluster", fat32, func(c *corruptible) {
+			c.setFAT(c.lastCluster, 0x0FFFFFFF)
+		}, []Check{CheckLostCluster, CheckFSInfo}},
+		{"free count", fat32, func(c *corruptible) {
+			b := c.img[fsInfoSector*SECTOR_SIZE+488:]
+			binary.LittleEndian.PutUint32(b, binary.LittleEndian.Uint32(b)-1)
+		}, []Check{CheckFSInfo}},
+		{"boot region checksum", exfat, func(c *corruptible) {
+			c.img[c.start+100] ^= 1 // the serial
+		}, []Check{CheckBootSector}},
+		{"entry set checksum", exfat, func(c *corruptible) {
+			c.img[c.entries[0]+8] ^= 1 // the creation time
+		}, []Check{CheckDirectory}},
+		{"name hash", exfat, func(c *corruptible) {
+			c.img[c.entries[0]+64+2] = 'X'
+		}, []Check{CheckDirectory, CheckLongName}},
+		{"exFAT cross-link", exfat, func(c *corruptible) {
+			binary.LittleEndian.PutUint32(c.img[c.entries[1]+32+20:], uint32(c.clusters[0]))
+		}, []Check{CheckDirectory, CheckCrossLink, CheckLostCluster}},
+		{"cluster not allocated", exfat, func(c *corruptible) {
+			b, mask := bit(c, c.clusters[0])
+			*b &^= mask
+		}, []Check{CheckBitmap}},
+		{"exFAT lost cluster", exfat, func(c *corruptible) {
+			b, mask := bit(c, c.lastCluster)
+			*b |= mask
+		}, []Check{CheckLostCluster}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newCorruptible(t, tc.layout)
+			tc.corrupt(c)
+			assert.ElementsMatch(t, tc.want, c.verify(t))
+		})
+	}
+}
+
+func TestVerifyErrors(t *testing.T) {
+	_, err := Verify(bytes.NewReader(make([]byte, 1024*1024)), 1024*1024)
+	assert.ErrorContains(t, err, "no boot signature")
+
+	// a partition without a volume
+	c := newCorruptible(t, Layout{Type: FAT16, Size: 32 * 1024 * 1024})
+	clear(c.img[c.start : c.start+SECTOR_SIZE])
+	_, err = Verify(bytes.NewReader(c.img), int64(len(c.img)))
+	assert.ErrorContains(t, err, "no FAT volume")
+}
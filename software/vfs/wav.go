@@ -0,0 +1,129 @@
+package vfs
+
+import (
+	"encoding/binary"
+)
+
+// Format of the PCM data in track files, which is CD audio.
+const (
+	wavChannels      = 2
+	wavSampleRate    = 44100
+	wavBitsPerSample = 16
+	wavBlockAlign    = wavChannels * wavBitsPerSample / 8
+
+	wavFormatPCM = 1
+)
+
+// WavHeaderSize is the size of a WAV header without metadata.
+const WavHeaderSize = 44
+
+// cuePoint marks a position in the PCM data, such as the start of a track.
+type cuePoint struct {
+	frame int64  // offset in sample frames
+	label string // optional
+}
+
+// wavHeader renders the RIFF/WAVE header for dataSize bytes of CD audio.
+// When tags are present, LIST/INFO and "id3 " chunks are included before
+// the data chunk, and when cue points are, a "cue " chunk and a LIST/adtl
+// chunk with their labels. The PCM data must immediately follow the
+// header.
+//
+// See http://soundfile.sapp.org/doc/WaveFormat/ and the RIFF spec
+// https://www.aelius.com/njh/wavemetatools/doc/riffmci.pdf
+func wavHeader(dataSize int64, tags Tags, cues []cuePoint) []byte {
+	b := make([]byte, 0, WavHeaderSize)
+	b = append(b, "RIFF\x00\x00\x00\x00WAVE"...)
+
+	b = append(b, "fmt "...)
+	b = binary.LittleEndian.AppendUint32(b, 16)
+	b = binary.LittleEndian.AppendUint16(b, wavFormatPCM)
+	b = binary.LittleEndian.AppendUint16(b, wavChannels)
+	b = binary.LittleEndian.AppendUint32(b, wavSampleRate)
+	b = binary.LittleEndian.AppendUint32(b, wavSampleRate*wavBlockAlign) // byte rate
+	b = binary.LittleEndian.AppendUint16(b, wavBlockAlign)
+	b = binary.LittleEndian.AppendUint16(b, wavBitsPerSample)
+
+	if !tags.IsEmpty() {
+		b = appendInfoChunk(b, tags)
+		b = appendChunk(b, "id3 ", tags.ID3v2())
+	}
+	if len(cues) > 0 {
+		b = appendCueChunk(b, cues)
+		b = appendLabelChunk(b, cues)
+	}
+
+	b = append(b, "data"...)
+	b = binary.LittleEndian.AppendUint32(b, uint32(dataSize))
+
+	// the RIFF size covers everything after the size field, including
+	// the data and its pad byte
+	riffSize := int64(len(b)) - 8 + dataSize + dataSize%2
+	binary.LittleEndian.PutUint32(b[4:], uint32(riffSize))
+	return b
+}
+
+// appendChunk appends a RIFF chunk, padded to an even length.
+func appendChunk(b []byte, id string, data []byte) []byte {
+	b = append(b, id...)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(data)))
+	b = append(b, data...)
+	if len(data)%2 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// appendInfoChunk appends a LIST chunk of type INFO with the tags.
+func appendInfoChunk(b []byte, tags Tags) []byte {
+	info := []byte("INFO")
+	for _, f := range []struct{ id, value string }{
+		{"INAM", tags.Title},
+		{"IART", tags.Artist},
+		{"IPRD", tags.Album},
+		{"ITRK", tags.trackNumber()},
+	} {
+		if f.value == "" {
+			continue
+		}
+		// values are NUL terminated strings
+		info = appendChunk(info, f.id, append([]byte(f.value), 0))
+	}
+	if len(info) == len("INFO") {
+		return b
+	}
+	return appendChunk(b, "LIST", info)
+}
+
+// appendCueChunk appends a "cue " chunk with the cue points, whose IDs
+// are their 1-based index.
+func appendCueChunk(b []byte, cues []cuePoint) []byte {
+	data := binary.LittleEndian.AppendUint32(nil, uint32(len(cues)))
+	for i, c := range cues {
+		data = binary.LittleEndian.AppendUint32(data, uint32(i+1))
+		data = binary.LittleEndian.AppendUint32(data, uint32(c.frame)) // play order position
+		data = append(data, "data"...)
+		data = binary.LittleEndian.AppendUint32(data, 0) // chunk start
+		data = binary.LittleEndian.AppendUint32(data, 0) // block start
+		data = binary.LittleEndian.AppendUint32(data, uint32(c.frame))
+	}
+	return appendChunk(b, "cue ", data)
+}
+
+// appendLabelChunk appends a LIST chunk of type adtl with the labels of
+// the cue points.
+func appendLabelChunk(b []byte, cues []cuePoint) []byte {
+	adtl := []byte("adtl")
+	for i, c := range cues {
+		if c.label == "" {
+			continue
+		}
+		labl := binary.LittleEndian.AppendUint32(nil, uint32(i+1))
+		labl = append(append(labl, c.label...), 0)
+		adtl = appendChunk(adtl, "labl", labl)
+	}
+	if len(adtl) == len("adtl") {
+		return b
+	}
+	return appendChunk(b, "LIST", adtl)
+}
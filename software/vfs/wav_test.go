@@ -0,0 +1,81 @@
+package vfs
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWavHeader(t *testing.T) {
+	h := wavHeader(1000, Tags{}, nil)
+	expected := []byte{
+		'R', 'I', 'F', 'F', 0x0C, 0x04, 0x00, 0x00, 'W', 'A', 'V', 'E',
+		'f', 'm', 't', ' ', 16, 0, 0, 0,
+		1, 0, // PCM
+		2, 0, // channels
+		0x44, 0xAC, 0x00, 0x00, // 44100 Hz
+		0x10, 0xB1, 0x02, 0x00, // 176400 bytes per second
+		4, 0, // block align
+		16, 0, // bits per sample
+		'd', 'a', 't', 'a', 0xE8, 0x03, 0x00, 0x00,
+	}
+	assert.Equal(t, expected, h)
+	assert.Len(t, h, WavHeaderSize)
+}
+
+// riffChunks parses the chunks of a RIFF file
+func riffChunks(t *testing.T, b []byte) map[string][]byte {
+	chunks := make(map[string][]byte)
+	for len(b) >= 8 {
+		id := string(b[0:4])
+		size := int(binary.LittleEndian.Uint32(b[4:]))
+		if id == "data" {
+			chunks[id] = nil
+			return chunks
+		}
+		if !assert.LessOrEqual(t, 8+size, len(b)) {
+			return chunks
+		}
+		chunks[id] = b[8 : 8+size]
+		b = b[8+size+size%2:]
+	}
+	return chunks
+}
+
+func TestWavHeaderTags(t *testing.T) {
+	tags := Tags{
+		Title:  "Gardening at Night",
+		Artist: "R.E.M.",
+		Album:  "Chronic Town",
+		Track:  2,
+		Tracks: 5,
+	}
+	const dataSize = 588 * 4
+	h := wavHeader(dataSize, tags, nil)
+
+	// RIFF size matches the whole file
+	assert.Equal(t, uint32(len(h)+dataSize-8), binary.LittleEndian.Uint32(h[4:]))
+	// data chunk is last
+	assert.Equal(t, "data", string(h[len(h)-8:len(h)-4]))
+	assert.Equal(t, uint32(dataSize), binary.LittleEndian.Uint32(h[len(h)-4:]))
+
+	chunks := riffChunks(t, h[12:])
+	assert.Contains(t, chunks, "fmt ")
+	assert.Contains(t, chunks, "data")
+	assert.Equal(t, tags.ID3v2(), chunks["id3 "])
+
+	list := chunks["LIST"]
+	assert.Equal(t, "INFO", string(list[:4]))
+	info := riffChunks(t, list[4:])
+	assert.Equal(t, "Gardening at Night\x00", string(info["INAM"]))
+	assert.Equal(t, "R.E.M.\x00", string(info["IART"]))
+	assert.Equal(t, "Chronic Town\x00", string(info["IPRD"]))
+	assert.Equal(t, "2/5\x00", string(info["ITRK"]))
+}
+
+func TestWavHeaderOddData(t *testing.T) {
+	h := wavHeader(3, Tags{Title: "odd"}, nil)
+	// the pad byte after the data is included in the RIFF size
+	assert.Equal(t, uint32(len(h)+3+1-8), binary.LittleEndian.Uint32(h[4:]))
+}